@@ -0,0 +1,607 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageAudit = "audit"
+
+	shortDescAudit = "audit: run scheduled fixity audits, keeping a history of each object's checks"
+
+	longDescAudit = shortDescAudit + `
+
+        Keeps a local database of objects to audit, with their expected
+        digests and the history of their fixity checks, and re-checks them on
+        a cycle:
+
+            audit add       add objects to the database
+            audit run       check the objects due for a check
+            audit status    list the objects in the database
+            audit history   list the recorded checks
+            audit remove    remove objects (and their history) from the database
+            audit sample    check a random sample of the objects under a prefix,
+                            and estimate the failure rate of the whole prefix
+
+        Each run checks the objects not checked within --min-age, highest
+        --priority first and then least recently checked first, stopping when
+        --max-bytes have been read or --max-time has elapsed; the rest are left
+        for the next run. Run it from cron (or similar) to audit a collection
+        too large to check all at once.
+
+        Objects whose digest no longer matches the expected digest are reported
+        as "changed", and objects that no longer exist as "missing". An object
+        added without an expected digest takes the digest calculated by its
+        first successful check.
+
+        The database is a single file, by default audit.db under cos in
+        $XDG_STATE_HOME (or ~/.local/state). The endpoint, region, and profile
+        in effect when an object is added are recorded with the object, and
+        used when it is checked.
+
+        For collections too large to check in full on any cycle, "audit sample"
+        lists a prefix (or reads a manifest), checks a random sample of the
+        objects, and reports the observed failure rate, with a confidence
+        interval for the failure rate of the whole collection. The sample size
+        is chosen so that, if at least --error-rate of the objects have failed,
+        the sample will include at least one failure with the --confidence
+        level given. The sample is drawn with a random seed, reported with the
+        results; give the same --random-seed to check the same sample again.
+        Without a manifest, each sampled object is only checked to be readable
+        in full; with a manifest, its size and (if given) digest are compared
+        with those in the manifest. Sampling audits do not use the database.
+    `
+
+	exampleAudit = `
+        cos audit add s3://mrt-test/ark/ --list -e http://127.0.0.1:9000/
+        cos audit add s3://mrt-test/ark/ --manifest ark-manifest.txt -e http://127.0.0.1:9000/ --priority 10
+        cos audit add swift://distrib.stage.9001.__c5e/ark/42 -e http://cloud.sdsc.edu/auth/v1.0 --expected 9a4e4d3c...
+        cos audit run --max-bytes 100G --max-time 6h --min-age 720h
+        cos audit status
+        cos audit history s3://mrt-test/ark/42
+        cos audit sample s3://mrt-test/ark/ -e http://127.0.0.1:9000/ --confidence 0.99 --error-rate 0.001
+        cos audit sample s3://mrt-test/ark/ -e http://127.0.0.1:9000/ --manifest ark-manifest.txt --random-seed 1571420812 --json
+    `
+)
+
+// ------------------------------------------------------------
+// auditFlags type
+
+type auditFlags struct {
+	*CosFlags
+
+	DB string
+
+	// add
+	List      bool
+	Manifest  string
+	Expected  string
+	Algorithm string
+	Priority  int
+
+	// run, status
+	MinAge   time.Duration
+	MaxBytes string
+	MaxTime  time.Duration
+	Due      bool
+
+	// sample
+	Confidence float64
+	ErrorRate  float64
+	Sample     int
+	Seed       int64
+	Jobs       int
+
+	JSON bool
+}
+
+func (f auditFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		db:       '%v'
+		list:      %v
+		manifest: '%v'
+		expected: '%v'
+		algorithm: %v
+		priority:  %d
+		min age:   %v
+		max bytes: %v
+		max time:  %v
+		due:       %v
+		confidence: %v
+		error rate: %v
+		sample:    %d
+		seed:      %d
+		jobs:      %d
+		json:      %v
+		timeout:   %v
+		op timeout: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.DB, f.List, f.Manifest, f.Expected,
+		f.Algorithm, f.Priority, f.MinAge, f.MaxBytes, f.MaxTime, f.Due,
+		f.Confidence, f.ErrorRate, f.Sample, f.Seed, f.Jobs, f.JSON, f.Timeout, f.OpTimeout)
+}
+
+func (f auditFlags) OpenDB() (*pkg.AuditDB, error) {
+	path := f.DB
+	if path == "" {
+		var err error
+		if path, err = defaultStatePath("audit.db"); err != nil {
+			return nil, err
+		}
+	}
+	return pkg.OpenAuditDB(path)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func auditAdd(urlStrs []string, f auditFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	if f.Expected != "" && (f.List || f.Manifest != "" || len(urlStrs) != 1) {
+		return errors.New("--expected can only be given with a single object URL")
+	}
+	if f.List && f.Manifest != "" {
+		return errors.New("only one of --list and --manifest can be given")
+	}
+	if _, err := objects.NewHash(f.Algorithm); err != nil {
+		return err
+	}
+
+	var objs []pkg.AuditObject
+	var err error
+	switch {
+	case f.Manifest != "":
+		if len(urlStrs) != 1 {
+			return errors.New("with --manifest, exactly one bucket or prefix URL should be given")
+		}
+		objs, err = auditManifestObjects(urlStrs[0], f)
+	case f.List:
+		objs, err = auditListedObjects(urlStrs, f)
+	default:
+		objs, err = auditNamedObjects(urlStrs, f)
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := f.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	added, err := db.Add(objs...)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Added %d objects to %v (%d already present)\n", added, db.Path, len(objs)-added)
+	return nil
+}
+
+func auditRun(f auditFlags, cmdFlags *pflag.FlagSet) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	audit := &pkg.Audit{MinAge: f.MinAge, MaxTime: f.MaxTime}
+	if f.MaxBytes != "" {
+		var err error
+		if audit.MaxBytes, err = parseSize(f.MaxBytes); err != nil {
+			return fmt.Errorf("invalid --max-bytes %#v: %v", f.MaxBytes, err)
+		}
+	}
+	resolver := jobResolver{flags: f.CosFlags, cmdFlags: cmdFlags}
+	audit.Resolve = func(obj *pkg.AuditObject) (objects.Object, error) {
+		return resolver.Object(&pkg.JobRequest{URL: obj.URL, Profile: obj.Profile, Endpoint: obj.Endpoint, Region: obj.Region})
+	}
+	audit.Report = func(obj *pkg.AuditObject, check pkg.AuditCheck) {
+		if f.JSON {
+			if data, err := json.Marshal(check); err == nil {
+				fmt.Println(string(data))
+			}
+			return
+		}
+		fmt.Printf("%v\t%v\t%d\t%v\t%v\n", check.Status, check.URL, check.Size, check.Digest, check.Error)
+	}
+
+	db, err := f.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	audit.DB = db
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	summary, err := audit.Run(ctx)
+	if summary != nil {
+		logger.Infof(
+			"%d of %d due objects checked (%v in %v): %d ok, %d changed, %d missing, %d errors; %d deferred\n",
+			summary.Checked, summary.Due, logging.FormatBytes(summary.Bytes), summary.Elapsed.Round(time.Millisecond),
+			summary.OK, summary.Changed, summary.Missing, summary.Errors, summary.Deferred,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if summary.Failed() > 0 {
+		return fmt.Errorf("%d of %d objects failed audit", summary.Failed(), summary.Checked)
+	}
+	return nil
+}
+
+func auditStatus(f auditFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	db, err := f.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var objs []*pkg.AuditObject
+	if f.Due {
+		audit := &pkg.Audit{DB: db, MinAge: f.MinAge}
+		objs, err = audit.Due(time.Now())
+	} else {
+		objs, err = db.Objects()
+	}
+	if err != nil {
+		return err
+	}
+	if f.JSON {
+		return writeAuditJSON(objs)
+	}
+	for _, obj := range objs {
+		lastStatus, lastChecked := "unchecked", "-"
+		if obj.Checked() {
+			lastStatus, lastChecked = obj.LastStatus, obj.LastChecked.Format(time.RFC3339)
+		}
+		fmt.Printf("%v\t%v\t%d\t%d\t%v\n", lastStatus, lastChecked, obj.Priority, obj.Size, obj.URL)
+	}
+	return nil
+}
+
+func auditHistory(urlStr string, f auditFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	db, err := f.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	checks, err := db.History(urlStr)
+	if err != nil {
+		return err
+	}
+	if f.JSON {
+		return writeAuditJSON(checks)
+	}
+	for _, check := range checks {
+		fmt.Printf("%v\t%v\t%v\t%d\t%v\t%v\n", check.Time.Format(time.RFC3339), check.Status, check.URL, check.Size, check.Digest, check.Error)
+	}
+	return nil
+}
+
+func auditRemove(urlStrs []string, f auditFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	db, err := f.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	for _, urlStr := range urlStrs {
+		removed, err := db.Remove(urlStr)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("not in audit database: %v", urlStr)
+		}
+		logger.Detailf("Removed %v\n", urlStr)
+	}
+	return nil
+}
+
+func auditSample(urlStr string, f auditFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	if f.Jobs < 1 {
+		return fmt.Errorf("invalid number of jobs: %d", f.Jobs)
+	}
+	s := &pkg.SampleAudit{
+		Confidence:  f.Confidence,
+		ErrorRate:   f.ErrorRate,
+		SampleSize:  f.Sample,
+		Seed:        f.Seed,
+		Concurrency: f.Jobs,
+	}
+	if s.Seed == 0 {
+		s.Seed = time.Now().UnixNano()
+	}
+	var err error
+	if s.Target, s.Prefix, err = prefixTarget(f.CosFlags, urlStr); err != nil {
+		return err
+	}
+	if f.Manifest != "" {
+		if s.Manifest, err = pkg.ReadManifest(f.Manifest); err != nil {
+			return err
+		}
+		if s.Manifest == nil {
+			s.Manifest = []pkg.ManifestEntry{}
+		}
+	}
+	if !f.JSON {
+		s.Report = func(r pkg.SampleResult) {
+			fmt.Printf("%v\t%v\t%d\t%v\t%v\n", r.Status, r.Key, r.Size, r.Digest, r.Error)
+		}
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	report, err := s.Run(ctx)
+	if report == nil {
+		return err
+	}
+	if f.JSON {
+		if jsonErr := writeAuditJSON(report); jsonErr != nil {
+			return jsonErr
+		}
+	} else {
+		logger.Infof(
+			"%d of %d objects checked (seed %d): %d failed (%.4g%%, about %.0f objects); %v%% confidence interval %.4g%%–%.4g%%, upper bound %.4g%%\n",
+			report.Checked, report.Population, report.Seed, report.Failed, 100*report.FailureRate, report.EstimatedFailures,
+			100*report.Confidence, 100*report.IntervalLower, 100*report.IntervalUpper, 100*report.UpperBound,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d sampled objects failed audit", report.Failed, report.Checked)
+	}
+	return nil
+}
+
+// auditObject returns a new AuditObject for the specified URL, recording the
+// current profile, endpoint, and region
+func auditObject(urlStr string, size int64, f auditFlags) pkg.AuditObject {
+	return pkg.AuditObject{
+		URL:       urlStr,
+		Profile:   f.Profile,
+		Endpoint:  f.Endpoint,
+		Region:    f.Region,
+		Algorithm: f.Algorithm,
+		Size:      size,
+		Priority:  f.Priority,
+	}
+}
+
+func auditNamedObjects(urlStrs []string, f auditFlags) ([]pkg.AuditObject, error) {
+	var objs []pkg.AuditObject
+	for _, urlStr := range urlStrs {
+		obj, err := f.Object(urlStr)
+		if err != nil {
+			return nil, err
+		}
+		auditObj := auditObject(obj.Pretty(), -1, f)
+		if f.Expected != "" {
+			expected, err := hex.DecodeString(f.Expected)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expected digest %#v: %v", f.Expected, err)
+			}
+			auditObj.Expected = hex.EncodeToString(expected)
+		}
+		objs = append(objs, auditObj)
+	}
+	return objs, nil
+}
+
+func auditListedObjects(urlStrs []string, f auditFlags) ([]pkg.AuditObject, error) {
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	var objs []pkg.AuditObject
+	for _, urlStr := range urlStrs {
+		target, prefix, err := prefixTarget(f.CosFlags, urlStr)
+		if err != nil {
+			return nil, err
+		}
+		infos, err := objects.ListObjects(ctx, target, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			objs = append(objs, auditObject(target.Object(info.Key).Pretty(), info.Size, f))
+		}
+	}
+	return objs, nil
+}
+
+func auditManifestObjects(urlStr string, f auditFlags) ([]pkg.AuditObject, error) {
+	entries, err := pkg.ReadManifest(f.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	target, prefix, err := prefixTarget(f.CosFlags, urlStr)
+	if err != nil {
+		return nil, err
+	}
+	var objs []pkg.AuditObject
+	for _, e := range entries {
+		auditObj := auditObject(target.Object(prefix+e.Key).Pretty(), e.Size, f)
+		if len(e.Digest) > 0 {
+			auditObj.Expected = hex.EncodeToString(e.Digest)
+			auditObj.Algorithm = "sha256"
+			if len(e.Digest) == 16 {
+				auditObj.Algorithm = "md5"
+			}
+		}
+		objs = append(objs, auditObj)
+	}
+	return objs, nil
+}
+
+func writeAuditJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := auditFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageAudit,
+		Short:   shortDescAudit,
+		Long:    logging.Untabify(longDescAudit, ""),
+		Args:    cobra.NoArgs,
+		Example: logging.Untabify(exampleAudit, "  "),
+	}
+	cmd.PersistentFlags().StringVar(&flags.DB, "db", "", "audit database file (default $XDG_STATE_HOME/cos/audit.db or ~/.local/state/cos/audit.db)")
+
+	addCmd := &cobra.Command{
+		Use:   "add <OBJECT-URL>... | <PREFIX-URL>... --list | <PREFIX-URL> --manifest <FILE>",
+		Short: "add objects to the audit database",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditAdd(args, flags)
+		},
+	}
+	addFlags := addCmd.Flags()
+	addFlags.SortFlags = false
+	addFlags.BoolVarP(&flags.List, "list", "l", false, "add all objects listed under each bucket or prefix URL")
+	addFlags.StringVar(&flags.Manifest, "manifest", "", "add the objects listed in this manifest file, relative to the bucket or prefix URL")
+	addFlags.StringVarP(&flags.Expected, "expected", "x", "", "expected digest, in hex (default: the digest calculated by the first check)")
+	addFlags.StringVarP(&flags.Algorithm, "algorithm", "a", "sha256", "digest algorithm (md5 or sha256)")
+	addFlags.IntVar(&flags.Priority, "priority", 0, "audit priority; higher priorities are checked first")
+
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "check the objects due for a check",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditRun(flags, cmd.Flags())
+		},
+	}
+	runFlags := runCmd.Flags()
+	runFlags.SortFlags = false
+	runFlags.DurationVar(&flags.MinAge, "min-age", 30*24*time.Hour, "minimum time between checks of an object")
+	runFlags.StringVar(&flags.MaxBytes, "max-bytes", "", "maximum bytes to read, e.g. \"100G\" (default no limit)")
+	runFlags.DurationVar(&flags.MaxTime, "max-time", 0, "time after which no further checks are started, e.g. \"6h\" (default no limit)")
+	runFlags.BoolVar(&flags.JSON, "json", false, "write each check as a line of JSON")
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "list the objects in the audit database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditStatus(flags)
+		},
+	}
+	statusFlags := statusCmd.Flags()
+	statusFlags.SortFlags = false
+	statusFlags.BoolVar(&flags.Due, "due", false, "list only the objects due for a check, in the order they will be checked")
+	statusFlags.DurationVar(&flags.MinAge, "min-age", 30*24*time.Hour, "minimum time between checks of an object (with --due)")
+	statusFlags.BoolVar(&flags.JSON, "json", false, "write JSON instead of tab-separated lines")
+
+	historyCmd := &cobra.Command{
+		Use:   "history [OBJECT-URL]",
+		Short: "list the recorded checks of one or all objects",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditHistory(firstArg(args), flags)
+		},
+	}
+	historyCmd.Flags().BoolVar(&flags.JSON, "json", false, "write JSON instead of tab-separated lines")
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <OBJECT-URL>...",
+		Short: "remove objects and their history from the audit database",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditRemove(args, flags)
+		},
+	}
+
+	sampleCmd := &cobra.Command{
+		Use:   "sample <PREFIX-URL>",
+		Short: "check a random sample of the objects under a prefix, estimating the failure rate",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditSample(args[0], flags)
+		},
+	}
+	sampleFlags := sampleCmd.Flags()
+	sampleFlags.SortFlags = false
+	sampleFlags.StringVar(&flags.Manifest, "manifest", "", "sample the objects listed in this manifest file, relative to the prefix URL, instead of listing the prefix")
+	sampleFlags.Float64VarP(&flags.Confidence, "confidence", "c", pkg.DefaultSampleConfidence, "confidence level")
+	sampleFlags.Float64Var(&flags.ErrorRate, "error-rate", pkg.DefaultSampleErrorRate, "tolerable error rate, for sizing the sample")
+	sampleFlags.IntVarP(&flags.Sample, "sample", "s", 0, "sample size (default calculated from --confidence and --error-rate)")
+	sampleFlags.Int64Var(&flags.Seed, "random-seed", 0, "seed for choosing the sample (default current time)")
+	sampleFlags.IntVarP(&flags.Jobs, "jobs", "j", pkg.DefaultCopyConcurrency, "number of objects to check at once")
+	sampleFlags.BoolVar(&flags.JSON, "json", false, "write a JSON report instead of tab-separated lines")
+
+	cmd.AddCommand(addCmd, runCmd, statusCmd, historyCmd, removeCmd, sampleCmd)
+	rootCmd.AddCommand(cmd)
+}
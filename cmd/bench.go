@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageBench = "bench [BUCKET-URL]"
+
+	shortDescBench = "bench: measure throughput and latency of storage operations"
+
+	longDescBench = shortDescBench + `
+
+        Runs a weighted mix of PUT, GET, ranged GET, HEAD, and DELETE operations
+        against a bucket or container, with objects of the specified sizes and
+        the specified number of concurrent workers, for the specified duration,
+        and reports the operations per second, throughput (in decimal MB/s), and
+        latency percentiles (p50, p90, p99, and max, in milliseconds) for each
+        operation at each size.
+
+        The mix is given as comma-separated operation=weight pairs, e.g.
+        --mix put=1,get=4. Before the benchmark starts, --seed-count objects of
+        each size are created for GET, HEAD, and DELETE to act on; all objects
+        created are deleted when the benchmark ends.
+    `
+
+	exampleBench = `
+        cos bench s3://www.dmoles.net/ --endpoint https://s3.us-west-2.amazonaws.com/
+        cos bench swift://distrib.stage.9001.__c5e/ -e http://cloud.sdsc.edu/auth/v1.0 --sizes 4K,1M,64M --jobs 16 --duration 5m --json
+        cos bench s3://mrt-test/ -e http://127.0.0.1:9000/ --mix get=3,range=1 --sizes 1G --range-size 1M
+    `
+)
+
+// ------------------------------------------------------------
+// benchFlags type
+
+type benchFlags struct {
+	*CosFlags
+
+	Mix       map[string]int
+	Sizes     []string
+	RangeSize string
+	SeedCount int
+	Jobs      int
+	Duration  time.Duration
+	Prefix    string
+	JSON      bool
+}
+
+func (f benchFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		mix:       %v
+		sizes:     %v
+		range size: %v
+		seed count: %d
+		jobs:      %d
+		duration:  %v
+		prefix:   '%v'
+		json:      %v
+		timeout:   %v
+		op timeout: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Mix, f.Sizes, f.RangeSize,
+		f.SeedCount, f.Jobs, f.Duration, f.Prefix, f.JSON, f.Timeout, f.OpTimeout)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func bench(bucketStr string, f benchFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("bucket URL: %v\n", bucketStr)
+
+	b := pkg.Bench{
+		Mix:         f.Mix,
+		SeedCount:   f.SeedCount,
+		Concurrency: f.Jobs,
+		Duration:    f.Duration,
+		Prefix:      f.Prefix,
+		RandomSeed:  time.Now().UnixNano(),
+	}
+	if b.Prefix == "" {
+		b.Prefix = fmt.Sprintf("cos-bench-%d/", time.Now().Unix())
+	}
+	for _, sizeStr := range f.Sizes {
+		size, err := parseSize(strings.TrimSpace(sizeStr))
+		if err != nil {
+			return fmt.Errorf("invalid object size %#v: %v", sizeStr, err)
+		}
+		b.Sizes = append(b.Sizes, size)
+	}
+	var err error
+	if b.RangeSize, err = parseSize(f.RangeSize); err != nil || b.RangeSize <= 0 {
+		return fmt.Errorf("invalid range size: %#v", f.RangeSize)
+	}
+
+	if b.Target, err = f.Target(bucketStr); err != nil {
+		return err
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	report, err := b.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if f.JSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return printBenchReport(report)
+}
+
+func printBenchReport(report *pkg.BenchReport) error {
+	fmt.Printf("%v: %d workers, %.1fs\n", report.Target, report.Concurrency, report.ElapsedSeconds)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "op\tsize\tops\terrors\tops/s\tMB/s\tp50 ms\tp90 ms\tp99 ms\tmax ms\t")
+	for _, r := range report.Results {
+		fmt.Fprintf(w, "%v\t%v\t%d\t%d\t%.1f\t%.2f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			r.Operation, logging.FormatBytes(r.Size), r.Count, r.Errors,
+			r.OpsPerSecond, r.MBPerSecond, r.P50, r.P90, r.P99, r.Max)
+	}
+	return w.Flush()
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := benchFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageBench,
+		Short:   shortDescBench,
+		Long:    logging.Untabify(longDescBench, ""),
+		Args:    cobra.MaximumNArgs(1),
+		Example: logging.Untabify(exampleBench, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return bench(firstArg(args), flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringToIntVar(&flags.Mix, "mix", pkg.DefaultBenchMix, "operations and relative weights ("+strings.Join(pkg.BenchOps, ", ")+")")
+	cmdFlags.StringSliceVarP(&flags.Sizes, "sizes", "s", []string{"4K", "1M"}, "object sizes, e.g. 4K,1M,64M")
+	cmdFlags.StringVar(&flags.RangeSize, "range-size", "64K", "size of ranged GETs")
+	cmdFlags.IntVar(&flags.SeedCount, "seed-count", pkg.DefaultBenchSeedCount, "objects of each size to create before starting")
+	cmdFlags.IntVarP(&flags.Jobs, "jobs", "j", 4, "number of concurrent workers")
+	cmdFlags.DurationVarP(&flags.Duration, "duration", "d", 30*time.Second, "how long to run, e.g. \"5m\"")
+	cmdFlags.StringVar(&flags.Prefix, "prefix", "", "key prefix for benchmark objects (default cos-bench-<timestamp>/)")
+	cmdFlags.BoolVar(&flags.JSON, "json", false, "write a JSON report instead of a table")
+
+	rootCmd.AddCommand(cmd)
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageBlocks = "blocks <OBJECT-URL>"
+
+	shortDescBlocks = "blocks: record the digest of each fixed-size block of an object"
+
+	longDescBlocks = shortDescBlocks + `
+
+        Downloads an object, calculating the digest of each --block-size block,
+        the root of a hash (Merkle) tree over the blocks, and the digest of the
+        whole object, and writes them as a JSON block manifest to the --output
+        file (or standard output). The output can also be an object URL, to
+        store the manifest in cloud storage.
+
+        With --sidecar, the manifest is stored as a "sidecar" object next to
+        the object, at OBJECT-URL` + pkg.SidecarSuffix + `.
+
+        The manifest can later be used with "cos check --spot-check" to verify
+        a random sample of blocks, detecting damage to large objects without
+        downloading them in full, or with "cos check --tree" (or --sidecar) to
+        find exactly which byte ranges of an object have changed.
+    `
+
+	exampleBlocks = `
+        cos blocks s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ -o inusitatum.blocks.json
+        cos blocks 'swift://distrib.stage.9001.__c5e/ark:/99999/fk4kw5kc1z|1|producer/6GBZeroFile.txt' -e http://cloud.sdsc.edu/auth/v1.0 --block-size 64M -o 6GBZeroFile.blocks.json
+        cos blocks s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ --sidecar
+    `
+)
+
+// ------------------------------------------------------------
+// blocksFlags type
+
+type blocksFlags struct {
+	*CosFlags
+
+	BlockSize string
+	Algorithm string
+	Output    string
+	Sidecar   bool
+}
+
+func (f blocksFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		block size: %v
+		algorithm: %v
+		output:   '%v'
+		timeout:   %v
+		op timeout: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.BlockSize, f.Algorithm, f.Output, f.Timeout, f.OpTimeout)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func blocks(objURLStr string, f blocksFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("object URL: %v\n", objURLStr)
+
+	output := f.Output
+	if f.Sidecar {
+		if output != "" {
+			return errors.New("--output cannot be used with --sidecar")
+		}
+		output = objURLStr + pkg.SidecarSuffix
+	}
+	blockSize, err := parseSize(f.BlockSize)
+	if err != nil {
+		return fmt.Errorf("invalid block size %#v: %v", f.BlockSize, err)
+	}
+	obj, err := f.Object(objURLStr)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	manifest, err := pkg.NewBlockManifest(ctx, obj, blockSize, f.Algorithm)
+	if err != nil {
+		return err
+	}
+	if err = writeBlockManifest(ctx, f.CosFlags, manifest, output); err != nil {
+		return err
+	}
+	logger.Detailf("%d blocks of %v (%v, root %v)\n", len(manifest.Blocks), logging.FormatBytes(blockSize), manifest.Digest, manifest.Root)
+	return nil
+}
+
+// isObjectURL returns true if the location of a block manifest is an object
+// URL, rather than a local file
+func isObjectURL(location string) bool {
+	return strings.Contains(location, "://")
+}
+
+// readBlockManifest reads a block manifest from a local file or an object URL
+func readBlockManifest(ctx context.Context, f *CosFlags, location string) (*pkg.BlockManifest, error) {
+	if !isObjectURL(location) {
+		return pkg.ReadBlockManifest(location)
+	}
+	obj, err := f.Object(location)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.DownloadBlockManifest(ctx, obj)
+}
+
+// writeBlockManifest writes a block manifest to a local file (or standard
+// output) or an object URL
+func writeBlockManifest(ctx context.Context, f *CosFlags, m *pkg.BlockManifest, location string) error {
+	if !isObjectURL(location) {
+		return m.Write(location)
+	}
+	obj, err := f.Object(location)
+	if err != nil {
+		return err
+	}
+	return m.Upload(ctx, obj)
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := blocksFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageBlocks,
+		Short:   shortDescBlocks,
+		Long:    logging.Untabify(longDescBlocks, ""),
+		Args:    cobra.ExactArgs(1),
+		Example: logging.Untabify(exampleBlocks, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return blocks(args[0], flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringVarP(&flags.BlockSize, "block-size", "b", "1M", "block size")
+	cmdFlags.StringVarP(&flags.Algorithm, "algorithm", "a", "sha256", "digest algorithm (md5 or sha256)")
+	cmdFlags.StringVarP(&flags.Output, "output", "o", "", "file or object URL to write the block manifest to (default standard output)")
+	cmdFlags.BoolVar(&flags.Sidecar, "sidecar", false, "store the block manifest as a sidecar object, at OBJECT-URL"+pkg.SidecarSuffix)
+
+	rootCmd.AddCommand(cmd)
+}
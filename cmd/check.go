@@ -1,14 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/dmolesUC3/cos/internal/objects"
 
 	"github.com/dmolesUC3/cos/pkg"
 
 	"github.com/dmolesUC3/cos/internal/logging"
-	"github.com/dmolesUC3/cos/internal/streaming"
 
 	"github.com/spf13/cobra"
 )
@@ -31,6 +34,39 @@ const (
 	making it possible to verify objects of arbitary size, not
 	limited by local storage space.
 
+	With --range, only the specified range of bytes is digested, given as
+	START-END (inclusive, e.g. 0-1048575 or 1G-2G) or START- (to the end of
+	the object).
+
+	With --spot-check, a block manifest previously created with "cos blocks"
+	is read, the object's size is compared with the size recorded, and the
+	digests of --spot-blocks randomly chosen blocks are compared with those
+	recorded, detecting damage to large objects without downloading them in
+	full. Each block checked is written to standard output as a tab-separated
+	line:
+
+	    STATUS  BLOCK  START-END  DIGEST  [ERROR]
+
+	where STATUS is ok or changed (or error).
+
+	With --tree, the object is downloaded in full, and the hash (Merkle) tree
+	of its blocks is compared with the one recorded in a block manifest (see
+	"cos blocks"), read from a local file or an object URL, to find exactly
+	which byte ranges of the object have changed (e.g. in a truncated or
+	damaged large-object segment). Each changed range is written to standard
+	output as a tab-separated line:
+
+	    changed  START-END  LENGTH
+
+	With --write-tree, a block manifest (using --block-size blocks) is built
+	while the object is checked, and written to the specified file or object
+	URL.
+
+	With --sidecar, the block manifest is kept in a "sidecar" object next to
+	the object, at OBJECT-URL` + pkg.SidecarSuffix + `: if the sidecar exists,
+	the object is compared with it as with --tree; if not, it is created as
+	with --write-tree.
+
 	`
 
 	exampleCheck = ` 
@@ -38,6 +74,10 @@ const (
 	cos check s3://www.dmoles.net/images/fa/archive.svg -e https://s3.us-west-2.amazonaws.com/ -x c99ad299fa53d5d9688909164cf25b386b33bea8d4247310d80f615be29978f5
 	cos check s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ -a md5 -x cadf871cd4135212419f488f42c62482
 	`+objects.SwiftUserEnvVar+`=<user> `+objects.SwiftKeyEnvVar+`=<key> cos check 'swift://distrib.stage.9001.__c5e/ark:/99999/fk4kw5kc1z|1|producer/6GBZeroFile.txt' -e http://cloud.sdsc.edu/auth/v1.0
+	cos check s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ --range 1M-2M
+	cos check 'swift://distrib.stage.9001.__c5e/ark:/99999/fk4kw5kc1z|1|producer/6GBZeroFile.txt' -e http://cloud.sdsc.edu/auth/v1.0 --spot-check 6GBZeroFile.blocks.json --spot-blocks 16
+	cos check s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ --sidecar
+	cos check s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ --tree inusitatum.blocks.json
     `
 )
 
@@ -45,10 +85,22 @@ const (
 // checkFlags type
 
 type checkFlags struct {
-	CosFlags
+	*CosFlags
+	EncryptionFlags
+	ObjectVersionFlags
 
 	Expected  []byte
 	Algorithm string
+	Range     string
+
+	SpotCheck  string
+	SpotBlocks int
+	Seed       int64
+
+	Tree      string
+	WriteTree string
+	Sidecar   bool
+	BlockSize string
 }
 
 func (f checkFlags) Pretty() string {
@@ -57,15 +109,28 @@ func (f checkFlags) Pretty() string {
 		expected: %x
 		algorithm: '%v'
 		endpoint: '%v'
-		region: '%v'`
+		region: '%v'
+		range: '%v'
+		spot check: '%v'
+		spot blocks: %d
+		random seed: %d
+		tree: '%v'
+		write tree: '%v'
+		sidecar: %v
+		block size: %v
+		timeout: %v
+		op timeout: %v
+		%v
+		%v`
 	format = logging.Untabify(format, "  ")
-	return fmt.Sprintf(format, f.Verbose, f.Expected, f.Algorithm, f.Endpoint, f.Region)
+	return fmt.Sprintf(format, f.Verbose, f.Expected, f.Algorithm, f.Endpoint, f.Region,
+		f.Range, f.SpotCheck, f.SpotBlocks, f.Seed, f.Tree, f.WriteTree, f.Sidecar, f.BlockSize, f.Timeout, f.OpTimeout, f.EncryptionFlags.Pretty(), f.ObjectVersionFlags.Pretty())
 }
 
 func (f checkFlags) String() string {
 	return fmt.Sprintf(
-		"checkFlags{ verbose: %v, expected: %x, algorithm: '%v', endpoint: '%v', region: '%v'}",
-		f.Verbose, f.Expected, f.Algorithm, f.Endpoint, f.Region,
+		"checkFlags{ verbose: %v, expected: %x, algorithm: '%v', endpoint: '%v', region: '%v', range: '%v', spot check: '%v', spot blocks: %d, random seed: %d, tree: '%v', write tree: '%v', sidecar: %v, block size: %v, timeout: %v, op timeout: %v}",
+		f.Verbose, f.Expected, f.Algorithm, f.Endpoint, f.Region, f.Range, f.SpotCheck, f.SpotBlocks, f.Seed, f.Tree, f.WriteTree, f.Sidecar, f.BlockSize, f.Timeout, f.OpTimeout,
 	)
 }
 
@@ -77,28 +142,43 @@ func check(objURLStr string, f checkFlags) error {
 	logger.Tracef("flags: %v\n", f)
 	logger.Tracef("object URL: %v\n", objURLStr)
 
-	objURL, err := streaming.ValidAbsURL(objURLStr)
+	obj, err := objectWithEncryption(f.CosFlags, &f.EncryptionFlags, objURLStr)
 	if err != nil {
 		return err
 	}
-
-	endpointURL, err := streaming.ValidAbsURL(f.Endpoint)
-	if err != nil {
+	if obj, err = f.ObjectVersionFlags.Apply(obj); err != nil {
 		return err
 	}
+	logger.Tracef("object: %v\n", obj)
 
-	obj, err := objects.NewObject(objURL, endpointURL, f.Region)
+	ctx, cancel, err := f.Context()
 	if err != nil {
 		return err
 	}
-	logger.Tracef("object: %v\n", obj)
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	if f.SpotCheck != "" {
+		return spotCheck(ctx, obj, f)
+	}
+	if f.Tree != "" || f.WriteTree != "" || f.Sidecar {
+		return treeCheck(ctx, obj, objURLStr, f)
+	}
 
 	var check = pkg.Check{
 		Object:    obj,
 		Expected:  f.Expected,
 		Algorithm: f.Algorithm,
 	}
-	digest, err := check.VerifyDigest()
+	if f.Range != "" {
+		if check.Range, err = parseByteRange(f.Range); err != nil {
+			return err
+		}
+	}
+	digest, err := check.VerifyDigest(ctx)
 	if err != nil {
 		return err
 	}
@@ -106,11 +186,114 @@ func check(objURLStr string, f checkFlags) error {
 	return nil
 }
 
+func spotCheck(ctx context.Context, obj objects.Object, f checkFlags) error {
+	if f.Range != "" || len(f.Expected) > 0 {
+		return errors.New("--range and --expected cannot be used with --spot-check")
+	}
+	if f.SpotBlocks < 1 {
+		return fmt.Errorf("invalid number of spot-check blocks: %d", f.SpotBlocks)
+	}
+	manifest, err := readBlockManifest(ctx, f.CosFlags, f.SpotCheck)
+	if err != nil {
+		return err
+	}
+	seed := f.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logging.DefaultLogger().Detailf("Checking %d of %d blocks (seed %d)\n", f.SpotBlocks, manifest.BlockCount(), seed)
+
+	spot := pkg.SpotCheck{Object: obj, Manifest: manifest, Blocks: f.SpotBlocks, Seed: seed}
+	results, err := spot.Run(ctx)
+	for _, r := range results {
+		status := "ok"
+		if r.Error != "" {
+			status = "error"
+		} else if !r.OK() {
+			status = "changed"
+		}
+		fmt.Printf("%v\t%d\t%d-%d\t%v\t%v\n", status, r.Block, r.Start, r.End, r.Actual, r.Error)
+	}
+	return err
+}
+
+func treeCheck(ctx context.Context, obj objects.Object, objURLStr string, f checkFlags) error {
+	if f.Range != "" {
+		return errors.New("--range cannot be used with --tree, --write-tree, or --sidecar")
+	}
+	if f.Sidecar && f.Tree != "" {
+		return errors.New("--tree cannot be used with --sidecar")
+	}
+	logger := logging.DefaultLogger()
+
+	treeOut := f.WriteTree
+	var expected *pkg.BlockManifest
+	var err error
+	if f.Sidecar {
+		sidecarURL := objURLStr + pkg.SidecarSuffix
+		expected, err = readBlockManifest(ctx, f.CosFlags, sidecarURL)
+		if objects.IsNotFound(err) {
+			logger.Infof("No sidecar block manifest found; creating %v\n", sidecarURL)
+			if treeOut != "" {
+				return errors.New("--write-tree cannot be used with --sidecar when the sidecar does not exist")
+			}
+			treeOut, err = sidecarURL, nil
+		}
+	} else if f.Tree != "" {
+		expected, err = readBlockManifest(ctx, f.CosFlags, f.Tree)
+	}
+	if err != nil {
+		return err
+	}
+
+	algorithm := f.Algorithm
+	var blockSize int64
+	if expected != nil {
+		algorithm, blockSize = expected.Algorithm, expected.BlockSize
+	} else if blockSize, err = parseSize(f.BlockSize); err != nil {
+		return fmt.Errorf("invalid block size %#v: %v", f.BlockSize, err)
+	}
+	if len(f.Expected) > 0 && algorithm != f.Algorithm {
+		return fmt.Errorf("--expected digest uses %v, but block manifest uses %v", f.Algorithm, algorithm)
+	}
+
+	actual, err := pkg.NewBlockManifest(ctx, obj, blockSize, algorithm)
+	if err != nil {
+		return err
+	}
+	if treeOut != "" {
+		if err = writeBlockManifest(ctx, f.CosFlags, actual, treeOut); err != nil {
+			return err
+		}
+	}
+	if len(f.Expected) > 0 && actual.Digest != hex.EncodeToString(f.Expected) {
+		return fmt.Errorf("digest mismatch: expected: %x, actual: %v", f.Expected, actual.Digest)
+	}
+	if expected != nil {
+		ranges, err := expected.Compare(actual)
+		if err != nil {
+			return err
+		}
+		if len(ranges) > 0 {
+			var changed int64
+			for _, r := range ranges {
+				length := r.End - r.Start + 1
+				changed += length
+				fmt.Printf("changed\t%d-%d\t%d\n", r.Start, r.End, length)
+			}
+			return fmt.Errorf("%d byte range(s) (%d bytes) differ from block manifest %v", len(ranges), changed, expected.Object)
+		}
+		logger.Detailf("tree root matches block manifest: %v\n", actual.Root)
+	}
+	fmt.Println(actual.Digest)
+	return nil
+}
+
 // ------------------------------------------------------------
 // Command initialization
 
 func init() {
-	flags := checkFlags{}
+	flags := checkFlags{CosFlags: rootFlags}
 
 	cmd := &cobra.Command{
 		Use:           usageCheck,
@@ -123,10 +306,20 @@ func init() {
 		},
 	}
 	cmdFlags := cmd.Flags()
-	flags.AddTo(cmdFlags)
+	cmdFlags.SortFlags = false
 
 	cmdFlags.StringVarP(&flags.Algorithm, "algorithm", "a", "sha256", "digest algorithm (md5 or sha256)")
 	cmdFlags.BytesHexVarP(&flags.Expected, "expected", "x", nil, "expected digest value (exit with error if not matched)")
+	cmdFlags.StringVar(&flags.Range, "range", "", "digest only this range of bytes, as START-END (inclusive) or START-")
+	cmdFlags.StringVar(&flags.SpotCheck, "spot-check", "", "spot-check randomly chosen blocks against this block manifest, a file or object URL (see \"cos blocks\")")
+	cmdFlags.IntVar(&flags.SpotBlocks, "spot-blocks", pkg.DefaultSpotCheckBlocks, "number of blocks to spot-check")
+	cmdFlags.Int64VarP(&flags.Seed, "random-seed", "", 0, "seed for choosing the blocks to spot-check (default current time)")
+	cmdFlags.StringVar(&flags.Tree, "tree", "", "compare the object's block hash tree with this block manifest (file or object URL)")
+	cmdFlags.StringVar(&flags.WriteTree, "write-tree", "", "write a block manifest of the object to this file or object URL")
+	cmdFlags.BoolVar(&flags.Sidecar, "sidecar", false, "compare with (or create) the block manifest at OBJECT-URL"+pkg.SidecarSuffix)
+	cmdFlags.StringVarP(&flags.BlockSize, "block-size", "b", "1M", "block size for --write-tree or a new --sidecar")
+	flags.EncryptionFlags.AddTo(cmdFlags)
+	flags.ObjectVersionFlags.AddTo(cmdFlags)
 
 	rootCmd.AddCommand(cmd)
 }
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageCp = "cp <SOURCE-URL> <DESTINATION-URL>"
+
+	shortDescCp = "cp: copy objects between buckets or endpoints and verify them"
+
+	longDescCp = shortDescCp + `
+
+        Copies an object, or all objects under a prefix, from one bucket or
+        container to another, possibly on a different endpoint and using a
+        different protocol (e.g. from Swift to S3). Each object is streamed from
+        the source to the destination without being staged to local disk, and
+        its SHA-256 and MD5 digests are computed on the way through. Objects
+        larger than the part size are copied as multipart uploads, so
+        --upload-mode single is not supported.
+
+        By default (--verify download), each copied object is downloaded again
+        and its SHA-256 digest compared with that of the source. With --verify
+        etag, the MD5 digests computed during the copy are instead compared with
+        the ETags reported by the destination.
+
+        The source and destination endpoints, regions, and profiles default to
+        the global --endpoint, --region, and --profile, and can be overridden
+        with --src-endpoint, --dst-endpoint, etc.
+
+        If the source URL ends in '/', or if --manifest is specified, cp performs
+        a bulk copy: every object under the source prefix (or every key listed in
+        the manifest, relative to the source prefix) is copied to the same key
+        relative to the destination prefix, with --jobs objects copied at once.
+        Otherwise, the single source object is copied to the destination URL (or,
+        if the destination URL ends in '/', to the same name under it).
+
+        With --log, a JSON receipt is appended to the specified file for each
+        object copied. If the copy is interrupted, running it again with the same
+        log skips the objects already recorded.
+    `
+
+	exampleCp = `
+        cos cp swift://distrib.stage.9001.__c5e/archive.zip s3://mrt-test/archive.zip --src-endpoint http://cloud.sdsc.edu/auth/v1.0 --dst-endpoint http://127.0.0.1:9000/
+        cos cp swift://distrib.stage.9001.__c5e/ark/ s3://mrt-test/ark/ --src-profile sdsc --dst-profile minio --jobs 8 --log ark-copy.log
+        cos cp swift://distrib.stage.9001.__c5e/ s3://mrt-test/ --src-profile sdsc --dst-profile minio --manifest keys.txt --log ark-copy.log
+    `
+)
+
+// ------------------------------------------------------------
+// cpFlags type
+
+type cpFlags struct {
+	*CosFlags
+	UploadFlags
+	EndpointPairFlags
+
+	Verify   string
+	Manifest string
+	Jobs     int
+	Log      string
+}
+
+func (f cpFlags) Pretty() string {
+	format := `
+		log level: %v
+		%v
+		verify:   '%v'
+		manifest: '%v'
+		jobs:      %d
+		log:      '%v'
+		timeout:   %v
+		op timeout: %v
+		%v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.EndpointPairFlags.Pretty(),
+		f.Verify, f.Manifest, f.Jobs, f.Log, f.Timeout, f.OpTimeout, f.UploadFlags.Pretty())
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func cp(srcURLStr, dstURLStr string, f cpFlags, cmdFlags *pflag.FlagSet) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("source URL: %v\n", srcURLStr)
+	logger.Tracef("destination URL: %v\n", dstURLStr)
+
+	if err := pkg.ValidVerifyMode(f.Verify); err != nil {
+		return err
+	}
+	if f.Jobs < 1 {
+		return fmt.Errorf("invalid number of jobs: %d", f.Jobs)
+	}
+
+	srcFlags, dstFlags, err := f.Endpoints(f.CosFlags, cmdFlags)
+	if err != nil {
+		return err
+	}
+	srcConfig, err := srcFlags.TargetConfig()
+	if err != nil {
+		return err
+	}
+	dstConfig, err := dstFlags.TargetConfig()
+	if err != nil {
+		return err
+	}
+	if dstConfig.Multipart, err = f.MultipartConfig(); err != nil {
+		return err
+	}
+	if dstConfig.Multipart.Mode == objects.UploadSingle {
+		// the copy is streamed through a pipe, which a single PUT can't re-read,
+		// and we don't stage it to disk
+		return fmt.Errorf("--upload-mode %v is not supported by cp: objects larger than the part size are copied as multipart uploads", objects.UploadSingle)
+	}
+	if f.Verify == pkg.VerifyETag {
+		dstConfig.Multipart.VerifyETags = true
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	var done []string
+	var log *pkg.ReceiptLog
+	if f.Log != "" {
+		receipts, err := pkg.ReadReceiptLog(f.Log)
+		if err != nil {
+			return err
+		}
+		for _, r := range receipts {
+			done = append(done, r.Source)
+		}
+		if log, err = pkg.OpenReceiptLog(f.Log); err != nil {
+			return err
+		}
+		defer func() {
+			if err := log.Close(); err != nil {
+				logger.Infof("Error closing %v: %v\n", f.Log, err)
+			}
+		}()
+	}
+
+	srcURL, err := srcFlags.BucketURL(srcURLStr)
+	if err != nil {
+		return err
+	}
+	srcKey := strings.TrimPrefix(srcURL.Path, "/")
+	bulk := f.Manifest != "" || srcKey == "" || strings.HasSuffix(srcKey, "/")
+
+	srcTarget, err := srcFlags.TargetWith(srcURLStr, srcConfig)
+	if err != nil {
+		return err
+	}
+	dstURL, err := dstFlags.BucketURL(dstURLStr)
+	if err != nil {
+		return err
+	}
+	dstKey := strings.TrimPrefix(dstURL.Path, "/")
+	dstTarget, err := dstFlags.TargetWith(dstURLStr, dstConfig)
+	if err != nil {
+		return err
+	}
+
+	if !bulk {
+		if dstKey == "" || strings.HasSuffix(dstKey, "/") {
+			dstKey += path.Base(srcKey)
+		}
+		return copyObject(ctx, srcTarget.Object(srcKey), dstTarget.Object(dstKey), f.Verify, log, done)
+	}
+
+	b := pkg.BulkCopy{
+		Source:            srcTarget,
+		SourcePrefix:      srcKey,
+		Destination:       dstTarget,
+		DestinationPrefix: dstKey,
+		Verify:            f.Verify,
+		Concurrency:       f.Jobs,
+		Log:               log,
+		Done:              done,
+		Copied:            printCopied,
+	}
+	if f.Manifest != "" {
+		entries, err := pkg.ReadManifest(f.Manifest)
+		if err != nil {
+			return err
+		}
+		b.Keys = []string{}
+		for _, e := range entries {
+			b.Keys = append(b.Keys, e.Key)
+		}
+	}
+
+	copied, skipped, failed, err := b.CopyAll(ctx)
+	logger.Detailf("%d copied, %d skipped, %d failed\n", copied, skipped, failed)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to copy %d of %d objects", failed, copied+skipped+failed)
+	}
+	return nil
+}
+
+// copyObject copies a single object, unless it is listed as already done
+func copyObject(ctx context.Context, src, dst objects.Object, verify string, log *pkg.ReceiptLog, done []string) error {
+	for _, url := range done {
+		if url == src.Pretty() {
+			logging.DefaultLogger().Infof("Skipping %v (already copied)\n", src)
+			return nil
+		}
+	}
+	c := pkg.Copy{Source: src, Destination: dst, Verify: verify}
+	r, err := c.CopyAndVerify(ctx)
+	if err != nil {
+		return err
+	}
+	if log != nil {
+		if err := log.Append(r); err != nil {
+			return err
+		}
+	}
+	printCopied(r)
+	return nil
+}
+
+func printCopied(r *pkg.Receipt) {
+	fmt.Printf("copied\t%v\t%v\t%d\t%v\n", r.Source, r.Object, r.Size, r.Digests["sha256"])
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := cpFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageCp,
+		Short:   shortDescCp,
+		Long:    logging.Untabify(longDescCp, ""),
+		Args:    cobra.ExactArgs(2),
+		Example: logging.Untabify(exampleCp, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cp(args[0], args[1], flags, cmd.Flags())
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	flags.EndpointPairFlags.AddTo(cmdFlags)
+	cmdFlags.StringVar(&flags.Verify, "verify", pkg.VerifyDownload, "verification mode ("+strings.Join(pkg.VerifyModes, ", ")+")")
+	cmdFlags.StringVar(&flags.Manifest, "manifest", "", "file listing the keys to copy, one per line, relative to the source prefix")
+	cmdFlags.IntVarP(&flags.Jobs, "jobs", "j", pkg.DefaultCopyConcurrency, "number of objects to copy at once (bulk copies only)")
+	cmdFlags.StringVar(&flags.Log, "log", "", "append a JSON receipt for each object copied to this file, and skip objects already recorded in it")
+	flags.UploadFlags.AddTo(cmdFlags, true)
+
+	rootCmd.AddCommand(cmd)
+}
@@ -1,16 +1,16 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"math"
-	"strconv"
 	"strings"
-	"unicode"
+	"time"
 
 	"code.cloudfoundry.org/bytefmt"
 	"github.com/spf13/cobra"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
 
 	"github.com/dmolesUC3/cos/pkg"
 )
@@ -19,7 +19,7 @@ import (
 // Constants: Help Text
 
 const (
-	usageCrvd = "crvd <BUCKET-URL>"
+	usageCrvd = "crvd [BUCKET-URL]"
 
 	shortDescCrvd = "crvd: create, retrieve, verify, and delete an object"
 
@@ -34,14 +34,49 @@ const (
         binary megabytes (M, MB, MiB), binary gigabytes (G, GB, GiB), and binary 
         terabytes (T, TB, TiB). If no unit is specified, bytes are assumed.
 
-        Random bytes are generated using the Go default random number generator, with
-        a default seed of 0, for repeatability. An alternative seed can be specified
-        with the --random-seed flag.
+        By default, random bytes are generated using the Go default random number
+        generator, with a default seed of 1, for repeatability. An alternative seed
+        can be specified with the --random-seed flag.
+
+        Other content can be selected with --generator:
+
+            random   seeded pseudo-random bytes (the default)
+            crypto   cryptographically strong bytes (an AES-256-CTR keystream keyed
+                     by the seed), which can't be compressed or deduplicated
+            zero     zero bytes
+            pattern  the --pattern string, repeated
+            text     highly compressible text, with words chosen using the seed
+            offset   each 8-byte word is its own offset in the object, as a
+                     big-endian integer, so that misplaced or corrupted data
+                     identifies where it came from
+
+        All generators are deterministic, so the same content (and digest) can be
+        re-created from the generator, seed, pattern, and size.
+
+        With --metadata, the generator, seed, pattern, size, and SHA-256 digest are
+        recorded as user metadata on the object (x-amz-meta-cos-* for S3,
+        X-Object-Meta-Cos-* for Swift). With --receipt, they are written to a local
+        JSON receipt file.
+
+        With --verify-existing, no object is created. Instead, the object named by
+        --key (or by the --receipt file) is verified, by regenerating its expected
+        digest from the parameters recorded in its metadata (or in the receipt),
+        and checking its size and digest. This makes it possible to check an
+        object kept with --keep for durability, days or months later.
+
+        In a versioned S3 bucket, the object is deleted by permanently deleting
+        the version created, rather than by creating a delete marker; any
+        earlier versions of the same key are left in place.
     `
 
 	exampleCrvd = `
         cos crvd s3://www.dmoles.net/ --endpoint https://s3.us-west-2.amazonaws.com/
         cos crvd swift://distrib.stage.9001.__c5e/ -e http://cloud.sdsc.edu/auth/v1.0
+        cos crvd s3://mrt-test/ -e http://127.0.0.1:9000/ --size 1G --generator offset
+        cos crvd s3://mrt-test/ -e http://127.0.0.1:9000/ --generator pattern --pattern 'DEADBEEF'
+        cos crvd s3://mrt-test/ -e http://127.0.0.1:9000/ --size 1G --key durability.bin --keep --metadata --receipt durability.json
+        cos crvd s3://mrt-test/ -e http://127.0.0.1:9000/ --key durability.bin --verify-existing
+        cos crvd --receipt durability.json -e http://127.0.0.1:9000/ --verify-existing
     `
 )
 
@@ -49,26 +84,32 @@ const (
 // crvdFlags type
 
 type crvdFlags struct {
-	CosFlags
+	*CosFlags
+	UploadFlags
+	EncryptionFlags
 
-	Key  string
-	Size string
-	Seed int64
-	Keep bool
+	Key       string
+	Size      string
+	Generator string
+	Seed      int64
+	Pattern   string
+	Keep      bool
+
+	Metadata       bool
+	Receipt        string
+	VerifyExisting bool
 }
 
-func (f crvdFlags) ContentLength() (int64, error) {
-	sizeStr := f.Size
-	sizeIsNumeric := strings.IndexFunc(sizeStr, unicode.IsLetter) == -1
-	if sizeIsNumeric {
-		return strconv.ParseInt(sizeStr, 10, 64)
+func (f crvdFlags) BodyGenerator() pkg.Generator {
+	g := pkg.Generator{Kind: f.Generator, Seed: f.Seed}
+	if g.Kind == pkg.GeneratorPattern {
+		g.Pattern = f.Pattern
 	}
+	return g
+}
 
-	bytes, err := bytefmt.ToBytes(sizeStr)
-	if err == nil && bytes > math.MaxInt64 {
-		return 0, fmt.Errorf("specified size %d bytes exceeds maximum %d", bytes, math.MaxInt64)
-	}
-	return int64(bytes), err
+func (f crvdFlags) ContentLength() (int64, error) {
+	return parseSize(f.Size)
 }
 
 func (f crvdFlags) Pretty() string {
@@ -78,13 +119,22 @@ func (f crvdFlags) Pretty() string {
 		endpoint: '%v'
         key:      '%v'
 		size:      %v (%d bytes)
+        generator: %v
         seed:      %d
-        keep:      %v`
+        pattern:  '%v'
+        keep:      %v
+        metadata:  %v
+        receipt:  '%v'
+        verify existing: %v
+		timeout:   %v
+		op timeout: %v
+		%v
+		%v`
 	format = logging.Untabify(format, "  ")
 
 	contentLength, _ := f.ContentLength()
 
-	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Key, f.Size, contentLength, f.Seed, f.Keep)
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Key, f.Size, contentLength, f.Generator, f.Seed, f.Pattern, f.Keep, f.Metadata, f.Receipt, f.VerifyExisting, f.Timeout, f.OpTimeout, f.UploadFlags.Pretty(), f.EncryptionFlags.Pretty())
 }
 
 func crvd(bucketStr string, f crvdFlags) (err error) {
@@ -92,50 +142,151 @@ func crvd(bucketStr string, f crvdFlags) (err error) {
 	logger.Tracef("flags: %v\n", f)
 	logger.Tracef("bucket URL: %v\n", bucketStr)
 
-	target, err := f.Target(bucketStr)
-	
+	if f.VerifyExisting {
+		return crvdVerifyExisting(bucketStr, f)
+	}
+
+	targetConfig, err := f.TargetConfig()
+	if err != nil {
+		return err
+	}
+	if targetConfig.Multipart, err = f.MultipartConfig(); err != nil {
+		return err
+	}
+	if targetConfig.Encryption, err = f.EncryptionConfig(); err != nil {
+		return err
+	}
+	target, err := f.TargetWith(bucketStr, targetConfig)
+	if err != nil {
+		return err
+	}
+
 	contentLength, err := f.ContentLength()
 	if err != nil {
 		return err
 	}
 
-	crvd := pkg.NewCrvd(target, f.Key, contentLength, f.Seed)
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	crvd, err := pkg.NewCrvdWithGenerator(target, f.Key, contentLength, f.BodyGenerator())
+	if err != nil {
+		return err
+	}
+	crvd.WriteMetadata = f.Metadata
+	logger.Detailf("Generating %v of %v\n", logging.FormatBytes(contentLength), crvd.Generator)
 
+	started := time.Now()
 	if f.Keep {
-		err = crvd.CreateRetrieveVerify()
+		err = crvd.CreateRetrieveVerify(ctx)
 		if err == nil {
 			fmt.Printf("%v object created, retrieved, and verified; keeping %v\n", logging.FormatBytes(crvd.ContentLength), crvd.Object.Pretty())
 		}
 	} else {
-		err = crvd.CreateRetrieveVerifyDelete()
+		err = crvd.CreateRetrieveVerifyDelete(ctx)
 		if err == nil {
 			fmt.Printf("%v object created, retrieved, verified, and deleted (%v)\n", logging.FormatBytes(crvd.ContentLength), crvd.Object.Pretty())
 		}
 	}
-	return err
+	if err != nil || f.Receipt == "" {
+		return err
+	}
+	receipt, err := crvd.NewReceipt(started)
+	if err != nil {
+		return err
+	}
+	return receipt.WriteTo(f.Receipt)
+}
+
+func crvdVerifyExisting(bucketStr string, f crvdFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	var crvd *pkg.Crvd
+	if f.Receipt != "" {
+		receipt, err := pkg.ReadReceipt(f.Receipt)
+		if err != nil {
+			return err
+		}
+		obj, err := objectWithEncryption(f.CosFlags, &f.EncryptionFlags, receipt.Object)
+		if err != nil {
+			return err
+		}
+		if crvd, err = pkg.CrvdFromReceipt(obj, receipt); err != nil {
+			return err
+		}
+	} else {
+		if f.Key == "" {
+			return errors.New("--verify-existing requires --key or --receipt")
+		}
+		targetConfig, err := f.TargetConfig()
+		if err != nil {
+			return err
+		}
+		if targetConfig.Encryption, err = f.EncryptionConfig(); err != nil {
+			return err
+		}
+		target, err := f.TargetWith(bucketStr, targetConfig)
+		if err != nil {
+			return err
+		}
+		if crvd, err = pkg.CrvdFromMetadata(ctx, target.Object(f.Key)); err != nil {
+			return err
+		}
+	}
+
+	digest, err := crvd.VerifyExisting(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v object verified (%v; sha256 %x): %v\n", logging.FormatBytes(crvd.ContentLength), crvd.Generator, digest, crvd.Object.Pretty())
+	return nil
 }
 
 func init() {
-	flags := crvdFlags{}
+	flags := crvdFlags{CosFlags: rootFlags}
 	cmd := &cobra.Command{
 		Use:           usageCrvd,
 		Short:         shortDescCrvd,
 		Long:          logging.Untabify(longDescCrvd, ""),
-		Args:          cobra.ExactArgs(1),
+		Args:          cobra.MaximumNArgs(1),
 		Example:       logging.Untabify(exampleCrvd, "  "),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return crvd(args[0], flags)
+			return crvd(firstArg(args), flags)
 		},
 	}
 	cmdFlags := cmd.Flags()
-	flags.AddTo(cmdFlags)
+	cmdFlags.SortFlags = false
 
 	sizeDefault := bytefmt.ByteSize(pkg.DefaultContentLengthBytes)
 
 	cmdFlags.StringVarP(&flags.Size, "size", "s", sizeDefault, "size object to create")
 	cmdFlags.StringVarP(&flags.Key, "key", "k", "", "key to create (defaults to cos-crvd-TIMESTAMP.bin)")
+	cmdFlags.StringVarP(&flags.Generator, "generator", "g", pkg.GeneratorRandom, "content generator ("+strings.Join(pkg.GeneratorKinds, ", ")+")")
 	cmdFlags.Int64VarP(&flags.Seed, "random-seed", "", pkg.DefaultRandomSeed, "seed for random-number generator")
+	cmdFlags.StringVar(&flags.Pattern, "pattern", pkg.DefaultPattern, "string to repeat, for --generator pattern")
 	cmdFlags.BoolVarP(&flags.Keep, "keep", "", false, "keep object after verification (default false)")
+	cmdFlags.BoolVar(&flags.Metadata, "metadata", false, "record generator, seed, size, and digest as user metadata on the object")
+	cmdFlags.StringVar(&flags.Receipt, "receipt", "", "write a JSON receipt recording generator, seed, size, and digest to this file (or, with --verify-existing, read one)")
+	cmdFlags.BoolVar(&flags.VerifyExisting, "verify-existing", false, "verify an existing object against its recorded metadata (or --receipt), instead of creating one")
+	flags.UploadFlags.AddTo(cmdFlags, true)
+	flags.EncryptionFlags.AddTo(cmdFlags)
 
 	rootCmd.AddCommand(cmd)
 }
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageDiff = "diff [<SOURCE-URL>] <DESTINATION-URL>"
+
+	shortDescDiff = "diff: compare the objects under two prefixes, or a prefix and a manifest"
+
+	longDescDiff = shortDescDiff + `
+
+        Lists the objects under a source prefix and a destination prefix (possibly
+        on different endpoints; see cp), and reports objects missing from the
+        destination, extra objects in the destination, and objects whose sizes
+        differ. With --digests, the SHA-256 digests of objects present on both
+        sides with the same size are also calculated and compared, with --jobs
+        objects digested at once.
+
+        With --manifest, the objects listed in the specified manifest file (as
+        for cp, one key per line, optionally followed by a size and an MD5 or
+        SHA-256 digest, separated by tabs) are compared with those under the
+        destination prefix, and only the destination URL is given.
+
+        Each difference is written to standard output as a tab-separated line:
+
+            STATUS  KEY  SOURCE-SIZE  DESTINATION-SIZE  [DETAIL]
+
+        where STATUS is one of missing, extra, size, digest, or error, and a
+        size of -1 indicates a missing object (or, for a manifest, an unknown
+        size). With --json, a JSON report is written instead. cos exits with an
+        error if any differences are found.
+    `
+
+	exampleDiff = `
+        cos diff swift://distrib.stage.9001.__c5e/ark/ s3://mrt-test/ark/ --src-endpoint http://cloud.sdsc.edu/auth/v1.0 --dst-endpoint http://127.0.0.1:9000/
+        cos diff s3://mrt-test/ark/ -e http://127.0.0.1:9000/ --manifest ark-manifest.txt --digests --json
+    `
+)
+
+// ------------------------------------------------------------
+// diffFlags type
+
+type diffFlags struct {
+	*CosFlags
+	EndpointPairFlags
+
+	Manifest string
+	Digests  bool
+	Jobs     int
+	JSON     bool
+}
+
+func (f diffFlags) Pretty() string {
+	format := `
+		log level: %v
+		%v
+		manifest: '%v'
+		digests:   %v
+		jobs:      %d
+		json:      %v
+		timeout:   %v
+		op timeout: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.EndpointPairFlags.Pretty(),
+		f.Manifest, f.Digests, f.Jobs, f.JSON, f.Timeout, f.OpTimeout)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func diff(srcURLStr, dstURLStr string, f diffFlags, cmdFlags *pflag.FlagSet) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("source URL: %v\n", srcURLStr)
+	logger.Tracef("destination URL: %v\n", dstURLStr)
+
+	if f.Jobs < 1 {
+		return fmt.Errorf("invalid number of jobs: %d", f.Jobs)
+	}
+	srcFlags, dstFlags, err := f.Endpoints(f.CosFlags, cmdFlags)
+	if err != nil {
+		return err
+	}
+
+	d := pkg.Diff{Digests: f.Digests, Concurrency: f.Jobs}
+	if f.Manifest != "" {
+		if d.Manifest, err = pkg.ReadManifest(f.Manifest); err != nil {
+			return err
+		}
+		if d.Manifest == nil {
+			d.Manifest = []pkg.ManifestEntry{}
+		}
+	} else {
+		if d.Source, d.SourcePrefix, err = prefixTarget(srcFlags, srcURLStr); err != nil {
+			return err
+		}
+	}
+	if d.Destination, d.DestinationPrefix, err = prefixTarget(dstFlags, dstURLStr); err != nil {
+		return err
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	report, err := d.Compare(ctx)
+	if err != nil {
+		return err
+	}
+	if f.Manifest != "" {
+		report.Source = f.Manifest
+	}
+
+	if f.JSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err = os.Stdout.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	} else {
+		for _, diff := range report.Differences {
+			fmt.Printf("%v\t%v\t%d\t%d\t%v\n", diff.Status, diff.Key, diff.SourceSize, diff.DestinationSize, diff.Detail)
+		}
+	}
+	logger.Detailf("%d objects compared, %d differences\n", report.Compared, len(report.Differences))
+	if len(report.Differences) > 0 {
+		return fmt.Errorf("%d differences between %v and %v", len(report.Differences), report.Source, report.Destination)
+	}
+	return nil
+}
+
+// prefixTarget returns the target and key prefix for the specified URL
+func prefixTarget(f *CosFlags, urlStr string) (objects.Target, string, error) {
+	u, err := f.BucketURL(urlStr)
+	if err != nil {
+		return nil, "", err
+	}
+	target, err := f.TargetWith(urlStr, objects.TargetConfig{})
+	if err != nil {
+		return nil, "", err
+	}
+	return target, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := diffFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageDiff,
+		Short:   shortDescDiff,
+		Long:    logging.Untabify(longDescDiff, ""),
+		Args:    cobra.RangeArgs(1, 2),
+		Example: logging.Untabify(exampleDiff, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.Manifest != "" {
+				if len(args) != 1 {
+					return errors.New("with --manifest, only the destination URL should be given")
+				}
+				return diff("", args[0], flags, cmd.Flags())
+			}
+			if len(args) != 2 {
+				return errors.New("both source and destination URLs are required, unless --manifest is given")
+			}
+			return diff(args[0], args[1], flags, cmd.Flags())
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	flags.EndpointPairFlags.AddTo(cmdFlags)
+	cmdFlags.StringVar(&flags.Manifest, "manifest", "", "compare the destination with the objects listed in this file, instead of a source prefix")
+	cmdFlags.BoolVarP(&flags.Digests, "digests", "d", false, "compare digests of objects with matching sizes")
+	cmdFlags.IntVarP(&flags.Jobs, "jobs", "j", pkg.DefaultCopyConcurrency, "number of objects to digest at once")
+	cmdFlags.BoolVar(&flags.JSON, "json", false, "write a JSON report instead of tab-separated lines")
+
+	rootCmd.AddCommand(cmd)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+// EncryptionFlags holds flags controlling S3 server-side encryption, shared
+// by commands that create or read objects
+type EncryptionFlags struct {
+	SSE            string
+	SSEKMSKeyID    string
+	SSECustomerKey string
+}
+
+// AddTo adds the encryption flags to the specified flag set
+func (f *EncryptionFlags) AddTo(cmdFlags *pflag.FlagSet) {
+	cmdFlags.StringVar(&f.SSE, "sse", string(objects.EncryptionNone), "S3 server-side encryption: none, s3 (SSE-S3), kms (SSE-KMS), or c (SSE-C)")
+	cmdFlags.StringVar(&f.SSEKMSKeyID, "sse-kms-key-id", "", "KMS key ID or ARN for --sse kms (default the AWS-managed key)")
+	cmdFlags.StringVar(&f.SSECustomerKey, "sse-c-key-file", "", "file containing the 256-bit customer key for --sse c (raw, base64, or hex)")
+}
+
+// EncryptionConfig returns the S3 encryption configuration specified by the
+// flags, reading the customer key (if any) from its file
+func (f *EncryptionFlags) EncryptionConfig() (config objects.EncryptionConfig, err error) {
+	if config.Mode, err = objects.ParseEncryptionMode(f.SSE); err != nil {
+		return config, err
+	}
+	config.KMSKeyID = f.SSEKMSKeyID
+	if f.SSECustomerKey != "" {
+		if config.CustomerKey, err = objects.ReadCustomerKey(f.SSECustomerKey); err != nil {
+			return config, err
+		}
+	} else if config.Mode == objects.EncryptionCustomer {
+		return config, fmt.Errorf("--sse c requires --sse-c-key-file")
+	}
+	return config, config.Validate()
+}
+
+func (f *EncryptionFlags) Pretty() string {
+	return fmt.Sprintf("sse: %v, sse kms key id: %#v, sse-c key file: %#v", f.SSE, f.SSEKMSKeyID, f.SSECustomerKey)
+}
+
+// objectWithEncryption returns the object for the specified URL, as with
+// CosFlags.Object, but with the encryption configuration specified by the
+// flags (required to read SSE-C objects)
+func objectWithEncryption(f *CosFlags, ef *EncryptionFlags, objURLStr string) (objects.Object, error) {
+	targetConfig, err := f.TargetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if targetConfig.Encryption, err = ef.EncryptionConfig(); err != nil {
+		return nil, err
+	}
+	return f.ObjectWith(objURLStr, targetConfig)
+}
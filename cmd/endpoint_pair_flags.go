@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// EndpointPairFlags holds flags selecting separate source and destination
+// endpoints, shared by commands (such as cp and diff) that address two targets
+type EndpointPairFlags struct {
+	SrcEndpoint string
+	SrcRegion   string
+	SrcProfile  string
+	DstEndpoint string
+	DstRegion   string
+	DstProfile  string
+}
+
+// AddTo adds the endpoint pair flags to the specified flag set
+func (f *EndpointPairFlags) AddTo(cmdFlags *pflag.FlagSet) {
+	cmdFlags.StringVar(&f.SrcEndpoint, "src-endpoint", "", "source HTTP(S) endpoint URL (default --endpoint)")
+	cmdFlags.StringVar(&f.SrcRegion, "src-region", "", "source AWS region (default --region)")
+	cmdFlags.StringVar(&f.SrcProfile, "src-profile", "", "source profile from config file (default --profile)")
+	cmdFlags.StringVar(&f.DstEndpoint, "dst-endpoint", "", "destination HTTP(S) endpoint URL (default --endpoint)")
+	cmdFlags.StringVar(&f.DstRegion, "dst-region", "", "destination AWS region (default --region)")
+	cmdFlags.StringVar(&f.DstProfile, "dst-profile", "", "destination profile from config file (default --profile)")
+}
+
+// Endpoints returns copies of the global flags for the source and destination
+// endpoints, with the source and destination profiles, endpoints, and regions
+// (if any) applied
+func (f *EndpointPairFlags) Endpoints(global *CosFlags, cmdFlags *pflag.FlagSet) (src *CosFlags, dst *CosFlags, err error) {
+	if src, err = global.WithProfile(f.SrcProfile, cmdFlags); err != nil {
+		return nil, nil, err
+	}
+	if dst, err = global.WithProfile(f.DstProfile, cmdFlags); err != nil {
+		return nil, nil, err
+	}
+	if f.SrcEndpoint != "" {
+		src.Endpoint = f.SrcEndpoint
+	}
+	if f.SrcRegion != "" {
+		src.Region = f.SrcRegion
+	}
+	if f.DstEndpoint != "" {
+		dst.Endpoint = f.DstEndpoint
+	}
+	if f.DstRegion != "" {
+		dst.Region = f.DstRegion
+	}
+	return src, dst, nil
+}
+
+func (f *EndpointPairFlags) Pretty() string {
+	return fmt.Sprintf("source: endpoint: '%v', region: '%v', profile: '%v'; destination: endpoint: '%v', region: '%v', profile: '%v'",
+		f.SrcEndpoint, f.SrcRegion, f.SrcProfile, f.DstEndpoint, f.DstRegion, f.DstProfile)
+}
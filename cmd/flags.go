@@ -1,44 +1,413 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"code.cloudfoundry.org/bytefmt"
 	"github.com/spf13/pflag"
 
+	"github.com/dmolesUC3/cos/internal/config"
 	"github.com/dmolesUC3/cos/internal/streaming"
 
 	"github.com/dmolesUC3/cos/internal/objects"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+
+	"github.com/dmolesUC3/cos/pkg"
 )
 
+// CosFlags holds the global flags shared by all commands
 type CosFlags struct {
+	ConfigFile string
+	Profile    string
+
 	Endpoint  string
 	Region    string
 	Verbose int
+	Timeout   time.Duration
+	OpTimeout time.Duration
+
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	RetryOn        []string
+
+	SwiftLargeObjects     string
+	SwiftLOThreshold      string
+	SwiftSegmentSize      string
+	SwiftSegmentContainer string
+
+	profile *config.Profile
+	// raw holds the flag values as parsed, before any profile was applied
+	raw *CosFlags
 }
 
 func (f *CosFlags) LogLevel() logging.LogLevel {
 	return logging.LogLevel(f.Verbose)
 }
 
-// Deprecated TODO: use rootCmd.PersistentFlags() instead
+// AddTo adds the global flags to the specified flag set (normally
+// rootCmd.PersistentFlags())
 func (f *CosFlags) AddTo(cmdFlags *pflag.FlagSet) {
 	cmdFlags.SortFlags = false
 
+	cmdFlags.StringVar(&f.ConfigFile, "config", "", "config file (default $"+config.ConfigFileEnvVar+" or ~/.config/cos/config.yaml)")
+	cmdFlags.StringVarP(&f.Profile, "profile", "p", "", "named profile from config file (default $"+config.ProfileEnvVar+" or default_profile)")
 	cmdFlags.StringVarP(&f.Endpoint, "endpoint", "e", "", "HTTP(S) endpoint URL (required)")
 	cmdFlags.StringVarP(&f.Region, "region", "r", "", "AWS region (if not in endpoint URL; default \""+objects.DefaultAwsRegion+"\")")
 	cmdFlags.CountVarP(&f.Verbose, "verbose", "v", "verbose output (-vv for maximum verbosity)")
+	cmdFlags.DurationVar(&f.Timeout, "timeout", 0, "overall timeout, e.g. \"30m\" (default no timeout)")
+	cmdFlags.DurationVar(&f.OpTimeout, "op-timeout", 0, "timeout for each individual storage operation, e.g. \"90s\" (default no timeout)")
+
+	var retryClasses []string
+	for _, c := range objects.AllRetryClasses {
+		retryClasses = append(retryClasses, string(c))
+	}
+	cmdFlags.IntVar(&f.MaxAttempts, "max-attempts", objects.DefaultMaxAttempts, "maximum attempts per request, including the first (1 for no retries)")
+	cmdFlags.DurationVar(&f.RetryBaseDelay, "retry-base-delay", objects.DefaultRetryBaseDelay, "base delay for exponential backoff between retries")
+	cmdFlags.DurationVar(&f.RetryMaxDelay, "retry-max-delay", objects.DefaultRetryMaxDelay, "maximum delay between retries")
+	cmdFlags.StringSliceVar(&f.RetryOn, "retry-on", retryClasses, "classes of failure to retry ("+strings.Join(retryClasses, ", ")+")")
+
+	cmdFlags.StringVar(&f.SwiftLargeObjects, "swift-large-objects", string(objects.StaticLargeObject), "Swift large object type (slo or dlo)")
+	cmdFlags.StringVar(&f.SwiftLOThreshold, "swift-lo-threshold", bytefmt.ByteSize(uint64(objects.DefaultLargeObjectThreshold)), "size above which Swift objects are created as large objects")
+	cmdFlags.StringVar(&f.SwiftSegmentSize, "swift-segment-size", bytefmt.ByteSize(uint64(objects.DefaultSegmentSize)), "Swift large object segment size")
+	cmdFlags.StringVar(&f.SwiftSegmentContainer, "swift-segment-container", "", "Swift large object segment container (default CONTAINER_segments)")
+}
+
+// ApplyProfile loads the config file and applies the selected profile (if
+// any), overriding the defaults but not any flags explicitly set in the
+// specified flag set.
+func (f *CosFlags) ApplyProfile(cmdFlags *pflag.FlagSet) error {
+	if f.raw == nil {
+		raw := *f
+		f.raw = &raw
+	}
+	cfg, err := config.Load(f.ConfigFile)
+	if err != nil {
+		return err
+	}
+	profileName := f.Profile
+	if profileName == "" {
+		profileName = os.Getenv(config.ProfileEnvVar)
+	}
+	if profileName == "" {
+		profileName = cfg.DefaultProfile
+	}
+	if profileName == "" {
+		return nil
+	}
+	p, err := cfg.Profile(profileName)
+	if err != nil {
+		return err
+	}
+
+	unset := func(name string) bool {
+		flag := cmdFlags.Lookup(name)
+		return flag != nil && !flag.Changed
+	}
+	if unset("endpoint") && p.Endpoint != "" {
+		f.Endpoint = p.Endpoint
+	}
+	if unset("region") && p.Region != "" {
+		f.Region = p.Region
+	}
+	if unset("timeout") && p.Timeout != 0 {
+		f.Timeout = p.Timeout
+	}
+	if unset("op-timeout") && p.OpTimeout != 0 {
+		f.OpTimeout = p.OpTimeout
+	}
+	if unset("max-attempts") && p.MaxAttempts != 0 {
+		f.MaxAttempts = p.MaxAttempts
+	}
+	if unset("retry-base-delay") && p.RetryBaseDelay != 0 {
+		f.RetryBaseDelay = p.RetryBaseDelay
+	}
+	if unset("retry-max-delay") && p.RetryMaxDelay != 0 {
+		f.RetryMaxDelay = p.RetryMaxDelay
+	}
+	if unset("retry-on") && len(p.RetryOn) > 0 {
+		f.RetryOn = p.RetryOn
+	}
+	if unset("swift-large-objects") && p.SwiftLargeObjects != "" {
+		f.SwiftLargeObjects = p.SwiftLargeObjects
+	}
+	if unset("swift-lo-threshold") && p.SwiftLOThreshold != "" {
+		f.SwiftLOThreshold = p.SwiftLOThreshold
+	}
+	if unset("swift-segment-size") && p.SwiftSegmentSize != "" {
+		f.SwiftSegmentSize = p.SwiftSegmentSize
+	}
+	if unset("swift-segment-container") && p.SwiftSegmentContainer != "" {
+		f.SwiftSegmentContainer = p.SwiftSegmentContainer
+	}
+	f.profile = p
+	return nil
+}
+
+// WithProfile returns a copy of the flags with the named profile (if any)
+// applied in place of the selected profile, for commands (such as cp) that
+// address more than one endpoint. The copy starts from the flags as parsed,
+// so that no settings from the selected profile carry over.
+func (f *CosFlags) WithProfile(name string, cmdFlags *pflag.FlagSet) (*CosFlags, error) {
+	copied := *f
+	if name == "" {
+		return &copied, nil
+	}
+	if f.raw != nil {
+		copied = *f.raw
+		copied.raw = f.raw
+	}
+	copied.Profile = name
+	if err := copied.ApplyProfile(cmdFlags); err != nil {
+		return nil, err
+	}
+	return &copied, nil
 }
 
+// TargetConfig returns the target configuration specified by the flags and
+// the selected profile (if any)
+func (f *CosFlags) TargetConfig() (objects.TargetConfig, error) {
+	targetConfig := objects.TargetConfig{Region: f.Region}
+	largeObjects, err := f.LargeObjectConfig()
+	if err != nil {
+		return targetConfig, err
+	}
+	targetConfig.LargeObjects = largeObjects
+	if f.profile == nil {
+		return targetConfig, nil
+	}
+	pc := f.profile.Credentials
+	source, err := objects.ParseCredentialsSource(pc.Source)
+	if err != nil {
+		return targetConfig, fmt.Errorf("profile %#v: %v", f.profile.Name, err)
+	}
+	targetConfig.Credentials = objects.Credentials{
+		Source:          source,
+		AWSProfile:      pc.AWSProfile,
+		AccessKeyID:     pc.AccessKeyID,
+		SecretAccessKey: pc.SecretAccessKey,
+		SwiftUser:       pc.User,
+		SwiftKey:        pc.Key,
+		SwiftUserEnvVar: pc.UserEnv,
+		SwiftKeyEnvVar:  pc.KeyEnv,
+		Keystone: objects.Keystone{
+			AuthVersion:   pc.AuthVersion,
+			UserDomain:    pc.UserDomain,
+			Project:       pc.Project,
+			ProjectID:     pc.ProjectID,
+			ProjectDomain: pc.ProjectDomain,
+			Interface:     pc.Interface,
+		},
+	}
+	return targetConfig, nil
+}
+
+// LargeObjectConfig returns the Swift large object configuration specified
+// by the flags
+func (f *CosFlags) LargeObjectConfig() (loConfig objects.LargeObjectConfig, err error) {
+	if loConfig.Type, err = objects.ParseLargeObjectType(f.SwiftLargeObjects); err != nil {
+		return loConfig, err
+	}
+	if f.SwiftLOThreshold != "" {
+		if loConfig.Threshold, err = parseSize(f.SwiftLOThreshold); err != nil {
+			return loConfig, fmt.Errorf("invalid large object threshold: %v", err)
+		}
+	}
+	if f.SwiftSegmentSize != "" {
+		if loConfig.SegmentSize, err = parseSize(f.SwiftSegmentSize); err != nil {
+			return loConfig, fmt.Errorf("invalid segment size: %v", err)
+		}
+	}
+	loConfig.SegmentContainer = f.SwiftSegmentContainer
+	return loConfig, nil
+}
+
+// RetryPolicy returns the retry policy specified by the retry flags
+func (f *CosFlags) RetryPolicy() (objects.RetryPolicy, error) {
+	policy := objects.RetryPolicy{
+		MaxAttempts: f.MaxAttempts,
+		BaseDelay:   f.RetryBaseDelay,
+		MaxDelay:    f.RetryMaxDelay,
+	}
+	for _, s := range f.RetryOn {
+		class, err := objects.ParseRetryClass(strings.TrimSpace(s))
+		if err != nil {
+			return policy, err
+		}
+		policy.RetryOn = append(policy.RetryOn, class)
+	}
+	return policy, nil
+}
+
+// Context returns a context that is cancelled on interrupt, or when the
+// overall timeout (if any) expires, and that carries the per-operation
+// timeout (if any) and the retry policy.
+func (f *CosFlags) Context() (context.Context, context.CancelFunc, error) {
+	policy, err := f.RetryPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx = objects.WithOperationTimeout(ctx, f.OpTimeout)
+	ctx = objects.WithRetryPolicy(ctx, policy)
+	if f.Timeout <= 0 {
+		return ctx, stop, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}, nil
+}
+
+// logRetries reports any retried requests recorded in the attempt log
+func logRetries(logger logging.Logger, attempts *objects.AttemptLog) {
+	retries := attempts.Retries()
+	if retries == 0 {
+		return
+	}
+	logger.Infof("%d of %d requests were retries\n", retries, len(attempts.Attempts()))
+}
+
+// Target returns the target for the specified bucket URL. If the bucket URL
+// is empty, the selected profile's default bucket is used; if it has no
+// scheme, the profile's protocol is assumed.
 func (f *CosFlags) Target(bucketStr string) (objects.Target, error) {
-	endpointURL, err := streaming.ValidAbsURL(f.Endpoint)
+	targetConfig, err := f.TargetConfig()
 	if err != nil {
 		return nil, err
 	}
+	return f.TargetWith(bucketStr, targetConfig)
+}
 
-	bucketURL, err := streaming.ValidAbsURL(bucketStr)
+// TargetWith returns the target for the specified bucket URL, as with Target,
+// but with the specified target configuration.
+func (f *CosFlags) TargetWith(bucketStr string, targetConfig objects.TargetConfig) (objects.Target, error) {
+	bucketURL, err := f.BucketURL(bucketStr)
 	if err != nil {
 		return nil, err
 	}
 
-	return objects.NewTarget(endpointURL, bucketURL, f.Region)
-}
\ No newline at end of file
+	endpointURL, err := f.EndpointURL(bucketURL.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return objects.NewTarget(endpointURL, bucketURL, targetConfig)
+}
+
+// Object returns the object for the specified object URL. If the object URL
+// has no scheme, it is treated as a key in the selected profile's default
+// bucket.
+func (f *CosFlags) Object(objURLStr string) (objects.Object, error) {
+	targetConfig, err := f.TargetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return f.ObjectWith(objURLStr, targetConfig)
+}
+
+// ObjectWith returns the object for the specified object URL, as with Object,
+// but with the specified target configuration.
+func (f *CosFlags) ObjectWith(objURLStr string, targetConfig objects.TargetConfig) (objects.Object, error) {
+	if f.profile != nil && f.profile.Bucket != "" && !strings.Contains(objURLStr, "://") {
+		objURLStr = fmt.Sprintf("%v://%v/%v", f.protocol(), f.profile.Bucket, strings.TrimPrefix(objURLStr, "/"))
+	}
+	objURL, err := streaming.ValidAbsURL(objURLStr)
+	if err != nil {
+		return nil, err
+	}
+
+	endpointURL, err := f.EndpointURL(objURL.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return objects.NewObject(objURL, endpointURL, targetConfig)
+}
+
+// EndpointURL returns the endpoint URL for the specified protocol. If no
+// endpoint is specified for a Swift target, the Keystone auth URL in
+// $OS_AUTH_URL (if set) is used.
+func (f *CosFlags) EndpointURL(protocol string) (*url.URL, error) {
+	endpoint := f.Endpoint
+	if endpoint == "" && protocol == "swift" {
+		endpoint = os.Getenv("OS_AUTH_URL")
+	}
+	return streaming.ValidAbsURL(endpoint)
+}
+
+// BucketURL returns the bucket URL for the specified string, applying the
+// selected profile's default bucket and protocol as needed.
+func (f *CosFlags) BucketURL(bucketStr string) (*url.URL, error) {
+	if bucketStr == "" {
+		if f.profile == nil || f.profile.Bucket == "" {
+			return nil, errors.New("no bucket URL specified, and no default bucket in profile")
+		}
+		bucketStr = f.profile.Bucket
+	}
+	if f.profile != nil && !strings.Contains(bucketStr, "://") {
+		bucketStr = fmt.Sprintf("%v://%v", f.protocol(), bucketStr)
+	}
+	return streaming.ValidAbsURL(bucketStr)
+}
+
+func (f *CosFlags) protocol() string {
+	if f.profile != nil && f.profile.Protocol != "" {
+		return f.profile.Protocol
+	}
+	return "s3"
+}
+
+// parseSize parses the specified size, given either as an exact number of
+// bytes or as a human-readable quantity such as "5K" or "3.5M"
+func parseSize(sizeStr string) (int64, error) {
+	sizeIsNumeric := strings.IndexFunc(sizeStr, unicode.IsLetter) == -1
+	if sizeIsNumeric {
+		return strconv.ParseInt(sizeStr, 10, 64)
+	}
+
+	bytes, err := bytefmt.ToBytes(sizeStr)
+	if err == nil && bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("specified size %d bytes exceeds maximum %d", bytes, math.MaxInt64)
+	}
+	return int64(bytes), err
+}
+
+// parseByteRange parses the specified byte range, given as "START-END" (with
+// END inclusive) or "START-" (to the end of the object), where START and END
+// are sizes as for parseSize
+func parseByteRange(rangeStr string) (*pkg.ByteRange, error) {
+	i := strings.Index(rangeStr, "-")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid range %#v: expected START-END or START-", rangeStr)
+	}
+	start, err := parseSize(rangeStr[:i])
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("invalid range %#v: invalid start %#v", rangeStr, rangeStr[:i])
+	}
+	r := &pkg.ByteRange{Start: start, End: -1}
+	if endStr := rangeStr[i+1:]; endStr != "" {
+		if r.End, err = parseSize(endStr); err != nil || r.End < start {
+			return nil, fmt.Errorf("invalid range %#v: invalid end %#v", rangeStr, endStr)
+		}
+	}
+	return r, nil
+}
+
+// firstArg returns the first argument, or the empty string if there are none
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageGet = "get <OBJECT-URL> [FILE]"
+
+	shortDescGet = "get: download an object to a local file"
+
+	longDescGet = shortDescGet + `
+
+        Downloads an object from cloud object storage to a local file (by default,
+        a file in the current directory named for the last component of the object
+        key), computing the specified digests in the same pass.
+
+        When the download is complete, it is verified against the expected digest
+        (--expected; MD5 or SHA-256, determined by its length), or, if no expected
+        digest is given, against the MD5 digest recorded by the server, where
+        available. (The server does not record MD5 digests for S3 multipart uploads,
+        S3 objects encrypted with SSE-KMS or SSE-C, or Swift large objects.) If
+        verification fails, the file is removed.
+
+        If the file already exists and is shorter than the object, the download
+        resumes from the end of the file, unless --overwrite is specified. Since
+        an existing file may not be a partial download of the object, it is only
+        resumed if the result can be verified, or if --resume is specified;
+        otherwise get exits with an error.
+    `
+
+	exampleGet = `
+        cos get s3://www.dmoles.net/images/fa/archive.svg --endpoint https://s3.us-west-2.amazonaws.com/
+        cos get s3://mrt-test/inusitatum.png /tmp/inusitatum.png -e http://127.0.0.1:9000/ -a md5,sha256 -x cadf871cd4135212419f488f42c62482
+    `
+)
+
+// ------------------------------------------------------------
+// getFlags type
+
+type getFlags struct {
+	*CosFlags
+	EncryptionFlags
+	ObjectVersionFlags
+
+	Algorithms []string
+	Expected   []byte
+	Overwrite  bool
+	Resume     bool
+	Receipt    string
+}
+
+func (f getFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		algorithms: %v
+		expected: %x
+		overwrite: %v
+		resume:   %v
+		receipt:  '%v'
+		timeout:   %v
+		op timeout: %v
+		%v
+		%v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Algorithms, f.Expected, f.Overwrite, f.Resume, f.Receipt, f.Timeout, f.OpTimeout, f.EncryptionFlags.Pretty(), f.ObjectVersionFlags.Pretty())
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func get(objURLStr string, filePath string, f getFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("object URL: %v\n", objURLStr)
+
+	obj, err := objectWithEncryption(f.CosFlags, &f.EncryptionFlags, objURLStr)
+	if err != nil {
+		return err
+	}
+	if obj, err = f.ObjectVersionFlags.Apply(obj); err != nil {
+		return err
+	}
+	if filePath == "" {
+		filePath = path.Base(strings.TrimSuffix(objURLStr, "/"))
+	}
+	logger.Tracef("file: %v\n", filePath)
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	g := pkg.Get{
+		Object:     obj,
+		Path:       filePath,
+		Algorithms: f.Algorithms,
+		Expected:   f.Expected,
+		Overwrite:  f.Overwrite,
+		Resume:     f.Resume,
+	}
+	receipt, err := g.DownloadAndVerify(ctx)
+	if err != nil {
+		return err
+	}
+	if f.Receipt != "" {
+		if err := receipt.WriteTo(f.Receipt); err != nil {
+			return err
+		}
+	}
+	if f.Receipt != "-" {
+		var algorithms []string
+		for alg := range receipt.Digests {
+			algorithms = append(algorithms, alg)
+		}
+		sort.Strings(algorithms)
+		for _, alg := range algorithms {
+			fmt.Printf("%v (%v) = %v\n", strings.ToUpper(alg), receipt.Destination, receipt.Digests[alg])
+		}
+		logger.Detailf("%v downloaded to %v (verification: %v)\n", logging.FormatBytes(receipt.Size), receipt.Destination, receipt.Verification)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := getFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageGet,
+		Short:   shortDescGet,
+		Long:    logging.Untabify(longDescGet, ""),
+		Args:    cobra.RangeArgs(1, 2),
+		Example: logging.Untabify(exampleGet, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filePath := ""
+			if len(args) > 1 {
+				filePath = args[1]
+			}
+			return get(args[0], filePath, flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringSliceVarP(&flags.Algorithms, "algorithm", "a", []string{"sha256"}, "digest algorithm(s) (md5, sha256)")
+	cmdFlags.BytesHexVarP(&flags.Expected, "expected", "x", nil, "expected MD5 or SHA-256 digest (exit with error if not matched)")
+	cmdFlags.BoolVar(&flags.Overwrite, "overwrite", false, "overwrite an existing file rather than resuming the download")
+	cmdFlags.BoolVar(&flags.Resume, "resume", false, "resume an existing file even if the download can't be verified")
+	cmdFlags.StringVar(&flags.Receipt, "receipt", "", "write a JSON receipt to this file (\"-\" for standard output)")
+	flags.EncryptionFlags.AddTo(cmdFlags)
+	flags.ObjectVersionFlags.AddTo(cmdFlags)
+
+	rootCmd.AddCommand(cmd)
+}
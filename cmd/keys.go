@@ -15,7 +15,7 @@ import (
 )
 
 const (
-	usageKeys = "keys <BUCKET-URL>"
+	usageKeys = "keys [BUCKET-URL]"
 
 	shortDescKeys = "keys: test the keys supported by an object storage endpoint"
 
@@ -78,22 +78,22 @@ func availableKeyLists() (*string, error) {
 }
 
 func init() {
-	f := keysFlags{}
+	f := keysFlags{CosFlags: rootFlags}
 	cmd := &cobra.Command{
 		Use:           usageKeys,
 		Short:         shortDescKeys,
 		Long:          longDescription(),
-		Args:          cobra.ExactArgs(1),
+		Args:          cobra.MaximumNArgs(1),
 		Example:       logging.Untabify(exampleKeys, "  "),
 		Run: func(cmd *cobra.Command, args []string) {
-			err := checkKeys(args[0], f)
+			err := checkKeys(firstArg(args), f)
 			if err != nil {
 				_, _ = fmt.Fprintln(os.Stderr, err)
 			}
 		},
 	}
 	cmdFlags := cmd.Flags()
-	f.AddTo(cmdFlags)
+	cmdFlags.SortFlags = false
 
 	cmdFlags.BoolVar(&f.Raw, "raw", false, "write keys in raw (unquoted) format")
 	cmdFlags.StringVarP(&f.OkFile, "ok", "o", "", "write successful (\"OK\") keys to specified file")
@@ -125,8 +125,14 @@ func checkKeys(bucketStr string, f keysFlags) error {
 		return err
 	}
 
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
 	k := pkg.NewKeys(target, keyList)
-	failures, err := k.CheckAll(okOut, badOut, f.Raw)
+	failures, err := k.CheckAll(ctx, okOut, badOut, f.Raw)
 	if err != nil {
 		return err
 	}
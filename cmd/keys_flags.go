@@ -11,7 +11,7 @@ import (
 )
 
 type keysFlags struct {
-	CosFlags
+	*CosFlags
 
 	// TODO: more output formats other than --raw and quoted-Go-literal, e.g. --ascii
 	Raw      bool
@@ -32,6 +32,8 @@ func (f *keysFlags) Pretty() string {
 		sample:     %d
 		region:     %#v
 		endpoint:   %#v
+		timeout:    %v
+		op timeout: %v
 		log level:  %v
 	`
 	format = logging.Untabify(format, "  ")
@@ -47,6 +49,8 @@ func (f *keysFlags) Pretty() string {
 
 		f.Region,
 		f.Endpoint,
+		f.Timeout,
+		f.OpTimeout,
 		f.LogLevel(),
 	)
 }
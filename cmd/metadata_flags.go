@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+// MetadataFlags holds flags setting the metadata of objects created, shared
+// by commands that create objects from user data
+type MetadataFlags struct {
+	ContentType     string
+	ContentEncoding string
+	CacheControl    string
+	Meta            []string
+	Tags            []string
+}
+
+// AddTo adds the metadata flags to the specified flag set
+func (f *MetadataFlags) AddTo(cmdFlags *pflag.FlagSet) {
+	cmdFlags.StringVar(&f.ContentType, "content-type", "", "Content-Type of the object")
+	cmdFlags.StringVar(&f.ContentEncoding, "content-encoding", "", "Content-Encoding of the object")
+	cmdFlags.StringVar(&f.CacheControl, "cache-control", "", "Cache-Control header of the object")
+	cmdFlags.StringArrayVar(&f.Meta, "meta", nil, "user metadata, as KEY=VALUE (may be repeated)")
+	cmdFlags.StringArrayVar(&f.Tags, "tag", nil, "object tag, as KEY=VALUE (may be repeated; S3 only)")
+}
+
+// Metadata returns the metadata specified by the flags, or nil if none was
+// specified
+func (f *MetadataFlags) Metadata() (*objects.Metadata, error) {
+	if f.ContentType == "" && f.ContentEncoding == "" && f.CacheControl == "" && len(f.Meta) == 0 && len(f.Tags) == 0 {
+		return nil, nil
+	}
+	user, err := parseKeyValues("--meta", f.Meta)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := parseKeyValues("--tag", f.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &objects.Metadata{
+		ContentType:     f.ContentType,
+		ContentEncoding: f.ContentEncoding,
+		CacheControl:    f.CacheControl,
+		User:            user,
+		Tags:            tags,
+	}, nil
+}
+
+func (f *MetadataFlags) Pretty() string {
+	return fmt.Sprintf("content type: %#v, content encoding: %#v, cache control: %#v, meta: %v, tags: %v",
+		f.ContentType, f.ContentEncoding, f.CacheControl, f.Meta, f.Tags)
+}
+
+// parseKeyValues parses KEY=VALUE flag values into a map
+func parseKeyValues(flagName string, keyValues []string) (map[string]string, error) {
+	if len(keyValues) == 0 {
+		return nil, nil
+	}
+	values := map[string]string{}
+	for _, kv := range keyValues {
+		i := strings.Index(kv, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid %v: expected KEY=VALUE, got %#v", flagName, kv)
+		}
+		values[kv[:i]] = kv[i+1:]
+	}
+	return values, nil
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/config"
+	"github.com/dmolesUC3/cos/internal/logging"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageMonitor = "monitor"
+
+	shortDescMonitor = "monitor: run scheduled storage probes and serve the results as Prometheus metrics"
+
+	longDescMonitor = shortDescMonitor + `
+
+        Runs crvd and check probes against one or more buckets and objects on a
+        schedule, and serves the results over HTTP, for use in a long-running
+        deployment (e.g. in Kubernetes):
+
+            /metrics   Prometheus metrics (probe runs and failures, probe and
+                       storage request latency histograms, bytes transferred,
+                       and last-success timestamps)
+            /healthz   probe status, as JSON, with status 503 if any probe has
+                       not succeeded within --unhealthy-after intervals
+            /livez     always "ok", while the monitor is running
+
+        Probes can be given on the command line with --crvd (a bucket URL, for
+        a create-retrieve-verify-delete probe) and --check (an object URL, for
+        a fixity check probe), using the global endpoint, region, and profile
+        flags, or listed under "probes" in the config file (see README.md), each
+        with its own profile, interval, and settings.
+
+        Each probe runs immediately on startup, and then once per interval. A
+        run that takes longer than the interval is considered to have failed.
+    `
+
+	exampleMonitor = `
+        cos monitor --listen :9100 --crvd s3://www.dmoles.net/ --endpoint https://s3.us-west-2.amazonaws.com/
+        cos monitor --crvd swift://distrib.stage.9001.__c5e/ --check swift://distrib.stage.9001.__c5e/ark/42 -e http://cloud.sdsc.edu/auth/v1.0 --interval 1m
+        cos monitor --config /etc/cos/config.yaml
+    `
+)
+
+// ------------------------------------------------------------
+// monitorFlags type
+
+type monitorFlags struct {
+	*CosFlags
+
+	Listen         string
+	Crvd           []string
+	Check          []string
+	Interval       time.Duration
+	Size           string
+	Algorithm      string
+	UnhealthyAfter int
+}
+
+func (f monitorFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		listen:   '%v'
+		crvd:      %v
+		check:     %v
+		interval:  %v
+		size:      %v
+		algorithm: %v
+		unhealthy after: %d
+		timeout:   %v
+		op timeout: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Listen, f.Crvd, f.Check,
+		f.Interval, f.Size, f.Algorithm, f.UnhealthyAfter, f.Timeout, f.OpTimeout)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func monitor(f monitorFlags, cmdFlags *pflag.FlagSet) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	probes, err := monitorProbes(f, cmdFlags)
+	if err != nil {
+		return err
+	}
+	if len(probes) == 0 {
+		return errors.New("no probes specified (use --crvd, --check, or the probes section of the config file)")
+	}
+	m, err := pkg.NewMonitor(probes)
+	if err != nil {
+		return err
+	}
+	if f.UnhealthyAfter < 1 {
+		return fmt.Errorf("invalid --unhealthy-after: %d", f.UnhealthyAfter)
+	}
+	m.UnhealthyAfter = f.UnhealthyAfter
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	server := &http.Server{Addr: f.Listen, Handler: m.Handler()}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	for _, p := range probes {
+		logger.Infof("Probe %v: %v every %v\n", p.Name, probeDescription(p), p.Interval)
+	}
+	logger.Infof("Serving metrics at %v/metrics\n", f.Listen)
+
+	monitorDone := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(monitorDone)
+	}()
+
+	select {
+	case err = <-serverErr:
+		cancel()
+	case <-ctx.Done():
+	}
+	<-monitorDone
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	_ = server.Shutdown(shutdownCtx)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// monitorProbes returns the probes specified on the command line and in the
+// config file
+func monitorProbes(f monitorFlags, cmdFlags *pflag.FlagSet) ([]*pkg.Probe, error) {
+	size, err := parseSize(f.Size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size %#v: %v", f.Size, err)
+	}
+
+	var probes []*pkg.Probe
+	for i, bucketStr := range f.Crvd {
+		target, err := f.Target(bucketStr)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, &pkg.Probe{
+			Name: fmt.Sprintf("crvd-%d", i+1), Type: pkg.ProbeCrvd, Target: target, Size: size, Interval: f.Interval,
+		})
+	}
+	for i, objURLStr := range f.Check {
+		obj, err := f.Object(objURLStr)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, &pkg.Probe{
+			Name: fmt.Sprintf("check-%d", i+1), Type: pkg.ProbeCheck, Object: obj, Algorithm: f.Algorithm, Interval: f.Interval,
+		})
+	}
+
+	cfg, err := config.Load(f.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, pc := range cfg.Probes {
+		p, err := configProbe(f, pc, cmdFlags)
+		if err != nil {
+			return nil, fmt.Errorf("probe %#v: %v", pc.Name, err)
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
+
+// configProbe returns the probe specified in the config file, with the
+// command-line interval, size, and algorithm as defaults
+func configProbe(f monitorFlags, pc *config.Probe, cmdFlags *pflag.FlagSet) (*pkg.Probe, error) {
+	pf, err := f.WithProfile(pc.Profile, cmdFlags)
+	if err != nil {
+		return nil, err
+	}
+	p := &pkg.Probe{Name: pc.Name, Type: pc.Type, Interval: pc.Interval, Algorithm: pc.Algorithm}
+	if p.Interval == 0 {
+		p.Interval = f.Interval
+	}
+	if p.Algorithm == "" {
+		p.Algorithm = f.Algorithm
+	}
+	sizeStr := pc.Size
+	if sizeStr == "" {
+		sizeStr = f.Size
+	}
+	if p.Size, err = parseSize(sizeStr); err != nil {
+		return nil, fmt.Errorf("invalid size %#v: %v", sizeStr, err)
+	}
+	if pc.Expected != "" {
+		if p.Expected, err = hex.DecodeString(pc.Expected); err != nil {
+			return nil, fmt.Errorf("invalid expected digest %#v: %v", pc.Expected, err)
+		}
+	}
+	switch pc.Type {
+	case pkg.ProbeCrvd:
+		p.Target, err = pf.Target(pc.URL)
+	case pkg.ProbeCheck:
+		p.Object, err = pf.Object(pc.URL)
+	}
+	return p, err
+}
+
+func probeDescription(p *pkg.Probe) string {
+	if p.Type == pkg.ProbeCheck {
+		return fmt.Sprintf("check %v", p.Object.Pretty())
+	}
+	return fmt.Sprintf("crvd %v (%v)", p.Target.Pretty(), logging.FormatBytes(p.Size))
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := monitorFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageMonitor,
+		Short:   shortDescMonitor,
+		Long:    logging.Untabify(longDescMonitor, ""),
+		Args:    cobra.NoArgs,
+		Example: logging.Untabify(exampleMonitor, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return monitor(flags, cmd.Flags())
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringVar(&flags.Listen, "listen", ":9100", "address on which to serve metrics and health endpoints")
+	cmdFlags.StringArrayVar(&flags.Crvd, "crvd", nil, "bucket URL for a crvd probe (may be repeated)")
+	cmdFlags.StringArrayVar(&flags.Check, "check", nil, "object URL for a check probe (may be repeated)")
+	cmdFlags.DurationVarP(&flags.Interval, "interval", "i", pkg.DefaultProbeInterval, "time between probe runs")
+	cmdFlags.StringVarP(&flags.Size, "size", "s", "64K", "size of objects created by crvd probes")
+	cmdFlags.StringVarP(&flags.Algorithm, "algorithm", "a", "sha256", "digest algorithm for check probes (md5 or sha256)")
+	cmdFlags.IntVar(&flags.UnhealthyAfter, "unhealthy-after", pkg.DefaultUnhealthyAfter, "intervals without a successful run after which a probe is unhealthy")
+
+	rootCmd.AddCommand(cmd)
+}
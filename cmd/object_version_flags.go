@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+// ObjectVersionFlags holds flags addressing a specific version of an object,
+// shared by commands that read objects
+type ObjectVersionFlags struct {
+	VersionID string
+}
+
+// AddTo adds the version flags to the specified flag set
+func (f *ObjectVersionFlags) AddTo(cmdFlags *pflag.FlagSet) {
+	cmdFlags.StringVar(&f.VersionID, "version-id", "", "read this version of the object, in a versioned bucket (S3 only; default the latest version)")
+}
+
+// Apply returns the version of the object specified by the flags, or the
+// object itself if no version was specified
+func (f *ObjectVersionFlags) Apply(obj objects.Object) (objects.Object, error) {
+	if f.VersionID == "" {
+		return obj, nil
+	}
+	versioned, ok := obj.(objects.VersionedObject)
+	if !ok {
+		return nil, fmt.Errorf("%v does not support versions", obj.Pretty())
+	}
+	return versioned.Version(f.VersionID), nil
+}
+
+func (f *ObjectVersionFlags) Pretty() string {
+	return fmt.Sprintf("version id: %#v", f.VersionID)
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usagePut = "put <FILE> <OBJECT-URL>"
+
+	shortDescPut = "put: upload a local file and verify it"
+
+	longDescPut = shortDescPut + `
+
+        Uploads a local file to cloud object storage, computing its SHA-256 and
+        MD5 digests during the upload, and then verifies the uploaded object.
+
+        By default (--verify download), the object is downloaded again and its
+        SHA-256 digest compared with that of the file. With --verify etag, the
+        ETags reported by the server are instead compared with the MD5 digests
+        computed during the upload (for S3, of each part as well as of the whole
+        object; for Swift, of objects below the large object threshold only).
+
+        With --receipt, a JSON receipt recording the object URL, size, digests,
+        verification mode, and elapsed time is written to the specified file
+        (or, with --receipt -, to standard output).
+
+        The object's Content-Type, Content-Encoding, and Cache-Control headers,
+        user metadata, and (for S3) tags can be set with --content-type,
+        --content-encoding, --cache-control, --meta, and --tag. Use "cos stat"
+        to see the metadata of an object.
+    `
+
+	examplePut = `
+        cos put archive.zip s3://www.dmoles.net/archive.zip --endpoint https://s3.us-west-2.amazonaws.com/
+        cos put archive.zip swift://distrib.stage.9001.__c5e/archive.zip -e http://cloud.sdsc.edu/auth/v1.0 --receipt archive.receipt.json
+        cos put report.csv.gz s3://mrt-test/report.csv.gz -e http://127.0.0.1:9000/ --content-type text/csv --content-encoding gzip --meta owner=dmoles --tag retention=7y
+    `
+)
+
+// ------------------------------------------------------------
+// putFlags type
+
+type putFlags struct {
+	*CosFlags
+	UploadFlags
+	MetadataFlags
+	EncryptionFlags
+
+	Verify  string
+	Receipt string
+}
+
+func (f putFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		verify:   '%v'
+		receipt:  '%v'
+		timeout:   %v
+		op timeout: %v
+		%v
+		%v
+		%v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Verify, f.Receipt, f.Timeout, f.OpTimeout, f.UploadFlags.Pretty(), f.MetadataFlags.Pretty(), f.EncryptionFlags.Pretty())
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func put(path string, objURLStr string, f putFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("file: %v\n", path)
+	logger.Tracef("object URL: %v\n", objURLStr)
+
+	if err := pkg.ValidVerifyMode(f.Verify); err != nil {
+		return err
+	}
+	metadata, err := f.MetadataFlags.Metadata()
+	if err != nil {
+		return err
+	}
+
+	targetConfig, err := f.TargetConfig()
+	if err != nil {
+		return err
+	}
+	if targetConfig.Multipart, err = f.MultipartConfig(); err != nil {
+		return err
+	}
+	if targetConfig.Encryption, err = f.EncryptionConfig(); err != nil {
+		return err
+	}
+	if f.Verify == pkg.VerifyETag {
+		if !targetConfig.Encryption.ETagIsMD5() {
+			return fmt.Errorf("--verify %v is not supported with --sse %v, as the ETags are not MD5 digests", pkg.VerifyETag, targetConfig.Encryption.Mode)
+		}
+		targetConfig.Multipart.VerifyETags = true
+	}
+	obj, err := f.ObjectWith(objURLStr, targetConfig)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	p := pkg.Put{Object: obj, Path: path, Verify: f.Verify, Metadata: metadata}
+	receipt, err := p.UploadAndVerify(ctx)
+	if err != nil {
+		return err
+	}
+	if f.Receipt != "" {
+		if err := receipt.WriteTo(f.Receipt); err != nil {
+			return err
+		}
+	}
+	if f.Receipt != "-" {
+		fmt.Printf("%v uploaded to %v and verified (%v; sha256 %v)\n",
+			logging.FormatBytes(receipt.Size), receipt.Object, receipt.Verification, receipt.Digests["sha256"])
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := putFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usagePut,
+		Short:   shortDescPut,
+		Long:    logging.Untabify(longDescPut, ""),
+		Args:    cobra.ExactArgs(2),
+		Example: logging.Untabify(examplePut, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return put(args[0], args[1], flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringVar(&flags.Verify, "verify", pkg.VerifyDownload, "verification mode ("+strings.Join(pkg.VerifyModes, ", ")+")")
+	cmdFlags.StringVar(&flags.Receipt, "receipt", "", "write a JSON receipt to this file (\"-\" for standard output)")
+	flags.UploadFlags.AddTo(cmdFlags, true)
+	flags.MetadataFlags.AddTo(cmdFlags)
+	flags.EncryptionFlags.AddTo(cmdFlags)
+
+	rootCmd.AddCommand(cmd)
+}
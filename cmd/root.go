@@ -21,7 +21,15 @@ const (
         credentials.
 
         Note that for OpenStack Swift, the API username and key must be specified
-        with the ` + objects.SwiftUserEnvVar + ` and ` + objects.SwiftKeyEnvVar + ` environment variables.
+        with the ` + objects.SwiftUserEnvVar + ` and ` + objects.SwiftKeyEnvVar + ` environment variables (or
+        OS_USERNAME and OS_PASSWORD). For Keystone v2/v3 authentication, the
+        project, domains, region, and endpoint interface are read from the standard
+        OS_* environment variables, and the endpoint defaults to OS_AUTH_URL.
+
+        Endpoints, regions, credentials sources, default buckets, and timeout and
+        retry options can also be stored as named profiles in a YAML config file
+        (by default ~/.config/cos/config.yaml) and selected with --profile. Flags
+        given on the command line override profile values.
     `
 )
 
@@ -29,6 +37,16 @@ var rootCmd = &cobra.Command{
 	Use:   "cos",
 	Short: shortDescRoot,
 	Long:  logging.Untabify(longDescRoot, ""),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return rootFlags.ApplyProfile(cmd.Flags())
+	},
+}
+
+// rootFlags holds the global flags, shared by all commands
+var rootFlags = &CosFlags{}
+
+func init() {
+	rootFlags.AddTo(rootCmd.PersistentFlags())
 }
 
 func Execute() error {
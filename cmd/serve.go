@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageServe = "serve"
+
+	shortDescServe = "serve: run check, crvd, and keys jobs submitted over an HTTP API"
+
+	longDescServe = shortDescServe + `
+
+        Serves a REST API for submitting check, crvd, and keys jobs, which are
+        run on a pool of --jobs workers:
+
+            POST   /jobs                 submit a job, returning its ID
+            GET    /jobs                 list all jobs
+            GET    /jobs/{id}            get a job's status and result
+            DELETE /jobs/{id}            cancel a job
+            GET    /jobs/{id}/progress   stream the job's status and progress,
+                                         as newline-delimited JSON, until it
+                                         finishes
+
+        Jobs are submitted as JSON objects giving the job type ("check",
+        "crvd", or "keys"), the object URL (check) or bucket URL (crvd, keys),
+        and, optionally, a profile, endpoint, and region overriding the global
+        flags, along with job-specific parameters (see README.md).
+
+        The state of each job is saved as a JSON file in the state directory.
+        Jobs queued or running when the server stops are run again when it
+        restarts.
+    `
+
+	exampleServe = `
+        cos serve --listen :8080 --endpoint https://s3.us-west-2.amazonaws.com/
+        cos serve --profile sdsc-stage --state-dir /var/lib/cos/jobs --jobs 8
+    `
+)
+
+// ------------------------------------------------------------
+// serveFlags type
+
+type serveFlags struct {
+	*CosFlags
+
+	Listen   string
+	StateDir string
+	Jobs     int
+}
+
+func (f serveFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		listen:   '%v'
+		state dir: '%v'
+		jobs:      %d
+		timeout:   %v
+		op timeout: %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Listen, f.StateDir, f.Jobs, f.Timeout, f.OpTimeout)
+}
+
+// ------------------------------------------------------------
+// jobResolver type
+
+// jobResolver resolves job request URLs using the global flags, with the
+// request's profile, endpoint, and region (if any) applied
+type jobResolver struct {
+	flags    *CosFlags
+	cmdFlags *pflag.FlagSet
+}
+
+func (r jobResolver) Target(req *pkg.JobRequest) (objects.Target, error) {
+	f, err := r.flagsFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return f.Target(req.URL)
+}
+
+func (r jobResolver) Object(req *pkg.JobRequest) (objects.Object, error) {
+	f, err := r.flagsFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return f.Object(req.URL)
+}
+
+func (r jobResolver) flagsFor(req *pkg.JobRequest) (*CosFlags, error) {
+	f, err := r.flags.WithProfile(req.Profile, r.cmdFlags)
+	if err != nil {
+		return nil, err
+	}
+	if req.Endpoint != "" {
+		f.Endpoint = req.Endpoint
+	}
+	if req.Region != "" {
+		f.Region = req.Region
+	}
+	return f, nil
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func serve(f serveFlags, cmdFlags *pflag.FlagSet) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+
+	stateDir := f.StateDir
+	if stateDir == "" {
+		var err error
+		if stateDir, err = defaultStatePath("jobs"); err != nil {
+			return err
+		}
+	}
+	server, err := pkg.NewJobServer(stateDir, f.Jobs, jobResolver{flags: f.CosFlags, cmdFlags: cmdFlags})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	httpServer := &http.Server{Addr: f.Listen, Handler: server.Handler()}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- httpServer.ListenAndServe()
+	}()
+	logger.Infof("Serving job API at %v (state directory: %v, %d workers)\n", f.Listen, stateDir, f.Jobs)
+
+	workersDone := make(chan struct{})
+	go func() {
+		server.Run(ctx)
+		close(workersDone)
+	}()
+
+	select {
+	case err = <-serverErr:
+		cancel()
+	case <-ctx.Done():
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	_ = httpServer.Shutdown(shutdownCtx)
+	<-workersDone
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// defaultStatePath returns the named file or directory under cos in
+// $XDG_STATE_HOME, if set, or else in ~/.local/state
+func defaultStatePath(name string) (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "cos", name), nil
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := serveFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageServe,
+		Short:   shortDescServe,
+		Long:    logging.Untabify(longDescServe, ""),
+		Args:    cobra.NoArgs,
+		Example: logging.Untabify(exampleServe, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(flags, cmd.Flags())
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringVar(&flags.Listen, "listen", ":8080", "address on which to serve the job API")
+	cmdFlags.StringVar(&flags.StateDir, "state-dir", "", "directory in which to save job state (default $XDG_STATE_HOME/cos/jobs or ~/.local/state/cos/jobs)")
+	cmdFlags.IntVarP(&flags.Jobs, "jobs", "j", pkg.DefaultJobWorkers, "number of jobs to run at once")
+
+	rootCmd.AddCommand(cmd)
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageSoak = "soak [BUCKET-URL]"
+
+	shortDescSoak = "soak: repeatedly create, retrieve, verify, and delete objects over a long period"
+
+	longDescSoak = shortDescSoak + `
+
+        Runs create-retrieve-verify-delete cycles (as for crvd) continuously,
+        with the specified number of concurrent workers, using objects of random
+        sizes between --size-min and --size-max, with random keys under the
+        specified prefix. Runs for the specified duration, or, if no duration is
+        given, until interrupted.
+
+        At the end of each reporting interval, the number of successful and
+        failed cycles in the interval, the running totals, the latency
+        percentiles (in milliseconds), and a latency histogram are written to
+        standard output; with --json, each report is written as a single line
+        of JSON. A final report covering the whole run is written when the soak
+        test ends.
+
+        The soak test stops early, with an error, if the total number of
+        failures reaches --max-failures, or if the proportion of failed cycles
+        in any one interval reaches --max-failure-rate.
+    `
+
+	exampleSoak = `
+        cos soak s3://www.dmoles.net/ --endpoint https://s3.us-west-2.amazonaws.com/ --duration 12h --interval 5m
+        cos soak swift://distrib.stage.9001.__c5e/ -e http://cloud.sdsc.edu/auth/v1.0 --size-max 1G --jobs 8 --max-failure-rate 0.1 --json
+    `
+)
+
+// ------------------------------------------------------------
+// soakFlags type
+
+type soakFlags struct {
+	*CosFlags
+	UploadFlags
+
+	SizeMin        string
+	SizeMax        string
+	Jobs           int
+	Duration       time.Duration
+	Interval       time.Duration
+	MaxFailures    int
+	MaxFailureRate float64
+	Prefix         string
+	Seed           int64
+	JSON           bool
+}
+
+func (f soakFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		size min:  %v
+		size max:  %v
+		jobs:      %d
+		duration:  %v
+		interval:  %v
+		max failures: %d
+		max failure rate: %v
+		prefix:   '%v'
+		seed:      %d
+		json:      %v
+		timeout:   %v
+		op timeout: %v
+		%v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.SizeMin, f.SizeMax, f.Jobs, f.Duration, f.Interval,
+		f.MaxFailures, f.MaxFailureRate, f.Prefix, f.Seed, f.JSON, f.Timeout, f.OpTimeout, f.UploadFlags.Pretty())
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func soak(bucketStr string, f soakFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("bucket URL: %v\n", bucketStr)
+
+	s := pkg.Soak{
+		Concurrency:    f.Jobs,
+		Duration:       f.Duration,
+		Interval:       f.Interval,
+		MaxFailures:    f.MaxFailures,
+		MaxFailureRate: f.MaxFailureRate,
+		Prefix:         f.Prefix,
+		RandomSeed:     f.Seed,
+	}
+	if s.RandomSeed == 0 {
+		s.RandomSeed = time.Now().UnixNano()
+	}
+	var err error
+	if s.SizeMin, err = parseSize(f.SizeMin); err != nil {
+		return fmt.Errorf("invalid minimum size %#v: %v", f.SizeMin, err)
+	}
+	if s.SizeMax, err = parseSize(f.SizeMax); err != nil {
+		return fmt.Errorf("invalid maximum size %#v: %v", f.SizeMax, err)
+	}
+
+	targetConfig, err := f.TargetConfig()
+	if err != nil {
+		return err
+	}
+	if targetConfig.Multipart, err = f.MultipartConfig(); err != nil {
+		return err
+	}
+	if s.Target, err = f.TargetWith(bucketStr, targetConfig); err != nil {
+		return err
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	var reportErr error
+	s.Report = func(r *pkg.SoakReport) {
+		if reportErr == nil {
+			reportErr = printSoakReport(r, f.JSON)
+		}
+	}
+	if _, err = s.Run(ctx); err != nil {
+		return err
+	}
+	return reportErr
+}
+
+func printSoakReport(r *pkg.SoakReport, asJSON bool) error {
+	if asJSON {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	label := fmt.Sprintf("interval %d", r.Interval)
+	if r.Final {
+		label = "final"
+	}
+	var buckets []string
+	for _, b := range r.Histogram {
+		if b.Count == 0 {
+			continue
+		}
+		bound := "+Inf"
+		if !math.IsInf(b.UpperBound, 1) {
+			bound = fmt.Sprintf("%gms", b.UpperBound)
+		}
+		buckets = append(buckets, fmt.Sprintf("≤%v:%d", bound, b.Count))
+	}
+	l := r.Latency
+	_, err := fmt.Printf("%v %v (%.0fs): %d ok, %d failed (total %d ok, %d failed); p50 %.1f p90 %.1f p99 %.1f max %.1f ms; %v\n",
+		r.Time.Format(time.RFC3339), label, r.ElapsedSeconds, r.Successes, r.Failures, r.TotalSuccesses, r.TotalFailures,
+		l.P50, l.P90, l.P99, l.Max, strings.Join(buckets, " "))
+	if err == nil && r.LastError != "" {
+		_, err = fmt.Printf("  last error: %v\n", r.LastError)
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := soakFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageSoak,
+		Short:   shortDescSoak,
+		Long:    logging.Untabify(longDescSoak, ""),
+		Args:    cobra.MaximumNArgs(1),
+		Example: logging.Untabify(exampleSoak, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return soak(firstArg(args), flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringVar(&flags.SizeMin, "size-min", "1K", "minimum object size")
+	cmdFlags.StringVar(&flags.SizeMax, "size-max", "16M", "maximum object size")
+	cmdFlags.IntVarP(&flags.Jobs, "jobs", "j", 4, "number of concurrent workers")
+	cmdFlags.DurationVarP(&flags.Duration, "duration", "d", 0, "how long to run, e.g. \"12h\" (default until interrupted)")
+	cmdFlags.DurationVarP(&flags.Interval, "interval", "i", time.Minute, "reporting interval")
+	cmdFlags.IntVar(&flags.MaxFailures, "max-failures", 0, "stop after this many failed cycles (default no limit)")
+	cmdFlags.Float64Var(&flags.MaxFailureRate, "max-failure-rate", 0, "stop if this proportion (0-1) of cycles in an interval fail (default no limit)")
+	cmdFlags.StringVar(&flags.Prefix, "prefix", "", "key prefix for soak test objects")
+	cmdFlags.Int64VarP(&flags.Seed, "random-seed", "", 0, "seed for random-number generator (default current time)")
+	cmdFlags.BoolVar(&flags.JSON, "json", false, "write each report as a line of JSON")
+	flags.UploadFlags.AddTo(cmdFlags, true)
+
+	rootCmd.AddCommand(cmd)
+}
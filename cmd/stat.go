@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageStat = "stat <OBJECT-URL>"
+
+	shortDescStat = "stat: show the metadata of an object"
+
+	longDescStat = shortDescStat + `
+
+        Shows the size, ETag, last-modified time, Content-Type, Content-Encoding,
+        and Cache-Control headers, user metadata (x-amz-meta-* for S3,
+        X-Object-Meta-* for Swift), and (for S3) tags of an object, without
+        downloading it.
+
+        With --version-id, the metadata of the specified version of an object in
+        a versioned bucket is shown, rather than that of the latest version.
+
+        With --versions, the versions and delete markers of an object in a
+        versioned bucket are listed instead, newest first, one per line, as
+        tab-separated fields:
+
+            VERSION-ID  LATEST  SIZE  LAST-MODIFIED  ETAG
+
+        where LATEST is "latest" for the latest version (and "-" otherwise),
+        and a delete marker has the size and ETag "delete-marker".
+
+        With --json, the metadata (or the list of versions) is written as JSON.
+    `
+
+	exampleStat = `
+        cos stat s3://www.dmoles.net/images/fa/archive.svg --endpoint https://s3.us-west-2.amazonaws.com/
+        cos stat 'swift://distrib.stage.9001.__c5e/ark:/99999/fk4kw5kc1z|1|producer/6GBZeroFile.txt' -e http://cloud.sdsc.edu/auth/v1.0 --json
+        cos stat s3://mrt-test/inusitatum.png -e http://127.0.0.1:9000/ --versions
+    `
+)
+
+// ------------------------------------------------------------
+// statFlags type
+
+type statFlags struct {
+	*CosFlags
+	EncryptionFlags
+	ObjectVersionFlags
+
+	JSON     bool
+	Versions bool
+}
+
+func (f statFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		json:      %v
+		versions:  %v
+		timeout:   %v
+		op timeout: %v
+		%v
+		%v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.JSON, f.Versions, f.Timeout, f.OpTimeout, f.EncryptionFlags.Pretty(), f.ObjectVersionFlags.Pretty())
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func stat(objURLStr string, f statFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("object URL: %v\n", objURLStr)
+
+	obj, err := objectWithEncryption(f.CosFlags, &f.EncryptionFlags, objURLStr)
+	if err != nil {
+		return err
+	}
+	if obj, err = f.ObjectVersionFlags.Apply(obj); err != nil {
+		return err
+	}
+	mdObj, ok := obj.(objects.MetadataObject)
+	if !ok {
+		return fmt.Errorf("%v does not support metadata", obj.Pretty())
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	attempts := &objects.AttemptLog{}
+	ctx = objects.WithAttemptLog(ctx, attempts)
+	defer logRetries(logger, attempts)
+
+	if f.Versions {
+		return statVersions(ctx, obj, f)
+	}
+
+	metadata, err := mdObj.Metadata(ctx)
+	if err != nil {
+		return err
+	}
+	if f.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Object string `json:"object"`
+			*objects.Metadata
+		}{obj.Pretty(), metadata})
+	}
+
+	fmt.Printf("object:           %v\n", obj.Pretty())
+	fmt.Printf("size:             %d (%v)\n", metadata.ContentLength, logging.FormatBytes(metadata.ContentLength))
+	fmt.Printf("etag:             %v\n", metadata.ETag)
+	if !metadata.LastModified.IsZero() {
+		fmt.Printf("last modified:    %v\n", metadata.LastModified.UTC().Format(time.RFC3339))
+	}
+	if metadata.VersionID != "" {
+		fmt.Printf("version id:       %v\n", metadata.VersionID)
+	}
+	fmt.Printf("content type:     %v\n", metadata.ContentType)
+	if metadata.ContentEncoding != "" {
+		fmt.Printf("content encoding: %v\n", metadata.ContentEncoding)
+	}
+	if metadata.CacheControl != "" {
+		fmt.Printf("cache control:    %v\n", metadata.CacheControl)
+	}
+	if metadata.Encryption != "" {
+		encryption := metadata.Encryption
+		if metadata.CustomerKey {
+			encryption += " (customer key)"
+		} else if metadata.KMSKeyID != "" {
+			encryption += " (" + metadata.KMSKeyID + ")"
+		}
+		fmt.Printf("encryption:       %v\n", encryption)
+	}
+	printSortedMap("metadata", metadata.User)
+	printSortedMap("tags", metadata.Tags)
+	return nil
+}
+
+func statVersions(ctx context.Context, obj objects.Object, f statFlags) error {
+	versioned, ok := obj.(objects.VersionedObject)
+	if !ok {
+		return fmt.Errorf("%v does not support versions", obj.Pretty())
+	}
+	versions, err := versioned.Versions(ctx)
+	if err != nil {
+		return err
+	}
+	if f.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Object   string                  `json:"object"`
+			Versions []objects.ObjectVersion `json:"versions"`
+		}{obj.Pretty(), versions})
+	}
+	for _, v := range versions {
+		latest := "-"
+		if v.IsLatest {
+			latest = "latest"
+		}
+		size, eTag := strconv.FormatInt(v.Size, 10), v.ETag
+		if v.DeleteMarker {
+			size, eTag = "delete-marker", "delete-marker"
+		}
+		fmt.Printf("%v\t%v\t%v\t%v\t%v\n", v.VersionID, latest, size, v.LastModified.UTC().Format(time.RFC3339), eTag)
+	}
+	return nil
+}
+
+func printSortedMap(title string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Printf("%v:\n", title)
+	for _, k := range keys {
+		fmt.Printf("  %v: %v\n", k, values[k])
+	}
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := statFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageStat,
+		Short:   shortDescStat,
+		Long:    logging.Untabify(longDescStat, ""),
+		Args:    cobra.ExactArgs(1),
+		Example: logging.Untabify(exampleStat, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return stat(args[0], flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.BoolVar(&flags.JSON, "json", false, "write the metadata as JSON")
+	cmdFlags.BoolVar(&flags.Versions, "versions", false, "list the versions and delete markers of the object (S3 only)")
+	flags.EncryptionFlags.AddTo(cmdFlags)
+	flags.ObjectVersionFlags.AddTo(cmdFlags)
+
+	rootCmd.AddCommand(cmd)
+}
@@ -12,10 +12,11 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
 )
 
 type SuiteFlags struct {
-	CosFlags
+	*CosFlags
 
 	Size bool
 	SizeMax   string
@@ -23,6 +24,14 @@ type SuiteFlags struct {
 	Count bool
 	CountMax  uint64
 
+	Multipart   bool
+	PartSizeMax string
+
+	Metadata bool
+
+	Encryption bool
+	Versioning bool
+
 	Unicode bool
 	UnicodeCategories bool
 	UnicodeScripts bool
@@ -41,9 +50,37 @@ const (
 		- maximum file size (--size)
 		- maximum number of files per key prefix (--count)
 		- Unicode key support (--unicode)
+		- multipart upload limits (--multipart; S3 only)
+		- metadata support and limits (--metadata)
+		- server-side encryption support (--encryption; S3 only)
+		- object versioning (--versioning; S3 only, with versioning enabled)
 
 		If none of --size, --count, etc. is specified, all test cases are run.
 
+		Multipart upload limit tests use the low-level S3 multipart API to probe
+		the maximum part number, the minimum non-final part size, and the maximum
+		part size (up to --part-size-max) accepted by the service. Multipart
+		uploads are aborted, and any objects created deleted, afterward.
+
+		Metadata tests create small objects with Content-Type, Content-Encoding,
+		and Cache-Control headers, (for S3) tags, and user metadata of various
+		key and value lengths, total sizes (around the AWS limit of 2 KiB), and
+		character sets, and check that the metadata is returned as sent.
+
+		Encryption tests create, retrieve, and verify objects (with a single PUT
+		and as multipart uploads) encrypted with SSE-S3, SSE-KMS (using the
+		account's AWS-managed key), and SSE-C (using a randomly generated key),
+		check that the service reports the expected encryption, and check that
+		SSE-C objects cannot be read without the key. Note that SSE-C requires
+		an HTTPS endpoint.
+
+		Versioning tests (which require a bucket with versioning enabled, and so
+		are not run by default) check that each upload creates a new version,
+		that versions are listed and can be read by version ID, that an old
+		version can be restored by copying it over the latest, and that deleting
+		an object creates a delete marker while leaving its versions readable.
+		All versions created, and any delete markers, are deleted afterward.
+
 		The maximum size may be specified as an exact number of bytes, or using
 		human-readable quantities such as "5K" (4 KiB or 4096 bytes), "3.5M" (3.5
 		MiB or 3670016 bytes), etc. The units supported are bytes (B), binary
@@ -71,18 +108,18 @@ const (
 )
 
 func init() {
-	f := SuiteFlags{}
+	f := SuiteFlags{CosFlags: rootFlags}
 	cmd := &cobra.Command{
-		Use:   "suite <BUCKET-URL>",
+		Use:   "suite [BUCKET-URL]",
 		Short: "run a suite of tests",
 		Long: logging.Untabify(suiteLongDesc, ""),
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSuite(args[0], f)
+			return runSuite(firstArg(args), f)
 		},
 	}
 	cmdFlags := cmd.Flags()
-	f.AddTo(cmdFlags)
+	cmdFlags.SortFlags = false
 
 	cmdFlags.BoolVarP(&f.Size, "size", "s", false, "test file sizes")
 	cmdFlags.StringVar(&f.SizeMax, "size-max", bytefmt.ByteSize(SizeMaxDefault), "max file size to create")
@@ -90,6 +127,14 @@ func init() {
 	cmdFlags.BoolVarP(&f.Count, "count", "c", false, "test file counts")
 	cmdFlags.Uint64Var(&f.CountMax, "count-max", CountMaxDefault, "max number of files to create, or -1 for no limit")
 
+	cmdFlags.BoolVarP(&f.Multipart, "multipart", "m", false, "test multipart upload limits (S3 only)")
+	cmdFlags.StringVar(&f.PartSizeMax, "part-size-max", fmt.Sprintf("%dM", PartSizeMaxDefault/bytefmt.MEGABYTE), "max multipart upload part size to try")
+
+	cmdFlags.BoolVar(&f.Metadata, "metadata", false, "test metadata support and limits")
+
+	cmdFlags.BoolVar(&f.Encryption, "encryption", false, "test server-side encryption (S3 only)")
+	cmdFlags.BoolVar(&f.Versioning, "versioning", false, "test object versioning (S3 only; requires a versioned bucket)")
+
 	cmdFlags.BoolVarP(&f.Unicode, "unicode", "u", false, "test Unicode keys")
 	cmdFlags.BoolVar(&f.UnicodeCategories, "unicode-categories", false, "test Unicode categories")
 	cmdFlags.BoolVar(&f.UnicodeScripts, "unicode-scripts", false, "test Unicode scripts")
@@ -112,6 +157,11 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 		return err
 	}
 
+	partSizeMax, err := ParseSizeMax(f.PartSizeMax)
+	if err != nil {
+		return err
+	}
+
 	var countMax uint64
 	if f.CountMax < 0 {
 		countMax = math.MaxUint64
@@ -137,13 +187,33 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 		f.UnicodeInvalid
 
 	var cases []Case
-	runAllCases := !(f.Size || f.Count || anyUnicode)
+	runAllCases := !(f.Size || f.Count || f.Multipart || f.Metadata || f.Encryption || f.Versioning || anyUnicode)
 	if runAllCases || f.Size {
 		cases = append(cases, FileSizeCases(sizeMax)...)
 	}
 	if runAllCases || f.Count {
 		cases = append(cases, FileCountCases(countMax)...)
 	}
+	if _, isS3 := target.(*objects.S3Target); isS3 && (runAllCases || f.Multipart) {
+		cases = append(cases, AllMultipartCases(partSizeMax)...)
+	} else if f.Multipart {
+		return fmt.Errorf("--multipart requires an S3 target")
+	}
+	if runAllCases || f.Metadata {
+		_, isS3 := target.(*objects.S3Target)
+		cases = append(cases, AllMetadataCases(isS3)...)
+	}
+	if _, isS3 := target.(*objects.S3Target); isS3 && (runAllCases || f.Encryption) {
+		cases = append(cases, AllEncryptionCases()...)
+	} else if f.Encryption {
+		return fmt.Errorf("--encryption requires an S3 target")
+	}
+	if f.Versioning {
+		if _, isS3 := target.(*objects.S3Target); !isS3 {
+			return fmt.Errorf("--versioning requires an S3 target")
+		}
+		cases = append(cases, AllVersioningCases()...)
+	}
 	if runAllCases || f.Unicode {
 		cases = append(cases, AllUnicodeCases()...)
 	}
@@ -165,11 +235,17 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 		}
 	}
 
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
 	// sanity check
 	fmt.Println("Checking server connection…")
 	if !f.DryRun {
 		crvd := pkg.NewDefaultCrvd(target, "")
-		err := crvd.CreateRetrieveVerifyDelete()
+		err := crvd.CreateRetrieveVerifyDelete(ctx)
 		if err != nil {
 			return fmt.Errorf("connection check failed: %v", err)
 		}
@@ -178,7 +254,7 @@ func runSuite(bucketStr string, f SuiteFlags) error {
 	//noinspection GoPrintFunctions
 	fmt.Printf("Starting test suite (%d cases)…\n\n", len(cases))
 	suite := NewSuite(cases, target, logLevel, f.DryRun)
-	elapsedAll := suite.Execute()
+	elapsedAll := suite.Execute(ctx)
 	fmt.Printf("\n…test complete (%v).\n", logging.FormatNanos(elapsedAll))
 
 	return nil
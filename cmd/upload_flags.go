@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+// UploadFlags holds flags controlling how S3 objects are uploaded, shared by
+// all commands that create objects
+type UploadFlags struct {
+	UploadMode  string
+	PartSize    string
+	Concurrency int
+	VerifyETags bool
+}
+
+// AddTo adds the upload flags to the specified flag set
+func (f *UploadFlags) AddTo(cmdFlags *pflag.FlagSet, verifyETagsDefault bool) {
+	cmdFlags.StringVar(&f.UploadMode, "upload-mode", string(objects.UploadAuto), "S3 upload mode: auto, single (single PUT), or multipart")
+	cmdFlags.StringVar(&f.PartSize, "part-size", "", "S3 multipart upload part size (default determined from object size)")
+	cmdFlags.IntVar(&f.Concurrency, "concurrency", objects.DefaultUploadConcurrency, "number of S3 multipart upload parts to upload in parallel")
+	cmdFlags.BoolVar(&f.VerifyETags, "verify-etags", verifyETagsDefault, "verify the MD5-based ETag of each object uploaded (and, for S3, of each part)")
+}
+
+// MultipartConfig returns the S3 upload configuration specified by the flags
+func (f *UploadFlags) MultipartConfig() (config objects.MultipartConfig, err error) {
+	if config.Mode, err = objects.ParseUploadMode(f.UploadMode); err != nil {
+		return config, err
+	}
+	if f.PartSize != "" {
+		if config.PartSize, err = parseSize(f.PartSize); err != nil {
+			return config, fmt.Errorf("invalid part size: %v", err)
+		}
+		if config.PartSize <= 0 {
+			return config, fmt.Errorf("invalid part size: %v", f.PartSize)
+		}
+	}
+	if f.Concurrency < 1 {
+		return config, fmt.Errorf("invalid concurrency: %d", f.Concurrency)
+	}
+	config.Concurrency = f.Concurrency
+	config.VerifyETags = f.VerifyETags
+	return config, nil
+}
+
+func (f *UploadFlags) Pretty() string {
+	return fmt.Sprintf("upload mode: %v, part size: %#v, concurrency: %d, verify ETags: %v",
+		f.UploadMode, f.PartSize, f.Concurrency, f.VerifyETags)
+}
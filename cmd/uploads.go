@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+// ------------------------------------------------------------
+// Constants: Help Text
+
+const (
+	usageUploads = "uploads [BUCKET-URL]"
+
+	shortDescUploads = "uploads: list or abort incomplete multipart uploads"
+
+	longDescUploads = shortDescUploads + `
+
+        Lists the incomplete multipart uploads in an S3 bucket, optionally
+        filtered by key prefix and by age, and (with --abort) aborts them,
+        deleting any parts already uploaded.
+
+        Incomplete multipart uploads are invisible in ordinary bucket listings,
+        but their parts still count toward storage use (and billing) until the
+        upload is completed or aborted.
+    `
+
+	exampleUploads = `
+        cos uploads s3://www.dmoles.net/ --endpoint https://s3.us-west-2.amazonaws.com/
+        cos uploads s3://mrt-test/ -e http://127.0.0.1:9000/ --prefix cos-crvd- --older-than 24h --abort
+    `
+)
+
+// ------------------------------------------------------------
+// uploadsFlags type
+
+type uploadsFlags struct {
+	*CosFlags
+
+	Prefix    string
+	OlderThan time.Duration
+	Abort     bool
+}
+
+func (f uploadsFlags) Pretty() string {
+	format := `
+		log level: %v
+		region:   '%v'
+		endpoint: '%v'
+		prefix:   '%v'
+		older than: %v
+		abort:     %v`
+	format = logging.Untabify(format, "  ")
+	return fmt.Sprintf(format, f.LogLevel(), f.Region, f.Endpoint, f.Prefix, f.OlderThan, f.Abort)
+}
+
+// ------------------------------------------------------------
+// Functions
+
+func uploads(bucketStr string, f uploadsFlags) error {
+	logger := logging.DefaultLoggerWithLevel(f.LogLevel())
+	logger.Tracef("flags: %v\n", f)
+	logger.Tracef("bucket URL: %v\n", bucketStr)
+
+	target, err := f.Target(bucketStr)
+	if err != nil {
+		return err
+	}
+	s3Target, ok := target.(*objects.S3Target)
+	if !ok {
+		return fmt.Errorf("multipart uploads are only supported for S3 targets; got %v", target.Pretty())
+	}
+
+	ctx, cancel, err := f.Context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	var initiatedBefore time.Time
+	if f.OlderThan > 0 {
+		initiatedBefore = time.Now().Add(-f.OlderThan)
+	}
+	incomplete, err := s3Target.ListMultipartUploads(ctx, f.Prefix, initiatedBefore)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, u := range incomplete {
+		if !f.Abort {
+			fmt.Printf("%v\t%v\t%v\n", u.Initiated.Format(time.RFC3339), u.Key, u.UploadID)
+			continue
+		}
+		if err := s3Target.AbortMultipartUpload(ctx, u); err != nil {
+			failed++
+			logger.Infof("Aborting upload %v for %v failed: %v\n", u.UploadID, u.Key, logging.FormatError(err))
+			continue
+		}
+		fmt.Printf("aborted\t%v\t%v\t%v\n", u.Initiated.Format(time.RFC3339), u.Key, u.UploadID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to abort %d of %d uploads", failed, len(incomplete))
+	}
+	if len(incomplete) == 0 {
+		logger.Detailf("No incomplete multipart uploads found\n")
+	}
+	return ctx.Err()
+}
+
+// ------------------------------------------------------------
+// Command initialization
+
+func init() {
+	flags := uploadsFlags{CosFlags: rootFlags}
+	cmd := &cobra.Command{
+		Use:     usageUploads,
+		Short:   shortDescUploads,
+		Long:    logging.Untabify(longDescUploads, ""),
+		Args:    cobra.MaximumNArgs(1),
+		Example: logging.Untabify(exampleUploads, "  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.OlderThan < 0 {
+				return errors.New("--older-than must not be negative")
+			}
+			return uploads(firstArg(args), flags)
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.SortFlags = false
+
+	cmdFlags.StringVar(&flags.Prefix, "prefix", "", "only uploads with keys beginning with this prefix")
+	cmdFlags.DurationVar(&flags.OlderThan, "older-than", 0, "only uploads initiated at least this long ago, e.g. \"24h\"")
+	cmdFlags.BoolVar(&flags.Abort, "abort", false, "abort the matching uploads (default: list only)")
+
+	rootCmd.AddCommand(cmd)
+}
@@ -9,12 +9,14 @@ require (
 	github.com/dmolesUC3/emoji v0.0.0-20190226181050-1849526eb21f
 	github.com/magefile/mage v1.15.0
 	github.com/minimaxir/big-list-of-naughty-strings/naughtystrings v0.0.0
-	github.com/ncw/swift v1.0.53
+	github.com/ncw/swift/v2 v2.0.5
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/pflag v1.0.5
+	go.etcd.io/bbolt v1.3.11
 	golang.org/x/text v0.13.0
 	golang.org/x/tools v0.14.0
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigFileEnvVar names an environment variable specifying an alternate config file
+	ConfigFileEnvVar = "COS_CONFIG"
+	// ProfileEnvVar names an environment variable specifying the profile to use
+	ProfileEnvVar = "COS_PROFILE"
+)
+
+// ------------------------------------------------------------
+// Config type
+
+// Config represents the contents of a cos configuration file
+type Config struct {
+	// DefaultProfile names the profile to use if none is specified
+	DefaultProfile string `yaml:"default_profile"`
+	// Profiles maps profile names to profiles
+	Profiles map[string]*Profile `yaml:"profiles"`
+	// Probes lists the probes run by the monitor command
+	Probes []*Probe `yaml:"probes"`
+}
+
+// DefaultPath returns the default config file location: the path in
+// $COS_CONFIG, if set, or else cos/config.yaml in $XDG_CONFIG_HOME, if
+// set, or else ~/.config/cos/config.yaml.
+func DefaultPath() (string, error) {
+	if path := os.Getenv(ConfigFileEnvVar); path != "" {
+		return path, nil
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "cos", "config.yaml"), nil
+}
+
+// Load reads the config file at the specified path. If the path is empty, Load
+// reads the file at the DefaultPath(), returning an empty Config if that file
+// does not exist.
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		defaultPath, err := DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		path = defaultPath
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %v: %v", path, err)
+	}
+	return config, nil
+}
+
+// Parse parses the specified YAML config file contents.
+func Parse(data []byte) (*Config, error) {
+	config := Config{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for name, p := range config.Profiles {
+		if p == nil {
+			p = &Profile{}
+			config.Profiles[name] = p
+		}
+		p.Name = name
+	}
+	if config.DefaultProfile != "" {
+		if _, ok := config.Profiles[config.DefaultProfile]; !ok {
+			return nil, fmt.Errorf("default profile %#v not found", config.DefaultProfile)
+		}
+	}
+	names := map[string]bool{}
+	for i, p := range config.Probes {
+		if p == nil || p.Name == "" {
+			return nil, fmt.Errorf("probe %d has no name", i+1)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate probe name: %#v", p.Name)
+		}
+		names[p.Name] = true
+		if p.Profile != "" {
+			if _, ok := config.Profiles[p.Profile]; !ok {
+				return nil, fmt.Errorf("probe %#v: profile %#v not found", p.Name, p.Profile)
+			}
+		}
+	}
+	return &config, nil
+}
+
+// Profile returns the profile with the specified name, or an error if no such
+// profile exists.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if p, ok := c.Profiles[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("no such profile: %#v (available profiles: %v)", name, c.ProfileNames())
+}
+
+// ProfileNames returns the names of all profiles, in sorted order.
+func (c *Config) ProfileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ------------------------------------------------------------
+// Profile type
+
+// Profile represents a named set of connection and tuning options for a
+// storage endpoint. Zero values indicate that the corresponding option is not
+// set in the profile.
+type Profile struct {
+	Name string `yaml:"-"`
+
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	// Protocol is the protocol ("s3" or "swift") for bucket and object URLs given without one
+	Protocol string `yaml:"protocol"`
+	// Bucket is the default bucket or container
+	Bucket string `yaml:"bucket"`
+
+	Credentials Credentials `yaml:"credentials"`
+
+	Timeout        time.Duration `yaml:"timeout"`
+	OpTimeout      time.Duration `yaml:"op_timeout"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay"`
+	RetryOn        []string      `yaml:"retry_on"`
+
+	// SwiftLargeObjects is the Swift large object type ("slo" or "dlo")
+	SwiftLargeObjects string `yaml:"swift_large_objects"`
+	// SwiftLOThreshold, SwiftSegmentSize are sizes, e.g. "2G", "100M"
+	SwiftLOThreshold      string `yaml:"swift_lo_threshold"`
+	SwiftSegmentSize      string `yaml:"swift_segment_size"`
+	SwiftSegmentContainer string `yaml:"swift_segment_container"`
+}
+
+// Credentials represents the credentials source for a profile
+type Credentials struct {
+	// Source is "env" (the default), "aws-profile", or "static"
+	Source string `yaml:"source"`
+
+	// AWSProfile is the name of a profile in the AWS shared config and
+	// credentials files (source "aws-profile")
+	AWSProfile string `yaml:"aws_profile"`
+
+	// AccessKeyID and SecretAccessKey are S3 credentials (source "static")
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+
+	// User and Key are Swift credentials (source "static")
+	User string `yaml:"user"`
+	Key  string `yaml:"key"`
+
+	// UserEnv and KeyEnv name environment variables holding Swift credentials
+	// (source "env"; default ST_USER and ST_KEY)
+	UserEnv string `yaml:"user_env"`
+	KeyEnv  string `yaml:"key_env"`
+
+	// AuthVersion, UserDomain, Project, ProjectID, ProjectDomain, and Interface
+	// are OpenStack Keystone settings for Swift (default $OS_IDENTITY_API_VERSION,
+	// $OS_USER_DOMAIN_NAME, etc.)
+	AuthVersion   int    `yaml:"auth_version"`
+	UserDomain    string `yaml:"user_domain"`
+	Project       string `yaml:"project"`
+	ProjectID     string `yaml:"project_id"`
+	ProjectDomain string `yaml:"project_domain"`
+	Interface     string `yaml:"interface"`
+}
+
+// ------------------------------------------------------------
+// Probe type
+
+// Probe represents a storage probe run periodically by the monitor command
+type Probe struct {
+	Name string `yaml:"name"`
+	// Type is "crvd" or "check"
+	Type string `yaml:"type"`
+	// Profile names the profile to use, if not the selected profile
+	Profile string `yaml:"profile"`
+	// URL is the bucket URL (crvd) or object URL (check)
+	URL string `yaml:"url"`
+	// Interval is the time between runs of the probe
+	Interval time.Duration `yaml:"interval"`
+	// Size is the size of the object to create (crvd), e.g. "1M"
+	Size string `yaml:"size"`
+	// Algorithm is the digest algorithm (check), "md5" or "sha256"
+	Algorithm string `yaml:"algorithm"`
+	// Expected is the expected digest, in hex (check)
+	Expected string `yaml:"expected"`
+}
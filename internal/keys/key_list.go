@@ -3,6 +3,7 @@ package keys
 import (
 	"fmt"
 	"math/rand"
+	"time"
 
 	"golang.org/x/tools/container/intsets"
 )
@@ -18,16 +19,27 @@ func NewKeyList(name string, desc string, keys []string) KeyList {
 	return &MemoryKeyList{name, desc, keys}
 }
 
+// SamplingKeyList returns a random sample of the specified size from the
+// specified key list, in the original order
 func SamplingKeyList(origList KeyList, sampleSize int) (KeyList, error) {
+	return SeededSamplingKeyList(origList, sampleSize, time.Now().UnixNano())
+}
+
+// SeededSamplingKeyList returns a random sample of the specified size from
+// the specified key list, in the original order, as with SamplingKeyList,
+// but chosen with the specified random seed, so that the same sample can be
+// drawn again from the same list
+func SeededSamplingKeyList(origList KeyList, sampleSize int, seed int64) (KeyList, error) {
 	if sampleSize > origList.Count() {
 		return nil, fmt.Errorf("sample size %d must be <= original list count %d", sampleSize, origList.Count())
 	}
 	if sampleSize == origList.Count() {
 		return origList, nil
 	}
+	rnd := rand.New(rand.NewSource(seed))
 	var origIndices intsets.Sparse
 	for origIndices.Len() < sampleSize {
-		origIndex := rand.Intn(origList.Count())
+		origIndex := rnd.Intn(origList.Count())
 		origIndices.Insert(origIndex)
 	}
 	origKeys := origList.Keys()
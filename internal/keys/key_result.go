@@ -4,13 +4,26 @@ import (
 	"fmt"
 
 	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
 )
 
 type KeyResult struct {
-	List  KeyList
-	Index int
-	Key   string
-	Error error
+	List     KeyList
+	Index    int
+	Key      string
+	Error    error
+	Attempts []objects.Attempt
+}
+
+// Retries returns the number of retried requests made while checking the key
+func (f *KeyResult) Retries() int {
+	retries := 0
+	for _, a := range f.Attempts {
+		if a.Number > 1 {
+			retries++
+		}
+	}
+	return retries
 }
 
 func (f *KeyResult) Success() bool {
@@ -18,20 +31,27 @@ func (f *KeyResult) Success() bool {
 }
 
 func (f *KeyResult) Pretty() string {
+	var retries string
+	if n := f.Retries(); n > 0 {
+		retries = fmt.Sprintf(" after %d retries", n)
+	}
+
 	if f.Success() {
-		return fmt.Sprintf("%#v (%d of %d from %v) succeeded",
+		return fmt.Sprintf("%#v (%d of %d from %v) succeeded%v",
 			f.Key,
 			1+f.Index,
 			f.List.Count(),
 			f.List.Name(),
+			retries,
 		)
 	}
 
-	return fmt.Sprintf("%#v (%d of %d from %v) failed: %v",
+	return fmt.Sprintf("%#v (%d of %d from %v) failed%v: %v",
 		f.Key,
 		1+f.Index,
 		f.List.Count(),
 		f.List.Name(),
+		retries,
 		logging.FormatError(f.Error),
 	)
 }
@@ -1,7 +1,9 @@
 package logging
 
 import (
+	"context"
 	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -11,6 +13,31 @@ const nsPerSecondFloat64 = float64(time.Second)
 type ProgressReporter struct {
 	totalBytes    *int64
 	expectedBytes int64
+	stopOnce      sync.Once
+	stopped       chan struct{}
+	operation     string
+	observer      ProgressObserver
+}
+
+// Progress is a snapshot of the progress of a transfer
+type Progress struct {
+	// Operation is the kind of transfer, e.g. "upload" or "download"
+	Operation     string
+	TotalBytes    int64
+	ExpectedBytes int64
+}
+
+// ProgressObserver is a function notified of the progress of transfers. It
+// is called on every read or write, and so should return quickly.
+type ProgressObserver func(p Progress)
+
+type progressObserverKey struct{}
+
+// WithProgressObserver returns a copy of the parent context carrying the
+// specified progress observer, to be notified by progress reporters that
+// observe the context (see ObserveFrom).
+func WithProgressObserver(parent context.Context, observer ProgressObserver) context.Context {
+	return context.WithValue(parent, progressObserverKey{}, observer)
 }
 
 // ------------------------------
@@ -21,6 +48,7 @@ func NewProgressReporter(expectedBytes int64) *ProgressReporter {
 	return &ProgressReporter{
 		totalBytes: &zero,
 		expectedBytes: expectedBytes,
+		stopped: make(chan struct{}),
 	}
 }
 
@@ -32,6 +60,22 @@ func (r *ProgressReporter) LogTo(logger Logger, interval time.Duration) {
 	// go monitorProgress(r.progress, r.expectedBytes, logger, interval)
 }
 
+// Stop stops logging progress (e.g. when a transfer fails before the
+// expected number of bytes is reached)
+func (r *ProgressReporter) Stop() {
+	r.stopOnce.Do(func() { close(r.stopped) })
+}
+
+// ObserveFrom notifies the progress observer (if any) carried by the context
+// of the progress of the specified operation (e.g. "upload" or "download")
+func (r *ProgressReporter) ObserveFrom(ctx context.Context, operation string) {
+	if observer, ok := ctx.Value(progressObserverKey{}).(ProgressObserver); ok && observer != nil {
+		r.operation = operation
+		r.observer = observer
+		observer(Progress{Operation: operation, ExpectedBytes: r.expectedBytes})
+	}
+}
+
 func (r *ProgressReporter) TotalBytes() int64 {
 	return atomic.LoadInt64(r.totalBytes)
 }
@@ -44,7 +88,10 @@ func (r *ProgressReporter) ExpectedBytes() int64 {
 // Unexported methods
 
 func (r *ProgressReporter) updateTotal(additionalBytes int) {
-	atomic.AddInt64(r.totalBytes, int64(additionalBytes))
+	total := atomic.AddInt64(r.totalBytes, int64(additionalBytes))
+	if r.observer != nil {
+		r.observer(Progress{Operation: r.operation, TotalBytes: total, ExpectedBytes: r.expectedBytes})
+	}
 }
 
 func (r *ProgressReporter) monitorProgress(logger Logger, interval time.Duration) {
@@ -61,8 +108,8 @@ func (r *ProgressReporter) monitorProgress(logger Logger, interval time.Duration
 			if currentBytes >= expectedBytes {
 				return
 			}
-		default:
-			// wait for next tick
+		case <-r.stopped:
+			return
 		}
 	}
 }
@@ -0,0 +1,274 @@
+// Package metrics provides counters, gauges, and histograms that can be
+// exported in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the default histogram bucket upper bounds, in seconds
+var DefaultBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// ------------------------------------------------------------
+// Registry type
+
+// Registry holds a set of metric families. It is safe for concurrent use.
+type Registry struct {
+	mux      sync.Mutex
+	families []*family
+}
+
+// NewRegistry returns a new, empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers and returns a new counter with the specified name, help
+// text, and label names
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	return &Counter{r.register(name, help, kindCounter, nil, labelNames)}
+}
+
+// Gauge registers and returns a new gauge with the specified name, help text,
+// and label names
+func (r *Registry) Gauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{r.register(name, help, kindGauge, nil, labelNames)}
+}
+
+// Histogram registers and returns a new histogram with the specified name,
+// help text, bucket upper bounds (in ascending order, not including +Inf),
+// and label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	return &Histogram{r.register(name, help, kindHistogram, buckets, labelNames)}
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	for _, f := range r.families {
+		f.writeTo(cw)
+	}
+	if cw.err == nil {
+		cw.err = bw.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves all metrics in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+func (r *Registry) register(name, help, kind string, buckets []float64, labelNames []string) *family {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metric %v already registered", name))
+		}
+	}
+	f := &family{
+		registry:   r,
+		name:       name,
+		help:       help,
+		kind:       kind,
+		buckets:    buckets,
+		labelNames: labelNames,
+		series:     map[string]*series{},
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// ------------------------------------------------------------
+// Metric types
+
+// Counter is a cumulative metric that only increases
+type Counter struct {
+	*family
+}
+
+// Inc increments the counter with the specified label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the specified (non-negative) value to the counter with the
+// specified label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %v cannot decrease", c.name))
+	}
+	c.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Gauge is a metric that can go up and down
+type Gauge struct {
+	*family
+}
+
+// Set sets the gauge with the specified label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(s *series) { s.value = v })
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	*family
+}
+
+// Observe adds an observation to the histogram with the specified label
+// values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.update(labelValues, func(s *series) {
+		i := sort.SearchFloat64s(h.buckets, v)
+		s.counts[i]++
+		s.sum += v
+		s.count++
+	})
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+type family struct {
+	registry   *Registry
+	name       string
+	help       string
+	kind       string
+	buckets    []float64
+	labelNames []string
+	series     map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// counts are the (non-cumulative) bucket counts, for histograms; the last
+	// count is for +Inf
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (f *family) update(labelValues []string, fn func(s *series)) {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %v expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	f.registry.mux.Lock()
+	defer f.registry.mux.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+func (f *family) writeTo(w *countingWriter) {
+	w.printf("# HELP %v %v\n", f.name, escapeHelp(f.help))
+	w.printf("# TYPE %v %v\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.kind != kindHistogram {
+			w.printf("%v%v %v\n", f.name, f.labels(s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(f.buckets) {
+				le = f.buckets[i]
+			}
+			w.printf("%v_bucket%v %d\n", f.name, f.labels(s.labelValues, "le", formatValue(le)), cumulative)
+		}
+		w.printf("%v_sum%v %v\n", f.name, f.labels(s.labelValues, "", ""), formatValue(s.sum))
+		w.printf("%v_count%v %d\n", f.name, f.labels(s.labelValues, "", ""), s.count)
+	}
+}
+
+// labels formats the specified label values, plus an extra label (if any)
+func (f *family) labels(values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range f.labelNames {
+		pairs = append(pairs, fmt.Sprintf("%v=\"%v\"", name, escapeLabelValue(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%v=\"%v\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,148 @@
+package objects
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CredentialsSource identifies where a Target obtains its credentials
+type CredentialsSource string
+
+const (
+	// CredentialsFromEnv reads Swift credentials from environment variables, and
+	// S3 credentials from the default AWS credentials chain
+	CredentialsFromEnv CredentialsSource = "env"
+	// CredentialsFromAWSProfile reads S3 credentials from a named profile in the
+	// AWS shared config and credentials files
+	CredentialsFromAWSProfile CredentialsSource = "aws-profile"
+	// CredentialsStatic uses credentials given directly
+	CredentialsStatic CredentialsSource = "static"
+)
+
+// ParseCredentialsSource parses the specified string as a CredentialsSource,
+// treating the empty string as CredentialsFromEnv.
+func ParseCredentialsSource(s string) (CredentialsSource, error) {
+	if s == "" {
+		return CredentialsFromEnv, nil
+	}
+	for _, src := range []CredentialsSource{CredentialsFromEnv, CredentialsFromAWSProfile, CredentialsStatic} {
+		if string(src) == s {
+			return src, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported credentials source: %#v", s)
+}
+
+// Credentials determines how a Target obtains credentials. The zero value
+// reads credentials from the environment.
+type Credentials struct {
+	Source CredentialsSource
+
+	// AWSProfile is the AWS shared config profile (CredentialsFromAWSProfile)
+	AWSProfile string
+
+	// AccessKeyID and SecretAccessKey are static S3 credentials (CredentialsStatic)
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SwiftUser and SwiftKey are static Swift credentials (CredentialsStatic)
+	SwiftUser string
+	SwiftKey  string
+
+	// SwiftUserEnvVar and SwiftKeyEnvVar name the environment variables holding
+	// Swift credentials (CredentialsFromEnv; default SwiftUserEnvVar and SwiftKeyEnvVar,
+	// falling back to OS_USERNAME and OS_PASSWORD)
+	SwiftUserEnvVar string
+	SwiftKeyEnvVar  string
+
+	// Keystone holds OpenStack Keystone settings for Swift
+	Keystone Keystone
+}
+
+func (c Credentials) Pretty() string {
+	switch c.Source {
+	case CredentialsFromAWSProfile:
+		return fmt.Sprintf("Credentials{ Source: %v, AWSProfile: %#v }", c.Source, c.AWSProfile)
+	case CredentialsStatic:
+		return fmt.Sprintf("Credentials{ Source: %v, <hidden> }", c.Source)
+	}
+	return fmt.Sprintf("Credentials{ Source: %v }", CredentialsFromEnv)
+}
+
+func (c Credentials) String() string {
+	return c.Pretty()
+}
+
+// ------------------------------------------------------------
+// Keystone type
+
+// Keystone holds OpenStack Keystone (v2 or v3) authentication settings for
+// Swift. Zero values indicate settings to be taken from the corresponding
+// OS_* environment variables, if set.
+type Keystone struct {
+	// AuthVersion is 1, 2, or 3, or 0 to detect from the auth URL
+	AuthVersion int
+	// UserDomain is the user's domain name (v3 only)
+	UserDomain string
+	// Project is the project (v3) or tenant (v2) name
+	Project string
+	// ProjectID is the project (v3) or tenant (v2) ID
+	ProjectID string
+	// ProjectDomain is the project's domain name, if different from the user's (v3 only)
+	ProjectDomain string
+	// Region is the region whose storage endpoint should be used
+	Region string
+	// Interface is the endpoint interface: "public" (the default), "internal", or "admin"
+	Interface string
+}
+
+// WithEnvironment returns a copy of these settings, with any unset values taken
+// from the OS_* environment variables used by the OpenStack command line clients.
+func (k Keystone) WithEnvironment() (Keystone, error) {
+	result := k
+	if result.AuthVersion == 0 {
+		if v := os.Getenv("OS_IDENTITY_API_VERSION"); v != "" {
+			version, err := strconv.Atoi(strings.SplitN(v, ".", 2)[0])
+			if err != nil {
+				return k, fmt.Errorf("invalid $OS_IDENTITY_API_VERSION: %#v", v)
+			}
+			result.AuthVersion = version
+		}
+	}
+	setFromEnv(&result.UserDomain, "OS_USER_DOMAIN_NAME")
+	setFromEnv(&result.Project, "OS_PROJECT_NAME", "OS_TENANT_NAME")
+	setFromEnv(&result.ProjectID, "OS_PROJECT_ID", "OS_TENANT_ID")
+	setFromEnv(&result.ProjectDomain, "OS_PROJECT_DOMAIN_NAME")
+	setFromEnv(&result.Region, "OS_REGION_NAME")
+	setFromEnv(&result.Interface, "OS_INTERFACE", "OS_ENDPOINT_TYPE")
+	// the v2 clients use e.g. "publicURL"; the v3 clients use e.g. "public"
+	result.Interface = strings.ToLower(strings.TrimSuffix(result.Interface, "URL"))
+	return result, nil
+}
+
+func (k Keystone) Pretty() string {
+	return fmt.Sprintf(
+		"Keystone{ AuthVersion: %d, UserDomain: %#v, Project: %#v, ProjectID: %#v, ProjectDomain: %#v, Region: %#v, Interface: %#v }",
+		k.AuthVersion, k.UserDomain, k.Project, k.ProjectID, k.ProjectDomain, k.Region, k.Interface,
+	)
+}
+
+func (k Keystone) String() string {
+	return k.Pretty()
+}
+
+// setFromEnv sets the specified string, if empty, to the value of the first
+// of the specified environment variables to have a non-empty value
+func setFromEnv(s *string, envVars ...string) {
+	if *s != "" {
+		return
+	}
+	for _, envVar := range envVars {
+		if v := os.Getenv(envVar); v != "" {
+			*s = v
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package objects
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CustomerKeySize is the size in bytes of an SSE-C customer key (AES-256)
+const CustomerKeySize = 32
+
+// ------------------------------------------------------------
+// EncryptionMode type
+
+// EncryptionMode determines how S3 objects are encrypted at rest
+type EncryptionMode string
+
+const (
+	// EncryptionNone requests no server-side encryption (though the bucket
+	// may still apply a default)
+	EncryptionNone EncryptionMode = "none"
+	// EncryptionS3 requests server-side encryption with S3-managed keys (SSE-S3)
+	EncryptionS3 EncryptionMode = "s3"
+	// EncryptionKMS requests server-side encryption with KMS-managed keys (SSE-KMS)
+	EncryptionKMS EncryptionMode = "kms"
+	// EncryptionCustomer requests server-side encryption with a
+	// customer-provided key (SSE-C), which must also be provided to read the
+	// object
+	EncryptionCustomer EncryptionMode = "c"
+)
+
+// ParseEncryptionMode parses the specified string as an EncryptionMode, with
+// the empty string indicating EncryptionNone.
+func ParseEncryptionMode(s string) (EncryptionMode, error) {
+	switch EncryptionMode(strings.ToLower(s)) {
+	case "", EncryptionNone:
+		return EncryptionNone, nil
+	case EncryptionS3:
+		return EncryptionS3, nil
+	case EncryptionKMS:
+		return EncryptionKMS, nil
+	case EncryptionCustomer:
+		return EncryptionCustomer, nil
+	}
+	return "", fmt.Errorf("unsupported encryption mode: %#v (expected %#v, %#v, %#v, or %#v)",
+		s, EncryptionNone, EncryptionS3, EncryptionKMS, EncryptionCustomer)
+}
+
+// ------------------------------------------------------------
+// EncryptionConfig type
+
+// EncryptionConfig determines how S3 objects are encrypted on upload, and
+// (for SSE-C) the key used to read them. Zero values indicate no encryption.
+type EncryptionConfig struct {
+	// Mode is the server-side encryption mode (default EncryptionNone)
+	Mode EncryptionMode
+	// KMSKeyID is the KMS key ID or ARN (EncryptionKMS only; default the
+	// account's AWS-managed key)
+	KMSKeyID string
+	// CustomerKey is the 256-bit customer-provided key (EncryptionCustomer only)
+	CustomerKey []byte
+}
+
+// Enabled returns true if server-side encryption was requested
+func (c EncryptionConfig) Enabled() bool {
+	return c.Mode != "" && c.Mode != EncryptionNone
+}
+
+// Validate returns an error if the configuration is inconsistent
+func (c EncryptionConfig) Validate() error {
+	if _, err := ParseEncryptionMode(string(c.Mode)); err != nil {
+		return err
+	}
+	if c.KMSKeyID != "" && c.Mode != EncryptionKMS {
+		return fmt.Errorf("a KMS key ID requires encryption mode %#v", EncryptionKMS)
+	}
+	if c.Mode == EncryptionCustomer && len(c.CustomerKey) != CustomerKeySize {
+		return fmt.Errorf("SSE-C requires a %d-byte customer key; got %d bytes", CustomerKeySize, len(c.CustomerKey))
+	}
+	if c.Mode != EncryptionCustomer && len(c.CustomerKey) > 0 {
+		return fmt.Errorf("a customer key requires encryption mode %#v", EncryptionCustomer)
+	}
+	return nil
+}
+
+// ExpectedAlgorithm returns the value the server should report for the
+// object's encryption (x-amz-server-side-encryption, or for SSE-C,
+// x-amz-server-side-encryption-customer-algorithm), or the empty string if
+// no encryption was requested
+func (c EncryptionConfig) ExpectedAlgorithm() string {
+	switch c.Mode {
+	case EncryptionS3, EncryptionCustomer:
+		return s3.ServerSideEncryptionAes256
+	case EncryptionKMS:
+		return s3.ServerSideEncryptionAwsKms
+	}
+	return ""
+}
+
+// ETagIsMD5 returns false if the mode means the ETags reported by the server
+// are not MD5 digests of the content (as for SSE-KMS and SSE-C)
+func (c EncryptionConfig) ETagIsMD5() bool {
+	return c.Mode != EncryptionKMS && c.Mode != EncryptionCustomer
+}
+
+func (c EncryptionConfig) Pretty() string {
+	var keyDigest string
+	if len(c.CustomerKey) > 0 {
+		// never log the key itself
+		digest := sha256.Sum256(c.CustomerKey)
+		keyDigest = "sha256:" + hex.EncodeToString(digest[:8])
+	}
+	return fmt.Sprintf("EncryptionConfig{ Mode: %v, KMSKeyID: %#v, CustomerKey: %#v }", c.Mode, c.KMSKeyID, keyDigest)
+}
+
+// ReadCustomerKey reads an SSE-C customer key from the specified file, which
+// may contain either the 32 raw key bytes or the key encoded as base64 or hex
+func ReadCustomerKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == CustomerKeySize {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == CustomerKeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(text); err == nil && len(key) == CustomerKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%v does not contain a %d-byte customer key (raw, base64, or hex)", path, CustomerKeySize)
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// sseHeaders returns the encryption headers to send when creating an object
+// (with a single PUT or a multipart upload), or nil for those not set
+func (c EncryptionConfig) sseHeaders() (sse, kmsKeyID *string) {
+	switch c.Mode {
+	case EncryptionS3:
+		return aws.String(s3.ServerSideEncryptionAes256), nil
+	case EncryptionKMS:
+		if c.KMSKeyID != "" {
+			kmsKeyID = aws.String(c.KMSKeyID)
+		}
+		return aws.String(s3.ServerSideEncryptionAwsKms), kmsKeyID
+	}
+	return nil, nil
+}
+
+// customerKey returns the SSE-C algorithm and key to send with any request
+// that writes or reads the object's content or metadata, or nil if the mode
+// is not EncryptionCustomer. (The SDK base64-encodes the key and computes the
+// key MD5 header.)
+func (c EncryptionConfig) customerKey() (algorithm, key *string) {
+	if c.Mode != EncryptionCustomer {
+		return nil, nil
+	}
+	return aws.String(s3.ServerSideEncryptionAes256), aws.String(string(c.CustomerKey))
+}
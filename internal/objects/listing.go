@@ -0,0 +1,101 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ncw/swift/v2"
+)
+
+// ------------------------------------------------------------
+// ObjectInfo type
+
+// ObjectInfo describes an object in a bucket listing
+type ObjectInfo struct {
+	Key  string
+	Size int64
+	// ETag is the ETag (S3) or hash (Swift) reported in the listing, if any
+	ETag string
+}
+
+func (i ObjectInfo) Pretty() string {
+	return fmt.Sprintf("ObjectInfo{ Key: %#v, Size: %d, ETag: %#v }", i.Key, i.Size, i.ETag)
+}
+
+func (i ObjectInfo) String() string {
+	return i.Pretty()
+}
+
+// ------------------------------------------------------------
+// Lister type
+
+// Lister is implemented by targets that can list their objects
+type Lister interface {
+	// List lists the objects with keys beginning with the specified prefix,
+	// in key order
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// ListObjects lists the objects in the specified target with keys beginning with the
+// specified prefix, returning an error if the target does not support listing.
+func ListObjects(ctx context.Context, target Target, prefix string) ([]ObjectInfo, error) {
+	lister, ok := target.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("listing not supported for %v", target.Pretty())
+	}
+	return lister.List(ctx, prefix)
+}
+
+// ------------------------------------------------------------
+// Lister implementations
+
+// List lists the objects in the bucket with keys beginning with the specified
+// prefix.
+func (e *S3Target) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s3Svc, err := e.S3()
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.ListObjectsV2Input{Bucket: &e.Bucket}
+	if prefix != "" {
+		input.Prefix = &prefix
+	}
+
+	var infos []ObjectInfo
+	err = s3Svc.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			infos = append(infos, ObjectInfo{
+				Key:  aws.StringValue(o.Key),
+				Size: aws.Int64Value(o.Size),
+				ETag: strings.Trim(aws.StringValue(o.ETag), "\""),
+			})
+		}
+		return true
+	})
+	return infos, err
+}
+
+// List lists the objects in the container with names beginning with the
+// specified prefix.
+func (e *SwiftTarget) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	cnx, err := e.Connection()
+	if err != nil {
+		return nil, err
+	}
+	var infos []ObjectInfo
+	err = withRetries(ctx, "GET", e.Pretty(), func(ctx context.Context) error {
+		objs, err := cnx.ObjectsAll(ctx, e.Container, &swift.ObjectsOpts{Prefix: prefix})
+		if err != nil {
+			return err
+		}
+		infos = make([]ObjectInfo, len(objs))
+		for i, o := range objs {
+			infos[i] = ObjectInfo{Key: o.Name, Size: o.Bytes, ETag: o.Hash}
+		}
+		return nil
+	}, swiftStatusCode)
+	return infos, err
+}
@@ -0,0 +1,69 @@
+package objects
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// ------------------------------------------------------------
+// Metadata type
+
+// The Metadata struct holds the metadata of an object
+type Metadata struct {
+	ContentType     string `json:"content_type,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	CacheControl    string `json:"cache_control,omitempty"`
+	// User maps user metadata keys (in lower case, without the x-amz-meta- or
+	// X-Object-Meta- prefix) to values
+	User map[string]string `json:"user,omitempty"`
+	// Tags maps object tag keys to values (S3 only)
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// ContentLength, ETag, LastModified, VersionID, and the encryption fields are
+	// reported by MetadataObject.Metadata, and ignored by CreateWithMetadata
+	ContentLength int64     `json:"content_length"`
+	ETag          string    `json:"etag,omitempty"`
+	LastModified  time.Time `json:"last_modified,omitempty"`
+	// VersionID is the version ID reported for the object, in a versioned
+	// bucket (S3 only)
+	VersionID string `json:"version_id,omitempty"`
+	// Encryption is the server-side encryption algorithm reported for the
+	// object (S3 only; for SSE-C, the customer algorithm)
+	Encryption string `json:"encryption,omitempty"`
+	// KMSKeyID is the KMS key reported for SSE-KMS objects (S3 only)
+	KMSKeyID string `json:"kms_key_id,omitempty"`
+	// CustomerKey is true if the object is encrypted with a customer-provided
+	// key (SSE-C; S3 only)
+	CustomerKey bool `json:"customer_key,omitempty"`
+}
+
+// ------------------------------------------------------------
+// MetadataObject interface
+
+// MetadataObject is implemented by objects that can be created with, and
+// report, metadata
+type MetadataObject interface {
+	Object
+
+	// CreateWithMetadata creates the object, as with Create, with the
+	// specified metadata (which may be nil)
+	CreateWithMetadata(ctx context.Context, body io.Reader, length int64, metadata *Metadata) error
+	// Metadata returns the object's metadata (with a HEAD request, and for
+	// S3, a request for the object's tags)
+	Metadata(ctx context.Context) (*Metadata, error)
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// userMetadata returns a copy of the specified user metadata with the keys
+// in lower case
+func userMetadata(user map[string]string) map[string]string {
+	lower := map[string]string{}
+	for k, v := range user {
+		lower[strings.ToLower(k)] = v
+	}
+	return lower
+}
@@ -1,14 +1,20 @@
 package objects
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
 	"github.com/dmolesUC3/cos/internal/logging"
 	"github.com/dmolesUC3/cos/internal/streaming"
 )
@@ -19,21 +25,44 @@ import (
 type Object interface {
 	GetEndpoint() Target
 
-	Create(body io.Reader, length int64) (err error)
-	ContentLength() (length int64, err error)
-	DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error)
-	Delete() (err error)
+	Create(ctx context.Context, body io.Reader, length int64) (err error)
+	ContentLength(ctx context.Context) (length int64, err error)
+	DownloadRange(ctx context.Context, startInclusive, endInclusive int64, buffer []byte) (n int64, err error)
+	Delete(ctx context.Context) (err error)
 
 	Pretty() string
 }
 
+// MD5Reporter is implemented by objects that can report the MD5 digest of
+// their content as recorded by the server (e.g. as an ETag), without
+// downloading it.
+type MD5Reporter interface {
+	// ContentMD5 returns the MD5 digest recorded by the server, or nil if the
+	// server does not record one for this object (e.g. for multipart uploads
+	// or large objects)
+	ContentMD5(ctx context.Context) ([]byte, error)
+}
+
+// RangeGetter is implemented by objects whose DownloadRange makes other
+// requests besides the ranged GET itself (e.g. S3Object, which first checks
+// for range support with a HEAD), to download a range with a single request.
+type RangeGetter interface {
+	// GetRange downloads the specified byte range, as with DownloadRange, with
+	// a single ranged GET
+	GetRange(ctx context.Context, startInclusive, endInclusive int64, buffer []byte) (int64, error)
+}
+
+// ErrNotFound can be wrapped by Object implementations to indicate that an
+// object does not exist; see IsNotFound()
+var ErrNotFound = errors.New("object not found")
+
 // ------------------------------
 // Factory methods
 
-func NewObject(objURL, endpointURL *url.URL, regionStr string) (Object, error) {
+func NewObject(objURL, endpointURL *url.URL, config TargetConfig) (Object, error) {
 	protocol := objURL.Scheme
 	bucket := objURL.Host
-	key := objURL.Path
+	key := strings.TrimPrefix(objURL.Path, "/")
 
 	bucketUrlStr := fmt.Sprintf("%v://%v", protocol, bucket)
 	bucketURL, err := url.Parse(bucketUrlStr)
@@ -41,7 +70,7 @@ func NewObject(objURL, endpointURL *url.URL, regionStr string) (Object, error) {
 		return nil, err
 	}
 
-	target, err := NewTarget(endpointURL, bucketURL, regionStr)
+	target, err := NewTarget(endpointURL, bucketURL, config)
 	if err != nil {
 		return nil, err
 	}
@@ -52,24 +81,52 @@ func NewObject(objURL, endpointURL *url.URL, regionStr string) (Object, error) {
 // Utility functions
 
 // Download downloads the object in chunks of the specified rangeSize, writing
-// the downloaded bytes to the specified io.Writer.
-func Download(obj Object, rangeSize int64, out io.Writer) (n int64, err error) {
+// the downloaded bytes to the specified io.Writer. The download stops with an
+// error if the context is cancelled or its deadline expires.
+func Download(ctx context.Context, obj Object, rangeSize int64, out io.Writer) (n int64, err error) {
+	return DownloadFrom(ctx, obj, 0, rangeSize, out)
+}
+
+// DownloadFrom downloads the object starting at the specified offset, as
+// with Download, returning the number of bytes downloaded.
+func DownloadFrom(ctx context.Context, obj Object, offset int64, rangeSize int64, out io.Writer) (n int64, err error) {
+	return DownloadRangeTo(ctx, obj, offset, -1, rangeSize, out)
+}
+
+// DownloadRangeTo downloads the specified byte range of the object (with
+// the end inclusive, or -1 for the end of the object), as with Download,
+// returning the number of bytes downloaded.
+func DownloadRangeTo(ctx context.Context, obj Object, startInclusive, endInclusive int64, rangeSize int64, out io.Writer) (n int64, err error) {
 	// this will 404 if the object doesn't exist
-	contentLength, err := obj.ContentLength()
+	contentLength, err := obj.ContentLength(ctx)
 	if err != nil {
 		return 0, err
 	}
+	if startInclusive > contentLength {
+		return 0, fmt.Errorf("offset %d is past end of %v (%d bytes)", startInclusive, obj, contentLength)
+	}
+	if endInclusive >= contentLength {
+		return 0, fmt.Errorf("range end %d is past end of %v (%d bytes)", endInclusive, obj, contentLength)
+	}
+	limit := contentLength
+	if endInclusive >= 0 {
+		if endInclusive < startInclusive {
+			return 0, fmt.Errorf("invalid range: end %d is before start %d", endInclusive, startInclusive)
+		}
+		limit = endInclusive + 1
+	}
 	logger := logging.DefaultLogger()
 
-	outWithProgress := logging.NewProgressWriter(out, contentLength)
+	outWithProgress := logging.NewProgressWriter(out, limit-startInclusive)
 	outWithProgress.LogTo(logger, time.Second)
+	outWithProgress.ObserveFrom(ctx, "download")
+	defer outWithProgress.Stop()
 
-	expectedBytes := outWithProgress.ExpectedBytes()
-
-	for ; n < expectedBytes; {
-		start, end, size := streaming.NextRange(n, rangeSize, expectedBytes)
+	for pos := startInclusive; pos < limit; {
+		start, end, size := streaming.NextRange(pos, rangeSize, limit)
 		buffer := make([]byte, size)
-		bytesRead, err := obj.DownloadRange(start, end, buffer)
+		var bytesRead int64
+		bytesRead, err = obj.DownloadRange(ctx, start, end, buffer)
 		if err != nil {
 			break
 		}
@@ -77,6 +134,7 @@ func Download(obj Object, rangeSize int64, out io.Writer) (n int64, err error) {
 		if err != nil {
 			break
 		}
+		pos += bytesRead
 		n += bytesRead
 	}
 	logger.Detailf("%v from %v\n", logging.FormatBytes(n), obj)
@@ -85,12 +143,19 @@ func Download(obj Object, rangeSize int64, out io.Writer) (n int64, err error) {
 
 // CalcDigest calculates the digest of the object using the specified algorithm
 // (md5 or sha256), using ranged downloads of the specified size.
-func CalcDigest(obj Object, downloadRangeSize int64, algorithm string) ([] byte, error) {
-	h, err := newHash(algorithm)
+func CalcDigest(ctx context.Context, obj Object, downloadRangeSize int64, algorithm string) ([] byte, error) {
+	return CalcRangeDigest(ctx, obj, 0, -1, downloadRangeSize, algorithm)
+}
+
+// CalcRangeDigest calculates the digest of the specified byte range of the
+// object (with the end inclusive, or -1 for the end of the object), as with
+// CalcDigest.
+func CalcRangeDigest(ctx context.Context, obj Object, startInclusive, endInclusive int64, downloadRangeSize int64, algorithm string) ([]byte, error) {
+	h, err := NewHash(algorithm)
 	if err != nil {
 		return nil, err
 	}
-	_, err = Download(obj, downloadRangeSize, h)
+	_, err = DownloadRangeTo(ctx, obj, startInclusive, endInclusive, downloadRangeSize, h)
 	if err != nil {
 		return nil, err
 	}
@@ -98,8 +163,26 @@ func CalcDigest(obj Object, downloadRangeSize int64, algorithm string) ([] byte,
 	return digest, nil
 }
 
-// newHash returns a new hash of the specified algorithm ("sha256" or "md5")
-func newHash(algorithm string) (hash.Hash, error) {
+// IsNotFound returns true if the error indicates that the object (or its
+// bucket or container) does not exist, i.e. an HTTP 404 from S3 or Swift, or
+// a wrapped ErrNotFound
+func IsNotFound(err error) bool {
+	for e := err; e != nil; e = unwrap(e) {
+		if e == ErrNotFound {
+			return true
+		}
+		if reqErr, ok := e.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+			return true
+		}
+		if swiftStatusCode(e) == http.StatusNotFound {
+			return true
+		}
+	}
+	return false
+}
+
+// NewHash returns a new hash of the specified algorithm ("sha256" or "md5")
+func NewHash(algorithm string) (hash.Hash, error) {
 	if algorithm == "sha256" {
 		return sha256.New(), nil
 	} else if algorithm == "md5" {
@@ -0,0 +1,388 @@
+package objects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/ncw/swift/v2"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+const (
+	DefaultMaxAttempts    = 4
+	DefaultRetryBaseDelay = 200 * time.Millisecond
+	DefaultRetryMaxDelay  = 20 * time.Second
+)
+
+// ------------------------------------------------------------
+// RetryClass type
+
+// RetryClass identifies a class of failures that a RetryPolicy may retry
+type RetryClass string
+
+const (
+	// RetryServerError covers HTTP 5xx responses other than throttling
+	RetryServerError RetryClass = "5xx"
+	// RetryThrottled covers HTTP 429 responses, Swift rate limiting (HTTP
+	// 498), and S3 SlowDown and similar throttling errors
+	RetryThrottled RetryClass = "throttle"
+	// RetryConnection covers connection resets, refusals, and network timeouts
+	RetryConnection RetryClass = "connection"
+)
+
+// AllRetryClasses lists all supported retry classes
+var AllRetryClasses = []RetryClass{RetryServerError, RetryThrottled, RetryConnection}
+
+// ParseRetryClass parses the specified string as a RetryClass, returning an
+// error if it is not one of the supported classes.
+func ParseRetryClass(s string) (RetryClass, error) {
+	for _, c := range AllRetryClasses {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported retry class: %#v (expected one of %v)", s, AllRetryClasses)
+}
+
+// ClassifyFailure determines the retry class of a failed request, given the
+// HTTP status code of the response (or 0 if there was no response) and the
+// resulting error. It returns false if the failure does not fall into any
+// retry class.
+func ClassifyFailure(statusCode int, err error) (RetryClass, bool) {
+	if err == nil || isCancellation(err) {
+		return "", false
+	}
+	if isThrottle(statusCode, err) {
+		return RetryThrottled, true
+	}
+	if statusCode >= 500 && statusCode < 600 {
+		return RetryServerError, true
+	}
+	if statusCode == 0 && isConnectionError(err) {
+		return RetryConnection, true
+	}
+	return "", false
+}
+
+// ------------------------------------------------------------
+// RetryPolicy type
+
+// RetryPolicy determines which failed operations are retried, how many times,
+// and with what delay. The same policy applies to both S3 and Swift targets.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for each retry after that
+	BaseDelay time.Duration
+	// MaxDelay is the maximum delay before any retry
+	MaxDelay time.Duration
+	// RetryOn lists the classes of failures to retry
+	RetryOn []RetryClass
+}
+
+// DefaultRetryPolicy returns a policy retrying all supported classes of
+// failure, up to DefaultMaxAttempts attempts.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+		RetryOn:     AllRetryClasses,
+	}
+}
+
+// Retries returns true if the policy retries the specified class of failures.
+func (p RetryPolicy) Retries(class RetryClass) bool {
+	for _, c := range p.RetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldRetry returns true if, after the specified (1-based) attempt failed
+// with the specified status code and error, the policy calls for another attempt.
+func (p RetryPolicy) ShouldRetry(attempt int, statusCode int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	class, ok := ClassifyFailure(statusCode, err)
+	return ok && p.Retries(class)
+}
+
+// Backoff returns the delay before retrying after the specified (1-based)
+// attempt, using exponential backoff with "full jitter", i.e. a random delay
+// between zero and the exponential delay.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	// stop doubling before the delay overflows, even with no MaxDelay
+	for i := 1; i < attempt && delay <= math.MaxInt64/2 && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay == math.MaxInt64 {
+		delay-- // so that delay + 1 doesn't overflow
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+func (p RetryPolicy) Pretty() string {
+	return fmt.Sprintf("RetryPolicy{ MaxAttempts: %d, BaseDelay: %v, MaxDelay: %v, RetryOn: %v }",
+		p.MaxAttempts, p.BaseDelay, p.MaxDelay, p.RetryOn)
+}
+
+func (p RetryPolicy) String() string {
+	return p.Pretty()
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a copy of the parent context carrying the specified
+// retry policy.
+func WithRetryPolicy(parent context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(parent, retryPolicyKey{}, policy)
+}
+
+// RetryPolicyFrom returns the retry policy carried by the specified context,
+// or DefaultRetryPolicy() if none has been set.
+func RetryPolicyFrom(ctx context.Context) RetryPolicy {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy); ok {
+		return policy
+	}
+	return DefaultRetryPolicy()
+}
+
+// ------------------------------------------------------------
+// Attempt type
+
+// Attempt records a single attempt at a storage request
+type Attempt struct {
+	Operation  string
+	Resource   string
+	Number     int
+	StatusCode int
+	Elapsed    time.Duration
+	Err        error
+}
+
+// Success returns true if the attempt succeeded, false otherwise
+func (a Attempt) Success() bool {
+	return a.Err == nil
+}
+
+func (a Attempt) Pretty() string {
+	status := "succeeded"
+	if !a.Success() {
+		status = fmt.Sprintf("failed: %v", logging.FormatError(a.Err))
+	}
+	statusCode := ""
+	if a.StatusCode != 0 {
+		statusCode = fmt.Sprintf(" (HTTP %d)", a.StatusCode)
+	}
+	return fmt.Sprintf("%v %v attempt %d%v %v after %v",
+		a.Operation, a.Resource, a.Number, statusCode, status, logging.FormatNanos(int64(a.Elapsed)))
+}
+
+func (a Attempt) String() string {
+	return a.Pretty()
+}
+
+// ------------------------------------------------------------
+// AttemptLog type
+
+// AttemptLog accumulates the attempts made by storage operations. It is safe
+// for concurrent use.
+type AttemptLog struct {
+	mux      sync.Mutex
+	attempts []Attempt
+}
+
+// Attempts returns all attempts recorded so far
+func (l *AttemptLog) Attempts() []Attempt {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return append([]Attempt(nil), l.attempts...)
+}
+
+// Retries returns the number of recorded attempts that were retries
+func (l *AttemptLog) Retries() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	retries := 0
+	for _, a := range l.attempts {
+		if a.Number > 1 {
+			retries++
+		}
+	}
+	return retries
+}
+
+func (l *AttemptLog) record(a Attempt) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.attempts = append(l.attempts, a)
+}
+
+type attemptLogKey struct{}
+
+// WithAttemptLog returns a copy of the parent context carrying the specified
+// attempt log, to which storage operations record each attempt they make.
+func WithAttemptLog(parent context.Context, log *AttemptLog) context.Context {
+	return context.WithValue(parent, attemptLogKey{}, log)
+}
+
+// recordAttempt logs the specified attempt and adds it to the attempt log (if
+// any) carried by the context.
+func recordAttempt(ctx context.Context, a Attempt) {
+	logger := logging.DefaultLogger()
+	if a.Success() {
+		logger.Tracef("%v\n", a)
+	} else {
+		logger.Detailf("%v\n", a)
+	}
+	if log, ok := ctx.Value(attemptLogKey{}).(*AttemptLog); ok && log != nil {
+		log.record(a)
+	}
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// withRetries makes one or more attempts at the specified operation, as
+// determined by the retry policy carried by the context. The statusCodeOf
+// function extracts the HTTP status code (if any) from a failed attempt's error.
+func withRetries(
+	ctx context.Context, operation string, resource string,
+	attemptFn func(ctx context.Context) error, statusCodeOf func(err error) int,
+) (err error) {
+	policy := RetryPolicyFrom(ctx)
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err = attemptFn(ctx)
+		statusCode := 0
+		if err != nil {
+			statusCode = statusCodeOf(err)
+		}
+		recordAttempt(ctx, Attempt{
+			Operation:  operation,
+			Resource:   resource,
+			Number:     attempt,
+			StatusCode: statusCode,
+			Elapsed:    time.Since(start),
+			Err:        err,
+		})
+		if err == nil || !policy.ShouldRetry(attempt, statusCode, err) {
+			return err
+		}
+		delay := policy.Backoff(attempt)
+		logging.DefaultLogger().Tracef("Retrying %v %v in %v\n", operation, resource, delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// origErrer matches errors (such as those returned by the AWS SDK) that wrap
+// an original error without implementing Unwrap()
+type origErrer interface {
+	OrigErr() error
+}
+
+func unwrap(err error) error {
+	if u := errors.Unwrap(err); u != nil {
+		return u
+	}
+	if o, ok := err.(origErrer); ok {
+		return o.OrigErr()
+	}
+	return nil
+}
+
+func isCancellation(err error) bool {
+	for e := err; e != nil; e = unwrap(e) {
+		if e == context.Canceled || e == context.DeadlineExceeded {
+			return true
+		}
+	}
+	return false
+}
+
+func isConnectionError(err error) bool {
+	for e := err; e != nil; e = unwrap(e) {
+		if e == io.EOF || e == io.ErrUnexpectedEOF {
+			return true
+		}
+		if errors.Is(e, syscall.ECONNRESET) || errors.Is(e, syscall.ECONNREFUSED) || errors.Is(e, syscall.EPIPE) {
+			return true
+		}
+		if netErr, ok := e.(net.Error); ok && netErr.Timeout() {
+			return true
+		}
+		if strings.Contains(e.Error(), "connection reset") {
+			return true
+		}
+	}
+	return false
+}
+
+// throttleCodes lists the AWS error codes indicating throttling
+var throttleCodes = map[string]bool{
+	"SlowDown":                  true,
+	"Throttling":                true,
+	"ThrottlingException":       true,
+	"ThrottledException":        true,
+	"RequestLimitExceeded":      true,
+	"RequestThrottled":          true,
+	"RequestThrottledException": true,
+	"TooManyRequests":           true,
+	"TooManyRequestsException":  true,
+}
+
+// throttleMessages are matched against errors that carry neither an AWS
+// error code nor a Swift status
+var throttleMessages = []string{"SlowDown", "Throttl", "RequestLimitExceeded", "TooManyRequests"}
+
+// isThrottle returns true if the failure indicates throttling: an HTTP 429
+// or (for Swift) 498 status, or an AWS throttling error code. Only if the
+// error carries no AWS error code and is not a Swift error is its message
+// checked for throttling keywords, since otherwise any error text that
+// happened to contain them (a key, say) would be retried as throttling.
+func isThrottle(statusCode int, err error) bool {
+	if statusCode == 429 || statusCode == 498 {
+		return true
+	}
+	for e := err; e != nil; e = unwrap(e) {
+		if awsErr, ok := e.(awserr.Error); ok && awsErr.Code() != "" {
+			return throttleCodes[awsErr.Code()]
+		}
+		if swiftErr, ok := e.(*swift.Error); ok {
+			return swiftErr.StatusCode == 429 || swiftErr.StatusCode == 498
+		}
+	}
+	msg := err.Error()
+	for _, m := range throttleMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,530 @@
+package objects
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+const (
+	// MaxSinglePutSize is the maximum size of an S3 object uploaded with a single PUT
+	MaxSinglePutSize = int64(5 * 1024 * 1024 * 1024)
+	// DefaultUploadConcurrency is the default number of parts uploaded in parallel
+	DefaultUploadConcurrency = s3manager.DefaultUploadConcurrency
+)
+
+// ------------------------------------------------------------
+// UploadMode type
+
+// UploadMode determines whether S3 objects are uploaded with a single PUT or
+// as multipart uploads
+type UploadMode string
+
+const (
+	// UploadAuto uses a single PUT for objects no larger than the part size,
+	// and a multipart upload otherwise
+	UploadAuto UploadMode = "auto"
+	// UploadSingle always uses a single PUT
+	UploadSingle UploadMode = "single"
+	// UploadMultipart always uses a multipart upload, even for a single part
+	UploadMultipart UploadMode = "multipart"
+)
+
+// ParseUploadMode parses the specified string as an UploadMode, with the
+// empty string indicating UploadAuto.
+func ParseUploadMode(s string) (UploadMode, error) {
+	switch UploadMode(s) {
+	case "", UploadAuto:
+		return UploadAuto, nil
+	case UploadSingle:
+		return UploadSingle, nil
+	case UploadMultipart:
+		return UploadMultipart, nil
+	}
+	return "", fmt.Errorf("unsupported upload mode: %#v (expected %#v, %#v, or %#v)", s, UploadAuto, UploadSingle, UploadMultipart)
+}
+
+// ------------------------------------------------------------
+// MultipartConfig type
+
+// MultipartConfig determines how S3 objects are uploaded. Zero values
+// indicate the defaults.
+type MultipartConfig struct {
+	// Mode determines whether to use a single PUT or a multipart upload (default UploadAuto)
+	Mode UploadMode
+	// PartSize is the part size (default determined from the object size)
+	PartSize int64
+	// Concurrency is the number of parts to upload in parallel (default DefaultUploadConcurrency)
+	Concurrency int
+	// VerifyETags determines whether the ETag of each part, and of the object
+	// as a whole, is checked against the expected MD5-based value
+	VerifyETags bool
+}
+
+func (c MultipartConfig) Pretty() string {
+	return fmt.Sprintf("MultipartConfig{ Mode: %v, PartSize: %d, Concurrency: %d, VerifyETags: %v }",
+		c.Mode, c.PartSize, c.Concurrency, c.VerifyETags)
+}
+
+func (c MultipartConfig) String() string {
+	return c.Pretty()
+}
+
+// partSizeFor returns the configured part size, or a default part size
+// for the specified object size
+func (c MultipartConfig) partSizeFor(length int64) int64 {
+	if c.PartSize > 0 {
+		return c.PartSize
+	}
+	return partSize(length)
+}
+
+func (c MultipartConfig) concurrency() int {
+	if c.Concurrency > 0 {
+		return c.Concurrency
+	}
+	return DefaultUploadConcurrency
+}
+
+// ------------------------------------------------------------
+// Multipart ETags
+
+// MultipartETag returns the ETag S3 is expected to report for a multipart
+// upload with parts having the specified MD5 digests, i.e. the hex MD5 digest
+// of the concatenated part digests, followed by a hyphen and the number of parts.
+func MultipartETag(partDigests [][]byte) string {
+	digest := md5.New()
+	for _, d := range partDigests {
+		digest.Write(d)
+	}
+	return fmt.Sprintf("%x-%d", digest.Sum(nil), len(partDigests))
+}
+
+// ------------------------------------------------------------
+// Unexported symbols
+
+// uploadedPart records the result of uploading a single part
+type uploadedPart struct {
+	number int64
+	size   int64
+	digest []byte
+	eTag   string
+}
+
+// putSingle uploads the object with a single PUT. A seekable body is sent in
+// place, so that it need not be held in memory: see singlePutBody.
+func (obj *S3Object) putSingle(ctx context.Context, s3Svc *s3.S3, body io.Reader, length int64, verify bool, metadata *Metadata) error {
+	if length > MaxSinglePutSize {
+		return fmt.Errorf(
+			"can't upload %v with a single PUT: size %d is greater than the S3 single PUT maximum %d",
+			obj, length, MaxSinglePutSize,
+		)
+	}
+	section, digest, err := singlePutBody(body, length)
+	if err != nil {
+		return err
+	}
+	input := &s3.PutObjectInput{
+		Bucket:     &obj.Endpoint.Bucket,
+		Key:        &obj.Key,
+		Body:       section,
+		ContentMD5: aws.String(base64.StdEncoding.EncodeToString(digest)),
+	}
+	if metadata != nil {
+		input.ContentType, input.ContentEncoding, input.CacheControl = s3Headers(metadata)
+		input.Metadata, input.Tagging = s3Metadata(metadata), s3Tagging(metadata)
+	}
+	encryption := obj.Endpoint.Encryption
+	input.ServerSideEncryption, input.SSEKMSKeyId = encryption.sseHeaders()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = encryption.customerKey()
+	out, err := s3Svc.PutObjectWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+	obj.recordVersion(out.VersionId)
+	if verify {
+		return verifyETag(obj.Pretty(), hex.EncodeToString(digest), out.ETag)
+	}
+	return nil
+}
+
+// putMultipart uploads the object as a multipart upload, aborting the upload
+// if any part fails
+func (obj *S3Object) putMultipart(
+	ctx context.Context, s3Svc *s3.S3, body io.Reader, length int64, config MultipartConfig, metadata *Metadata,
+) (err error) {
+	logger := logging.DefaultLogger()
+	ptSize := config.partSizeFor(length)
+	partCount := numberOfParts(length, ptSize)
+	// check the S3 limits up front, rather than failing after uploading parts
+	if partCount > s3manager.MaxUploadParts {
+		return fmt.Errorf(
+			"can't upload %v in parts of %v: %d parts would exceed the S3 maximum of %d",
+			obj, logging.FormatBytes(ptSize), partCount, s3manager.MaxUploadParts,
+		)
+	}
+	if partCount > 1 && ptSize < s3manager.MinUploadPartSize {
+		return fmt.Errorf(
+			"can't upload %v in parts of %v: non-final parts must be at least %v",
+			obj, logging.FormatBytes(ptSize), logging.FormatBytes(s3manager.MinUploadPartSize),
+		)
+	}
+	logger.Detailf("Uploading %v in %d parts of %v\n", obj, partCount, logging.FormatBytes(ptSize))
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: &obj.Endpoint.Bucket,
+		Key:    &obj.Key,
+	}
+	if metadata != nil {
+		input.ContentType, input.ContentEncoding, input.CacheControl = s3Headers(metadata)
+		input.Metadata, input.Tagging = s3Metadata(metadata), s3Tagging(metadata)
+	}
+	encryption := obj.Endpoint.Encryption
+	input.ServerSideEncryption, input.SSEKMSKeyId = encryption.sseHeaders()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = encryption.customerKey()
+	created, err := s3Svc.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+	uploadID := created.UploadId
+	defer func() {
+		if err == nil {
+			return
+		}
+		// abort even if the context was cancelled, so as not to leave parts behind
+		upload := MultipartUpload{Key: obj.Key, UploadID: *uploadID}
+		abortErr := obj.Endpoint.AbortMultipartUpload(context.WithoutCancel(ctx), upload)
+		if abortErr != nil {
+			logger.Infof("Unable to abort multipart upload %v for %v: %v\n", *uploadID, obj, logging.FormatError(abortErr))
+		} else {
+			logger.Detailf("Aborted multipart upload %v for %v\n", *uploadID, obj)
+		}
+	}()
+
+	parts, err := obj.uploadParts(ctx, s3Svc, uploadID, body, length, ptSize, config)
+	if err != nil {
+		return err
+	}
+
+	completed := make([]*s3.CompletedPart, len(parts))
+	digests := make([][]byte, len(parts))
+	for i, p := range parts {
+		completed[i] = &s3.CompletedPart{PartNumber: aws.Int64(p.number), ETag: aws.String(p.eTag)}
+		digests[i] = p.digest
+	}
+	out, err := s3Svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &obj.Endpoint.Bucket,
+		Key:             &obj.Key,
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return err
+	}
+	obj.recordVersion(out.VersionId)
+	if config.VerifyETags {
+		if err = verifyETag(obj.Pretty(), MultipartETag(digests), out.ETag); err != nil {
+			return err
+		}
+		logger.Detailf("Verified multipart ETag %v for %v\n", aws.StringValue(out.ETag), obj)
+	}
+	return nil
+}
+
+// uploadParts reads the body in parts of the specified size, uploading up to
+// config.concurrency() parts in parallel, and returns the uploaded parts in order
+func (obj *S3Object) uploadParts(
+	ctx context.Context, s3Svc *s3.S3, uploadID *string, body io.Reader, length int64, ptSize int64, config MultipartConfig,
+) ([]uploadedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mux      sync.Mutex
+		parts    []uploadedPart
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mux.Lock()
+		defer mux.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	sem := make(chan struct{}, config.concurrency())
+	var remaining = length
+	for number := int64(1); remaining > 0 || number == 1; number++ {
+		size := ptSize
+		if remaining < size {
+			size = remaining
+		}
+		data, err := readPart(body, size)
+		if err != nil {
+			fail(err)
+			break
+		}
+		remaining -= size
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			fail(ctx.Err())
+			break
+		}
+		wg.Add(1)
+		go func(number int64, data []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			part, err := obj.uploadPart(ctx, s3Svc, uploadID, number, data, config.VerifyETags)
+			if err != nil {
+				fail(err)
+				return
+			}
+			mux.Lock()
+			parts = append(parts, part)
+			mux.Unlock()
+		}(number, data)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].number < parts[j].number })
+	return parts, nil
+}
+
+// uploadPart uploads a single part, with its MD5 digest in the Content-MD5
+// header, and optionally verifies the ETag reported by the server
+func (obj *S3Object) uploadPart(
+	ctx context.Context, s3Svc *s3.S3, uploadID *string, number int64, data []byte, verify bool,
+) (uploadedPart, error) {
+	digest := md5.Sum(data)
+	input := &s3.UploadPartInput{
+		Bucket:     &obj.Endpoint.Bucket,
+		Key:        &obj.Key,
+		UploadId:   uploadID,
+		PartNumber: aws.Int64(number),
+		Body:       bytes.NewReader(data),
+		ContentMD5: aws.String(base64.StdEncoding.EncodeToString(digest[:])),
+	}
+	// SSE-C requires the key with each part, as well as on creation
+	input.SSECustomerAlgorithm, input.SSECustomerKey = obj.Endpoint.Encryption.customerKey()
+	out, err := s3Svc.UploadPartWithContext(ctx, input)
+	if err != nil {
+		return uploadedPart{}, fmt.Errorf("uploading part %d of %v failed: %v", number, obj, err)
+	}
+	part := uploadedPart{number: number, size: int64(len(data)), digest: digest[:], eTag: aws.StringValue(out.ETag)}
+	if verify {
+		resource := fmt.Sprintf("part %d of %v", number, obj)
+		if err := verifyETag(resource, hex.EncodeToString(digest[:]), out.ETag); err != nil {
+			return part, err
+		}
+	}
+	logging.DefaultLogger().Tracef("Uploaded part %d of %v (%d bytes, MD5 %x, ETag %v)\n", number, obj, part.size, part.digest, part.eTag)
+	return part, nil
+}
+
+// readPart reads exactly the specified number of bytes from the body
+func readPart(body io.Reader, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, fmt.Errorf("error reading %d bytes of upload body: %v", size, err)
+	}
+	return data, nil
+}
+
+// singlePutBody returns a seekable reader over the next length bytes of the
+// body, together with their MD5 digest. A seekable body is read in place;
+// any other body is read into memory, so callers should only pass bodies no
+// larger than a part (see CreateWithMetadata).
+func singlePutBody(body io.Reader, length int64) (section io.ReadSeeker, digest []byte, err error) {
+	rs, ok := body.(io.ReadSeeker)
+	if !ok {
+		data, err := readPart(body, length)
+		if err != nil {
+			return nil, nil, err
+		}
+		sum := md5.Sum(data)
+		return bytes.NewReader(data), sum[:], nil
+	}
+
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, err
+	}
+	ra, ok := rs.(io.ReaderAt)
+	if !ok {
+		ra = seekerReaderAt{rs}
+	}
+	sr := io.NewSectionReader(ra, offset, length)
+	md5Digest := md5.New()
+	n, err := io.Copy(md5Digest, sr)
+	if err == nil && n != length {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		_, err = sr.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %d bytes of upload body: %v", length, err)
+	}
+	return sr, md5Digest.Sum(nil), nil
+}
+
+// seekerReaderAt adapts an io.ReadSeeker to io.ReaderAt, for sequential use
+// by a single reader
+type seekerReaderAt struct {
+	io.ReadSeeker
+}
+
+func (r seekerReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.ReadSeeker, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// verifyETag returns an error if the actual ETag (which may be quoted) does
+// not match the expected value
+func verifyETag(resource string, expected string, actualP *string) error {
+	actual := strings.Trim(aws.StringValue(actualP), `"`)
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("ETag mismatch for %v: expected %v, actual %#v", resource, expected, actual)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// Multipart limit probes
+
+// ProbePartNumber starts a multipart upload for the specified key, uploads a
+// single one-byte part with the specified part number, and aborts the upload,
+// returning any error from the part upload.
+func (e *S3Target) ProbePartNumber(ctx context.Context, key string, partNumber int64) (err error) {
+	return e.withMultipartUpload(ctx, key, true, func(s3Svc *s3.S3, uploadID *string) error {
+		_, err := s3Svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     &e.Bucket,
+			Key:        &key,
+			UploadId:   uploadID,
+			PartNumber: aws.Int64(partNumber),
+			Body:       probeBody(1),
+		})
+		return err
+	})
+}
+
+// ProbePartSizes starts a multipart upload for the specified key, uploads
+// parts of the specified sizes, and completes the upload, returning any
+// error from the part uploads or from completing the upload. The upload is
+// aborted on failure, and the resulting object (if any) is deleted, along
+// with the version created (in a versioned bucket).
+func (e *S3Target) ProbePartSizes(ctx context.Context, key string, partSizes []int64) (err error) {
+	obj := &S3Object{Endpoint: e, Key: key}
+	err = e.withMultipartUpload(ctx, key, false, func(s3Svc *s3.S3, uploadID *string) error {
+		var completed []*s3.CompletedPart
+		for i, size := range partSizes {
+			out, err := s3Svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+				Bucket:     &e.Bucket,
+				Key:        &key,
+				UploadId:   uploadID,
+				PartNumber: aws.Int64(int64(i + 1)),
+				Body:       probeBody(size),
+			})
+			if err != nil {
+				return fmt.Errorf("uploading part %d (%v) failed: %v", i+1, logging.FormatBytes(size), err)
+			}
+			completed = append(completed, &s3.CompletedPart{PartNumber: aws.Int64(int64(i + 1)), ETag: out.ETag})
+		}
+		out, err := s3Svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          &e.Bucket,
+			Key:             &key,
+			UploadId:        uploadID,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+		})
+		if err != nil {
+			return err
+		}
+		obj.recordVersion(out.VersionId)
+		return nil
+	})
+	if err == nil {
+		return obj.Delete(context.WithoutCancel(ctx))
+	}
+	return err
+}
+
+// withMultipartUpload starts a multipart upload and passes its ID to the
+// specified function, aborting the upload afterward if the function fails
+// or if abortAlways is true.
+func (e *S3Target) withMultipartUpload(
+	ctx context.Context, key string, abortAlways bool, fn func(s3Svc *s3.S3, uploadID *string) error,
+) (err error) {
+	s3Svc, err := e.S3()
+	if err != nil {
+		return err
+	}
+	created, err := s3Svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: &e.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return err
+	}
+	err = fn(s3Svc, created.UploadId)
+	if err != nil || abortAlways {
+		upload := MultipartUpload{Key: key, UploadID: *created.UploadId}
+		abortErr := e.AbortMultipartUpload(context.WithoutCancel(ctx), upload)
+		if abortErr != nil {
+			logging.DefaultLogger().Infof("Unable to abort multipart upload %v for %v: %v\n",
+				*created.UploadId, key, logging.FormatError(abortErr))
+		}
+	}
+	return err
+}
+
+// probeBlock is repeated to make up the bodies of probe parts
+var probeBlock = func() []byte {
+	block := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(block)
+	return block
+}()
+
+// probeBody returns a seekable body of the specified size, without holding
+// the whole body in memory
+func probeBody(size int64) io.ReadSeeker {
+	return io.NewSectionReader(repeatingReaderAt(probeBlock), 0, size)
+}
+
+// repeatingReaderAt is an io.ReaderAt of unlimited size, repeating its contents
+type repeatingReaderAt []byte
+
+func (r repeatingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	for n := 0; n < len(p); {
+		start := (off + int64(n)) % int64(len(r))
+		n += copy(p[n:], r[start:])
+	}
+	return len(p), nil
+}
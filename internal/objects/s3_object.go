@@ -1,10 +1,15 @@
 package objects
 
 import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net/url"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -19,12 +24,22 @@ import (
 type S3Object struct {
 	Endpoint *S3Target
 	Key      string
+	// VersionID, if set, addresses a specific version of the object, for
+	// reads and deletes
+	VersionID string
+
+	// created records the versions created by this object in a versioned
+	// bucket, so that Delete can remove them
+	created []string
 }
 
 // ------------------------------
 // Object implementation
 
 func (obj *S3Object) Pretty() string {
+	if obj.VersionID != "" {
+		return fmt.Sprintf("s3://%v/%v (version %v)", obj.Endpoint.Bucket, obj.Key, obj.VersionID)
+	}
 	return fmt.Sprintf("s3://%v/%v", obj.Endpoint.Bucket, obj.Key)
 }
 
@@ -36,8 +51,11 @@ func (obj *S3Object) GetEndpoint() Target {
 	return obj.Endpoint
 }
 
-func (obj *S3Object) ContentLength() (length int64, err error) {
-	h, err := obj.Head()
+func (obj *S3Object) ContentLength(ctx context.Context) (length int64, err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	h, err := obj.Head(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -45,7 +63,7 @@ func (obj *S3Object) ContentLength() (length int64, err error) {
 	if lengthP == nil {
 		logger := logging.DefaultLogger()
 		logger.Tracef("s3.HeadObject() returned nil content-length; trying GetObject()\n")
-		o, err := obj.Get()
+		o, err := obj.Get(ctx)
 		if o != nil {
 			defer func() {
 				if o.Body == nil {
@@ -69,8 +87,8 @@ func (obj *S3Object) ContentLength() (length int64, err error) {
 
 // SupportsRanges returns true if the object supports ranged downloads,
 // false otherwise
-func (obj *S3Object) SupportsRanges() bool {
-	h, err := obj.Head()
+func (obj *S3Object) SupportsRanges(ctx context.Context) bool {
+	h, err := obj.Head(ctx)
 	if err == nil {
 		logger := logging.DefaultLogger()
 		acceptRanges := h.AcceptRanges
@@ -87,81 +105,212 @@ func (obj *S3Object) SupportsRanges() bool {
 	return false
 }
 
-func (obj *S3Object) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
-	if !obj.SupportsRanges() {
+func (obj *S3Object) DownloadRange(ctx context.Context, startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	if !obj.SupportsRanges(ctx) {
 		logging.DefaultLogger().Tracef("object %v may not support ranged downloads; trying anyway\n", obj)
 	}
+	return obj.GetRange(ctx, startInclusive, endInclusive, buffer)
+}
 
-	awsSession, err := obj.Endpoint.Session()
-	if err != nil {
-		return 0, err
-	}
+// Create creates the object, using a single PUT or a multipart upload as
+// determined by the target's MultipartConfig. Multipart uploads are aborted
+// on failure. In a versioned bucket, the new version is recorded, to be
+// removed by Delete.
+func (obj *S3Object) Create(ctx context.Context, body io.Reader, length int64) (err error) {
+	return obj.CreateWithMetadata(ctx, body, length, nil)
+}
 
-	out := aws.NewWriteAtBuffer(buffer)
-	rangeStr := fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive)
-	downloader := s3manager.NewDownloader(awsSession)
-	return downloader.Download(out, &s3.GetObjectInput{
-		Bucket: &obj.Endpoint.Bucket,
-		Key:    &obj.Key,
-		Range:  &rangeStr,
-	})
+// Delete deletes the object. If VersionID is set, that version is deleted
+// permanently. Otherwise, if this object has created any versions in a
+// versioned bucket, those versions are deleted permanently, leaving any
+// earlier versions in place; if not, the latest version is deleted (in a
+// versioned bucket, by creating a delete marker).
+func (obj *S3Object) Delete(ctx context.Context) (err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	if obj.VersionID != "" {
+		return obj.deleteVersion(ctx, obj.versionID())
+	}
+	if len(obj.created) > 0 {
+		for len(obj.created) > 0 {
+			latest := len(obj.created) - 1
+			if err = obj.deleteVersion(ctx, aws.String(obj.created[latest])); err != nil {
+				return err
+			}
+			obj.created = obj.created[:latest]
+		}
+		return nil
+	}
+	return obj.deleteVersion(ctx, nil)
 }
 
-func (obj *S3Object) Create(body io.Reader, length int64) (err error) {
-	awsSession, err := obj.Endpoint.Session()
+// ------------------------------
+// MetadataObject implementation
+
+// CreateWithMetadata creates the object, as with Create, with the specified
+// metadata: Content-Type, Content-Encoding, and Cache-Control headers, user
+// metadata (as x-amz-meta-* headers), and tags
+func (obj *S3Object) CreateWithMetadata(ctx context.Context, body io.Reader, length int64, metadata *Metadata) (err error) {
+	if obj.VersionID != "" {
+		return fmt.Errorf("can't create %v: versions can't be overwritten", obj)
+	}
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	s3Svc, err := obj.Endpoint.S3()
 	if err != nil {
 		return err
 	}
-	logging.DefaultLogger().Detailf("Uploading %d bytes to %v\n", length, obj)
-
-	uploader := s3manager.NewUploader(awsSession)
-	uploader.PartSize = partSize(length)
-	logging.DefaultLogger().Detailf("Set part size to %v\n", logging.FormatBytes(uploader.PartSize))
+	logger := logging.DefaultLogger()
+	logger.Detailf("Uploading %d bytes to %v\n", length, obj)
 
-	result, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: &obj.Endpoint.Bucket,
-		Key:    &obj.Key,
-		Body:   body,
-	})
+	config := obj.Endpoint.Multipart
+	if config.VerifyETags && !obj.Endpoint.Encryption.ETagIsMD5() {
+		logger.Detailf("ETags of objects encrypted with SSE-%v are not MD5 digests; not verifying ETags for %v\n",
+			strings.ToUpper(string(obj.Endpoint.Encryption.Mode)), obj)
+		config.VerifyETags = false
+	}
+	// a body that can't be re-read is only sent with a single PUT if it fits
+	// in memory as a single part; larger bodies are streamed by part
+	ptSize := config.partSizeFor(length)
+	_, seekable := body.(io.ReadSeeker)
+	multipart := config.Mode == UploadMultipart || (config.Mode != UploadSingle && length > ptSize)
+	if !multipart && !seekable && length > ptSize {
+		return fmt.Errorf(
+			"can't upload %v with a single PUT: the body can't be re-read, and its size %d is greater than the part size %d",
+			obj, length, ptSize,
+		)
+	}
+	if multipart {
+		err = obj.putMultipart(ctx, s3Svc, body, length, config, metadata)
+	} else {
+		err = obj.putSingle(ctx, s3Svc, body, length, config.VerifyETags, metadata)
+	}
 	if err == nil {
-		logging.DefaultLogger().Detailf("Uploaded %d bytes to %v\n", length, result.Location)
+		logger.Detailf("Uploaded %d bytes to %v\n", length, obj)
 	}
 	return err
 }
 
-func (obj *S3Object) Delete() (err error) {
-	protocolUriStr := obj
+// Metadata returns the object's metadata and tags. If the service does not
+// support tagging, the tags are left empty.
+func (obj *S3Object) Metadata(ctx context.Context) (*Metadata, error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	h, err := obj.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &Metadata{
+		ContentType:     aws.StringValue(h.ContentType),
+		ContentEncoding: aws.StringValue(h.ContentEncoding),
+		CacheControl:    aws.StringValue(h.CacheControl),
+		User:            userMetadata(aws.StringValueMap(h.Metadata)),
+		ContentLength:   aws.Int64Value(h.ContentLength),
+		ETag:            strings.Trim(aws.StringValue(h.ETag), `"`),
+		LastModified:    aws.TimeValue(h.LastModified),
+		VersionID:       aws.StringValue(h.VersionId),
+		Encryption:      aws.StringValue(h.ServerSideEncryption),
+		KMSKeyID:        aws.StringValue(h.SSEKMSKeyId),
+	}
+	if h.SSECustomerAlgorithm != nil {
+		metadata.Encryption = aws.StringValue(h.SSECustomerAlgorithm)
+		metadata.CustomerKey = true
+	}
+
+	s3Svc, err := obj.Endpoint.S3()
+	if err != nil {
+		return nil, err
+	}
+	tagging, err := s3Svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket:    &obj.Endpoint.Bucket,
+		Key:       &obj.Key,
+		VersionId: obj.versionID(),
+	})
+	if err != nil {
+		logging.DefaultLogger().Tracef("Unable to get tags for %v: %v\n", obj, logging.FormatError(err))
+		return metadata, nil
+	}
+	for _, tag := range tagging.TagSet {
+		if metadata.Tags == nil {
+			metadata.Tags = map[string]string{}
+		}
+		metadata.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return metadata, nil
+}
+
+// ------------------------------
+// MD5Reporter implementation
+
+// ContentMD5 returns the MD5 digest recorded in the object's ETag, or nil if
+// the ETag is not an MD5 digest of the content (as for multipart uploads and
+// objects encrypted with SSE-KMS or SSE-C).
+func (obj *S3Object) ContentMD5(ctx context.Context) ([]byte, error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	h, err := obj.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(h.ServerSideEncryption) == s3.ServerSideEncryptionAwsKms || h.SSECustomerAlgorithm != nil {
+		return nil, nil
+	}
+	return md5FromETag(aws.StringValue(h.ETag)), nil
+}
+
+// ------------------------------
+// RangeGetter implementation
+
+// GetRange downloads the specified byte range, as with DownloadRange, but
+// without first checking (with a HEAD) whether ranges are supported
+func (obj *S3Object) GetRange(ctx context.Context, startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
 	awsSession, err := obj.Endpoint.Session()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	logger := logging.DefaultLogger()
-	logger.Tracef("Deleting %v\n", protocolUriStr)
-	_, err = s3.New(awsSession).DeleteObject(&s3.DeleteObjectInput{
+
+	out := aws.NewWriteAtBuffer(buffer)
+	rangeStr := fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive)
+	input := &s3.GetObjectInput{
 		Bucket: &obj.Endpoint.Bucket,
 		Key:    &obj.Key,
-	})
-	if err == nil {
-		logger.Tracef("Deleted %v\n", protocolUriStr)
-	} else {
-		logger.Tracef("Deleting %v failed: %v", protocolUriStr, logging.FormatError(err))
+		Range:  &rangeStr,
 	}
-	return err
+	input.VersionId = obj.versionID()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = obj.Endpoint.Encryption.customerKey()
+	downloader := s3manager.NewDownloader(awsSession)
+	return downloader.DownloadWithContext(ctx, out, input)
 }
 
 // ------------------------------
 // Miscellaneous methods
 
-func (obj *S3Object) Head() (h *s3.HeadObjectOutput, err error) {
+func (obj *S3Object) Head(ctx context.Context) (h *s3.HeadObjectOutput, err error) {
 	s3Svc, err := obj.Endpoint.S3()
 	if err != nil {
 		return nil, err
 	}
 
-	h, err = s3Svc.HeadObject(&s3.HeadObjectInput{
-		Bucket: &obj.Endpoint.Bucket,
-		Key:    &obj.Key,
-	})
+	input := &s3.HeadObjectInput{
+		Bucket:    &obj.Endpoint.Bucket,
+		Key:       &obj.Key,
+		VersionId: obj.versionID(),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey = obj.Endpoint.Encryption.customerKey()
+	h, err = s3Svc.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
 	if h != nil {
 		return h, nil
 	} else {
@@ -169,16 +318,22 @@ func (obj *S3Object) Head() (h *s3.HeadObjectOutput, err error) {
 	}
 }
 
-func (obj *S3Object) Get() (h *s3.GetObjectOutput, err error) {
+func (obj *S3Object) Get(ctx context.Context) (h *s3.GetObjectOutput, err error) {
 	s3Svc, err := obj.Endpoint.S3()
 	if err != nil {
 		return nil, err
 	}
 
-	h, err = s3Svc.GetObject(&s3.GetObjectInput{
-		Bucket: &obj.Endpoint.Bucket,
-		Key:    &obj.Key,
-	})
+	input := &s3.GetObjectInput{
+		Bucket:    &obj.Endpoint.Bucket,
+		Key:       &obj.Key,
+		VersionId: obj.versionID(),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey = obj.Endpoint.Encryption.customerKey()
+	h, err = s3Svc.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
 	if h != nil {
 		return h, nil
 	} else {
@@ -189,6 +344,16 @@ func (obj *S3Object) Get() (h *s3.GetObjectOutput, err error) {
 // ------------------------------------------------------------
 // Unexported utility functions
 
+// md5FromETag returns the MD5 digest in the specified (possibly quoted) ETag,
+// or nil if the ETag is not a hex MD5 digest
+func md5FromETag(eTag string) []byte {
+	digest, err := hex.DecodeString(strings.Trim(eTag, `"`))
+	if err != nil || len(digest) != md5.Size {
+		return nil
+	}
+	return digest
+}
+
 func numberOfParts(length, partSize int64) int64 {
 	return 1 + ((length - 1) / partSize)
 }
@@ -207,3 +372,36 @@ func partSize(length int64) int64 {
 	}
 	return ptSize
 }
+
+// s3Headers returns the Content-Type, Content-Encoding, and Cache-Control
+// headers to send with a PUT or multipart upload, or nil for those not set
+func s3Headers(metadata *Metadata) (contentType, contentEncoding, cacheControl *string) {
+	optional := func(v string) *string {
+		if v == "" {
+			return nil
+		}
+		return aws.String(v)
+	}
+	return optional(metadata.ContentType), optional(metadata.ContentEncoding), optional(metadata.CacheControl)
+}
+
+// s3Metadata returns the user metadata to send with a PUT or multipart upload
+func s3Metadata(metadata *Metadata) map[string]*string {
+	if len(metadata.User) == 0 {
+		return nil
+	}
+	return aws.StringMap(metadata.User)
+}
+
+// s3Tagging returns the tags to send with a PUT or multipart upload, as a
+// URL-encoded query string
+func s3Tagging(metadata *Metadata) *string {
+	if len(metadata.Tags) == 0 {
+		return nil
+	}
+	tags := url.Values{}
+	for k, v := range metadata.Tags {
+		tags.Set(k, v)
+	}
+	return aws.String(tags.Encode())
+}
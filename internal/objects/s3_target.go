@@ -3,6 +3,7 @@ package objects
 import (
 	"fmt"
 	"net/url"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -12,19 +13,28 @@ import (
 // S3Target type
 
 type S3Target struct {
-	Region   string
-	Endpoint string
-	Bucket   string
+	Region      string
+	Endpoint    string
+	Bucket      string
+	Credentials Credentials
+	// Multipart determines how objects are uploaded
+	Multipart MultipartConfig
+	// Encryption determines how objects are encrypted, and (for SSE-C) read
+	Encryption EncryptionConfig
 
-	awsSession *session.Session
-	s3Svc      *s3.S3
+	clients *s3Clients
 }
 
-func NewS3Target(region string, endpointURL *url.URL, bucket string) *S3Target {
+// NewS3Target creates a new S3Target. Targets must be created with this
+// function (or copied with WithEncryption) so that their clients can be
+// shared safely between goroutines.
+func NewS3Target(region string, endpointURL *url.URL, bucket string, credentials Credentials) *S3Target {
 	return &S3Target{
-		Region:   EnsureS3Region(region, endpointURL),
-		Endpoint: endpointURL.String(),
-		Bucket:   bucket,
+		Region:      EnsureS3Region(region, endpointURL),
+		Endpoint:    endpointURL.String(),
+		Bucket:      bucket,
+		Credentials: credentials,
+		clients:     &s3Clients{},
 	}
 }
 
@@ -46,24 +56,62 @@ func (e *S3Target) String() string {
 // ------------------------------
 // Miscellaneous methods
 
+// WithEncryption returns a copy of this target, sharing its session (whether
+// or not it has been created yet), with the specified encryption configuration
+func (e *S3Target) WithEncryption(config EncryptionConfig) *S3Target {
+	target := *e
+	target.Encryption = config
+	return &target
+}
+
+// Session returns the AWS session for this target, creating it on first use
 func (e *S3Target) Session() (*session.Session, error) {
-	if e.awsSession == nil {
-		awsSession, err := ValidS3Session(&e.Endpoint, &e.Region)
+	if e.clients == nil {
+		return nil, fmt.Errorf("S3Target not created with NewS3Target: %v", e)
+	}
+	e.clients.mu.Lock()
+	defer e.clients.mu.Unlock()
+	return e.session()
+}
+
+// S3 returns the S3 service client for this target, creating it (and the
+// session) on first use
+func (e *S3Target) S3() (*s3.S3, error) {
+	if e.clients == nil {
+		return nil, fmt.Errorf("S3Target not created with NewS3Target: %v", e)
+	}
+	e.clients.mu.Lock()
+	defer e.clients.mu.Unlock()
+	if e.clients.s3Svc == nil {
+		awsSession, err := e.session()
 		if err != nil {
 			return nil, err
 		}
-		e.awsSession = awsSession
+		e.clients.s3Svc = s3.New(awsSession)
 	}
-	return e.awsSession, nil
+	return e.clients.s3Svc, nil
 }
 
-func (e *S3Target) S3() (*s3.S3, error) {
-	if e.s3Svc == nil {
-		awsSession, err := e.Session()
+// ------------------------------------------------------------
+// Unexported symbols
+
+// s3Clients holds the session and service client for an S3Target, shared
+// with any copies made by WithEncryption, and created on first use
+type s3Clients struct {
+	mu         sync.Mutex
+	awsSession *session.Session
+	s3Svc      *s3.S3
+}
+
+// session returns the session, creating it if needed; the caller must hold
+// the clients' lock
+func (e *S3Target) session() (*session.Session, error) {
+	if e.clients.awsSession == nil {
+		awsSession, err := ValidS3Session(&e.Endpoint, &e.Region, e.Credentials)
 		if err != nil {
 			return nil, err
 		}
-		e.s3Svc = s3.New(awsSession)
+		e.clients.awsSession = awsSession
 	}
-	return e.s3Svc, nil
+	return e.clients.awsSession, nil
 }
@@ -0,0 +1,90 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ------------------------------------------------------------
+// MultipartUpload type
+
+// MultipartUpload describes an incomplete S3 multipart upload
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+func (u MultipartUpload) Pretty() string {
+	return fmt.Sprintf("MultipartUpload{ Key: %#v, UploadID: %#v, Initiated: %v }",
+		u.Key, u.UploadID, u.Initiated.Format(time.RFC3339))
+}
+
+func (u MultipartUpload) String() string {
+	return u.Pretty()
+}
+
+// Matches returns true if the upload key begins with the specified prefix
+// (if any), and the upload was initiated before the specified time (if
+// non-zero).
+func (u MultipartUpload) Matches(prefix string, initiatedBefore time.Time) bool {
+	if !strings.HasPrefix(u.Key, prefix) {
+		return false
+	}
+	return initiatedBefore.IsZero() || u.Initiated.Before(initiatedBefore)
+}
+
+// ------------------------------------------------------------
+// S3Target methods
+
+// ListMultipartUploads lists the incomplete multipart uploads in the target
+// bucket with keys beginning with the specified prefix (if any), and initiated
+// before the specified time (if non-zero).
+func (e *S3Target) ListMultipartUploads(ctx context.Context, prefix string, initiatedBefore time.Time) ([]MultipartUpload, error) {
+	s3Svc, err := e.S3()
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.ListMultipartUploadsInput{Bucket: &e.Bucket}
+	if prefix != "" {
+		input.Prefix = &prefix
+	}
+
+	var uploads []MultipartUpload
+	err = s3Svc.ListMultipartUploadsPagesWithContext(ctx, input, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, u := range page.Uploads {
+			upload := MultipartUpload{
+				Key:       aws.StringValue(u.Key),
+				UploadID:  aws.StringValue(u.UploadId),
+				Initiated: aws.TimeValue(u.Initiated),
+			}
+			// S3 has no filter for the initiation time, so that's applied here;
+			// the prefix is checked again for servers that ignore Prefix
+			if upload.Matches(prefix, initiatedBefore) {
+				uploads = append(uploads, upload)
+			}
+		}
+		return true
+	})
+	return uploads, err
+}
+
+// AbortMultipartUpload aborts the specified multipart upload, deleting any
+// parts already uploaded.
+func (e *S3Target) AbortMultipartUpload(ctx context.Context, upload MultipartUpload) error {
+	s3Svc, err := e.S3()
+	if err != nil {
+		return err
+	}
+	_, err = s3Svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &e.Bucket,
+		Key:      &upload.Key,
+		UploadId: &upload.UploadID,
+	})
+	return err
+}
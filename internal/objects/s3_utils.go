@@ -2,15 +2,18 @@ package objects
 
 import (
 	"fmt"
+	"math"
 	"net/url"
 	"os/exec"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 
 	"github.com/dmolesUC3/cos/internal/logging"
@@ -60,8 +63,50 @@ func (*S3Logger) Log(a ...interface{}) {
 	logging.DefaultLogger().Trace(a...)
 }
 
-func ValidS3Session(endpointP *string, regionStrP *string) (awsSession *session.Session, err error) {
-	awsSession, err = InitS3Session(endpointP, regionStrP)
+// s3Retryer implements the request.Retryer interface, applying the RetryPolicy
+// carried by each request's context in place of the AWS SDK's default retries.
+type s3Retryer struct {
+}
+
+func (s3Retryer) RetryRules(r *request.Request) time.Duration {
+	return RetryPolicyFrom(r.Context()).Backoff(r.RetryCount + 1)
+}
+
+func (s3Retryer) ShouldRetry(r *request.Request) bool {
+	return RetryPolicyFrom(r.Context()).ShouldRetry(r.RetryCount+1, s3StatusCode(r), r.Error)
+}
+
+// MaxRetries returns an effectively unlimited number of retries; the actual
+// maximum is enforced by ShouldRetry().
+func (s3Retryer) MaxRetries() int {
+	return math.MaxInt32
+}
+
+// recordS3Attempt records each attempt at an S3 request
+func recordS3Attempt(r *request.Request) {
+	resource := ""
+	if r.HTTPRequest != nil && r.HTTPRequest.URL != nil {
+		resource = r.HTTPRequest.URL.Path
+	}
+	recordAttempt(r.Context(), Attempt{
+		Operation:  r.Operation.Name,
+		Resource:   resource,
+		Number:     r.RetryCount + 1,
+		StatusCode: s3StatusCode(r),
+		Elapsed:    time.Since(r.AttemptTime),
+		Err:        r.Error,
+	})
+}
+
+func s3StatusCode(r *request.Request) int {
+	if r.HTTPResponse == nil {
+		return 0
+	}
+	return r.HTTPResponse.StatusCode
+}
+
+func ValidS3Session(endpointP *string, regionStrP *string, creds Credentials) (awsSession *session.Session, err error) {
+	awsSession, err = InitS3Session(endpointP, regionStrP, creds)
 	if err != nil {
 		return nil, err
 	}
@@ -81,9 +126,9 @@ func ValidS3Session(endpointP *string, regionStrP *string) (awsSession *session.
 	return
 }
 
-// InitS3Session returns a new AWS session configured for S3 access via the specified endpoint and region.
-// The verboseLogging parameter controls whether to return verbose error messages.
-func InitS3Session(endpointP *string, regionStrP *string) (*session.Session, error) {
+// InitS3Session returns a new AWS session configured for S3 access via the specified endpoint and region,
+// using the specified credentials.
+func InitS3Session(endpointP *string, regionStrP *string, creds Credentials) (*session.Session, error) {
 	logger := logging.DefaultLogger()
 	verboseLogging := logger.MaxLevel() >= logging.Trace
 	s3Config := aws.Config{
@@ -91,7 +136,9 @@ func InitS3Session(endpointP *string, regionStrP *string) (*session.Session, err
 		Region:                        regionStrP,
 		S3ForcePathStyle:              aws.Bool(true),
 		CredentialsChainVerboseErrors: aws.Bool(verboseLogging),
+		EnforceShouldRetryCheck:       aws.Bool(true),
 	}
+	request.WithRetryer(&s3Config, s3Retryer{})
 	if verboseLogging {
 		s3Config.LogLevel = aws.LogLevel(aws.LogDebugWithRequestErrors | aws.LogDebugWithRequestRetries)
 		s3Config.Logger = &S3Logger{}
@@ -101,17 +148,24 @@ func InitS3Session(endpointP *string, regionStrP *string) (*session.Session, err
 		Config:            s3Config,
 		SharedConfigState: session.SharedConfigEnable,
 	}
+	switch creds.Source {
+	case CredentialsFromAWSProfile:
+		s3Opts.Profile = creds.AWSProfile
+	case CredentialsStatic:
+		s3Opts.Config.Credentials = credentials.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, "")
+	}
 	awsSession, err := session.NewSessionWithOptions(s3Opts)
 	if err != nil {
 		return nil, err
 	}
+	awsSession.Handlers.CompleteAttempt.PushBack(recordS3Attempt)
 	return awsSession, nil
 }
 
 // DisallowIAMFallback uses reflection to check whether we're falling back to IAM credentials
 // See https://github.com/aws/aws-sdk-go/issues/2392
 func DisallowIAMFallback(awsSession *session.Session) (*session.Session, error) {
-	providerVal := reflect.ValueOf(*awsSession.Config.Credentials).FieldByName("provider").Elem()
+	providerVal := reflect.ValueOf(awsSession.Config.Credentials).Elem().FieldByName("provider").Elem()
 	if providerVal.Type() == reflect.TypeOf((*credentials.ChainProvider)(nil)) {
 		chainProvider := (*credentials.ChainProvider)(unsafe.Pointer(providerVal.Pointer()))
 		providers := chainProvider.Providers
@@ -0,0 +1,191 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// ------------------------------------------------------------
+// S3Target methods
+
+// VersioningStatus returns the versioning status of the target bucket:
+// "Enabled", "Suspended", or the empty string if versioning has never been
+// enabled.
+func (e *S3Target) VersioningStatus(ctx context.Context) (string, error) {
+	s3Svc, err := e.S3()
+	if err != nil {
+		return "", err
+	}
+	out, err := s3Svc.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: &e.Bucket})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.Status), nil
+}
+
+// ------------------------------------------------------------
+// VersionedObject implementation
+
+// Version returns an object addressing the specified version of this object
+// (or, for the empty string, the latest version)
+func (obj *S3Object) Version(versionID string) VersionedObject {
+	return &S3Object{Endpoint: obj.Endpoint, Key: obj.Key, VersionID: versionID}
+}
+
+func (obj *S3Object) CurrentVersionID() string {
+	return obj.VersionID
+}
+
+func (obj *S3Object) CreatedVersions() []string {
+	return append([]string(nil), obj.created...)
+}
+
+// Versions lists the versions and delete markers of the object, newest first
+func (obj *S3Object) Versions(ctx context.Context) ([]ObjectVersion, error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	s3Svc, err := obj.Endpoint.S3()
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.ListObjectVersionsInput{Bucket: &obj.Endpoint.Bucket, Prefix: &obj.Key}
+
+	var versions []ObjectVersion
+	err = s3Svc.ListObjectVersionsPagesWithContext(ctx, input, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		// versions and delete markers are listed separately, but each is
+		// sorted by key and then newest first
+		for _, v := range page.Versions {
+			if aws.StringValue(v.Key) != obj.Key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				VersionID:    aws.StringValue(v.VersionId),
+				IsLatest:     aws.BoolValue(v.IsLatest),
+				Size:         aws.Int64Value(v.Size),
+				ETag:         strings.Trim(aws.StringValue(v.ETag), `"`),
+				LastModified: aws.TimeValue(v.LastModified),
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			if aws.StringValue(m.Key) != obj.Key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				VersionID:    aws.StringValue(m.VersionId),
+				IsLatest:     aws.BoolValue(m.IsLatest),
+				DeleteMarker: true,
+				LastModified: aws.TimeValue(m.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// RestoreVersion copies the specified version over the latest version (with
+// the target's encryption configuration), returning the ID of the new
+// version, which is recorded to be removed by Delete
+func (obj *S3Object) RestoreVersion(ctx context.Context, versionID string) (string, error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	if obj.VersionID != "" {
+		return "", fmt.Errorf("can't restore over %v: versions can't be overwritten", obj)
+	}
+	s3Svc, err := obj.Endpoint.S3()
+	if err != nil {
+		return "", err
+	}
+	source := fmt.Sprintf("%v/%v?versionId=%v", obj.Endpoint.Bucket, url.PathEscape(obj.Key), url.QueryEscape(versionID))
+	input := &s3.CopyObjectInput{
+		Bucket:     &obj.Endpoint.Bucket,
+		Key:        &obj.Key,
+		CopySource: &source,
+	}
+	encryption := obj.Endpoint.Encryption
+	input.ServerSideEncryption, input.SSEKMSKeyId = encryption.sseHeaders()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = encryption.customerKey()
+	input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey = encryption.customerKey()
+	out, err := s3Svc.CopyObjectWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	obj.recordVersion(out.VersionId)
+	logging.DefaultLogger().Detailf("Restored version %v of %v as version %v\n", versionID, obj, aws.StringValue(out.VersionId))
+	return aws.StringValue(out.VersionId), nil
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// versionID returns the version ID to send with a request, or nil for the
+// latest version
+func (obj *S3Object) versionID() *string {
+	if obj.VersionID == "" {
+		return nil
+	}
+	return aws.String(obj.VersionID)
+}
+
+// recordVersion records a version created by this object, if the bucket is
+// versioned
+func (obj *S3Object) recordVersion(versionID *string) {
+	if v := aws.StringValue(versionID); v != "" {
+		obj.created = append(obj.created, v)
+	}
+}
+
+// deleteVersion deletes the specified version permanently, or (if nil) the
+// latest version
+func (obj *S3Object) deleteVersion(ctx context.Context, versionID *string) error {
+	s3Svc, err := obj.Endpoint.S3()
+	if err != nil {
+		return err
+	}
+	description := obj.Pretty()
+	if versionID != nil && obj.VersionID == "" {
+		description = fmt.Sprintf("%v (version %v)", obj, *versionID)
+	}
+	logger := logging.DefaultLogger()
+	logger.Tracef("Deleting %v\n", description)
+	out, err := s3Svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:    &obj.Endpoint.Bucket,
+		Key:       &obj.Key,
+		VersionId: versionID,
+	})
+	if err != nil {
+		logger.Tracef("Deleting %v failed: %v", description, logging.FormatError(err))
+		return err
+	}
+	if versionID == nil && aws.BoolValue(out.DeleteMarker) {
+		logger.Tracef("Deleted %v (delete marker %v)\n", description, aws.StringValue(out.VersionId))
+	} else {
+		logger.Tracef("Deleted %v\n", description)
+	}
+	return nil
+}
+
+// sortVersions sorts versions newest first, with the latest version first
+// among any with the same modification time
+func sortVersions(versions []ObjectVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, vj := versions[i], versions[j]
+		if vi.IsLatest != vj.IsLatest {
+			return vi.IsLatest
+		}
+		return vi.LastModified.After(vj.LastModified)
+	})
+}
@@ -0,0 +1,82 @@
+package objects
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/bytefmt"
+)
+
+const (
+	// DefaultLargeObjectThreshold is the object size above which Swift objects
+	// are created as large objects
+	DefaultLargeObjectThreshold = int64(2 * bytefmt.GIGABYTE)
+	// DefaultSegmentSize is the default Swift large object segment size
+	DefaultSegmentSize = int64(100 * bytefmt.MEGABYTE)
+)
+
+// ------------------------------------------------------------
+// LargeObjectType type
+
+// LargeObjectType is the kind of manifest used for Swift large objects
+type LargeObjectType string
+
+const (
+	// StaticLargeObject (SLO) manifests list their segments explicitly
+	StaticLargeObject LargeObjectType = "slo"
+	// DynamicLargeObject (DLO) manifests include all segments with a given prefix
+	DynamicLargeObject LargeObjectType = "dlo"
+)
+
+// ParseLargeObjectType parses the specified string as a LargeObjectType,
+// with the empty string indicating StaticLargeObject.
+func ParseLargeObjectType(s string) (LargeObjectType, error) {
+	switch LargeObjectType(s) {
+	case "", StaticLargeObject:
+		return StaticLargeObject, nil
+	case DynamicLargeObject:
+		return DynamicLargeObject, nil
+	}
+	return "", fmt.Errorf("unsupported large object type: %#v (expected %#v or %#v)", s, StaticLargeObject, DynamicLargeObject)
+}
+
+// ------------------------------------------------------------
+// LargeObjectConfig type
+
+// LargeObjectConfig determines how large Swift objects are created. Zero
+// values indicate the defaults.
+type LargeObjectConfig struct {
+	// Type is the kind of manifest to create (default StaticLargeObject)
+	Type LargeObjectType
+	// Threshold is the object size above which large objects are created
+	// (default DefaultLargeObjectThreshold)
+	Threshold int64
+	// SegmentSize is the segment size (default DefaultSegmentSize)
+	SegmentSize int64
+	// SegmentContainer is the container for segments (default "<container>_segments")
+	SegmentContainer string
+}
+
+// WithDefaults returns a copy of this configuration, with defaults filled in
+// for any unset values
+func (c LargeObjectConfig) WithDefaults() LargeObjectConfig {
+	result := c
+	if result.Type == "" {
+		result.Type = StaticLargeObject
+	}
+	if result.Threshold <= 0 {
+		result.Threshold = DefaultLargeObjectThreshold
+	}
+	if result.SegmentSize <= 0 {
+		result.SegmentSize = DefaultSegmentSize
+	}
+	return result
+}
+
+func (c LargeObjectConfig) Pretty() string {
+	return fmt.Sprintf("LargeObjectConfig{ Type: %v, Threshold: %d, SegmentSize: %d, SegmentContainer: %#v }",
+		c.Type, c.Threshold, c.SegmentSize, c.SegmentContainer)
+}
+
+func (c LargeObjectConfig) String() string {
+	return c.Pretty()
+}
@@ -1,20 +1,18 @@
 package objects
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
-	"code.cloudfoundry.org/bytefmt"
-	"github.com/ncw/swift"
+	"github.com/ncw/swift/v2"
 
 	"github.com/dmolesUC3/cos/internal/logging"
 	"github.com/dmolesUC3/cos/internal/streaming"
 )
 
-const (
-	dloSizeThreshold = int64(2 * bytefmt.GIGABYTE)
-)
-
 type SwiftObject struct {
 	Endpoint  *SwiftTarget
 	Container string
@@ -36,57 +34,192 @@ func (obj *SwiftObject) GetEndpoint() Target {
 	return obj.Endpoint
 }
 
-func (obj *SwiftObject) ContentLength() (length int64, err error) {
+func (obj *SwiftObject) ContentLength(ctx context.Context) (length int64, err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
 	cnx, err := obj.Endpoint.Connection()
 	if err != nil {
 		return 0, err
 	}
-	info, _, err := cnx.Object(obj.Container, obj.Name)
+	err = withRetries(ctx, "HEAD", obj.Pretty(), func(ctx context.Context) error {
+		info, _, err := cnx.Object(ctx, obj.Container, obj.Name)
+		length = info.Bytes
+		return err
+	}, swiftStatusCode)
 	if err != nil {
 		return 0, err
 	}
-	return info.Bytes, nil
+	return length, nil
 }
 
-func (obj *SwiftObject) DownloadRange(startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+func (obj *SwiftObject) DownloadRange(ctx context.Context, startInclusive, endInclusive int64, buffer []byte) (n int64, err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
 	cnx, err := obj.Endpoint.Connection()
 	if err != nil {
 		return 0, err
 	}
 	rangeStr := fmt.Sprintf("bytes=%d-%d", startInclusive, endInclusive)
 	headers := map[string]string{"Range": rangeStr}
-	file, _, err := cnx.ObjectOpen(obj.Container, obj.Name, false, headers)
+	err = withRetries(ctx, "GET", obj.Pretty(), func(ctx context.Context) error {
+		file, _, err := cnx.ObjectOpen(ctx, obj.Container, obj.Name, false, headers)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				logging.DefaultLogger().Tracef("Error closing download stream: %v\n", err)
+			}
+		}()
+		return streaming.ReadExactly(file, buffer)
+	}, swiftStatusCode)
 	if err != nil {
 		return 0, err
 	}
-	err = streaming.ReadExactly(file, buffer)
+	return int64(len(buffer)), nil
+}
+
+// Create creates the object. If the body is an io.Seeker, failed uploads
+// are retried according to the RetryPolicy carried by the context; otherwise,
+// only a single attempt is made.
+func (obj *SwiftObject) Create(ctx context.Context, body io.Reader, length int64) (err error) {
+	return obj.CreateWithMetadata(ctx, body, length, nil)
+}
+
+// Delete deletes the object. If the object is a static or dynamic large
+// object, its segments are deleted as well.
+func (obj *SwiftObject) Delete(ctx context.Context) (err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	cnx, err := obj.Endpoint.Connection()
+	if err != nil {
+		return err
+	}
+
+	var headers swift.Headers
+	err = withRetries(ctx, "HEAD", obj.Pretty(), func(ctx context.Context) error {
+		_, headers, err = cnx.Object(ctx, obj.Container, obj.Name)
+		return err
+	}, swiftStatusCode)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return int64(len(buffer)), nil
+
+	logger := logging.DefaultLogger()
+	logger.Tracef("Deleting %v\n", obj)
+	err = withRetries(ctx, "DELETE", obj.Pretty(), func(ctx context.Context) error {
+		if headers.IsLargeObject() {
+			// deletes the manifest and all segments
+			return cnx.LargeObjectDelete(ctx, obj.Container, obj.Name)
+		}
+		return cnx.ObjectDelete(ctx, obj.Container, obj.Name)
+	}, swiftStatusCode)
+	if err == nil {
+		logger.Tracef("Deleted %v\n", obj)
+	} else {
+		logger.Tracef("Deleting %v failed: %v", obj, err)
+	}
+	return err
 }
 
-func (obj *SwiftObject) Create(body io.Reader, length int64) (err error) {
+// ------------------------------
+// MetadataObject implementation
+
+// CreateWithMetadata creates the object, as with Create, with the specified
+// metadata: Content-Type, Content-Encoding, and Cache-Control headers, and
+// user metadata (as X-Object-Meta-* headers). Swift does not support tags.
+func (obj *SwiftObject) CreateWithMetadata(ctx context.Context, body io.Reader, length int64, metadata *Metadata) (err error) {
+	if metadata != nil && len(metadata.Tags) > 0 {
+		return fmt.Errorf("object tags are not supported by Swift: %v", obj)
+	}
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
 	cnx, err := obj.Endpoint.Connection()
 	if err != nil {
 		return err
 	}
 
+	seeker, seekable := body.(io.Seeker)
+	if !seekable {
+		ctx = WithRetryPolicy(ctx, RetryPolicy{MaxAttempts: 1})
+	}
+	attempts := 0
+	return withRetries(ctx, "PUT", obj.Pretty(), func(ctx context.Context) error {
+		if attempts++; attempts > 1 {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		return obj.create(ctx, cnx, body, length, swiftHeaders(metadata))
+	}, swiftStatusCode)
+}
+
+// Metadata returns the object's metadata
+func (obj *SwiftObject) Metadata(ctx context.Context) (metadata *Metadata, err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	cnx, err := obj.Endpoint.Connection()
+	if err != nil {
+		return nil, err
+	}
+	err = withRetries(ctx, "HEAD", obj.Pretty(), func(ctx context.Context) error {
+		info, headers, err := cnx.Object(ctx, obj.Container, obj.Name)
+		if err == nil {
+			metadata = &Metadata{
+				ContentType:     info.ContentType,
+				ContentEncoding: headers["Content-Encoding"],
+				CacheControl:    headers["Cache-Control"],
+				User:            userMetadata(headers.ObjectMetadata()),
+				ContentLength:   info.Bytes,
+				ETag:            strings.Trim(headers["Etag"], `"`),
+				LastModified:    info.LastModified,
+			}
+		}
+		return err
+	}, swiftStatusCode)
+	return metadata, err
+}
+
+// ------------------------------
+// MD5Reporter implementation
+
+// ContentMD5 returns the MD5 digest recorded in the object's ETag, or nil if
+// the object is a static or dynamic large object.
+func (obj *SwiftObject) ContentMD5(ctx context.Context) (digest []byte, err error) {
+	ctx, cancel := operationContext(ctx)
+	defer cancel()
+
+	cnx, err := obj.Endpoint.Connection()
+	if err != nil {
+		return nil, err
+	}
+	err = withRetries(ctx, "HEAD", obj.Pretty(), func(ctx context.Context) error {
+		info, headers, err := cnx.Object(ctx, obj.Container, obj.Name)
+		if err == nil && !headers.IsLargeObject() {
+			digest = md5FromETag(info.Hash)
+		}
+		return err
+	}, swiftStatusCode)
+	return digest, err
+}
+
+// ------------------------------
+// Unexported functions
+
+func (obj *SwiftObject) create(ctx context.Context, cnx *swift.Connection, body io.Reader, length int64, headers swift.Headers) (err error) {
 	logger := logging.DefaultLogger()
 	var out io.WriteCloser
-	if length <= dloSizeThreshold { // 2 GiB
-		out, err = cnx.ObjectCreate(obj.Container, obj.Name, false, "", "", nil)
+	loConfig := obj.Endpoint.LargeObjects.WithDefaults()
+	if length <= loConfig.Threshold {
+		// with checkHash, Close() fails if the returned ETag doesn't match the MD5 digest
+		out, err = cnx.ObjectCreate(ctx, obj.Container, obj.Name, obj.Endpoint.VerifyETags, "", "", headers)
 	} else {
-		logger.Tracef(
-			"Object size %d is greater than single-object maximum %d; creating dynamic large object\n",
-			length, dloSizeThreshold,
-		)
-		dloOpts := swift.LargeObjectOpts{
-			Container:  obj.Container,
-			ObjectName: obj.Name,
-			ChunkSize:  streaming.DefaultRangeSize, // 5 MiB
-		}
-		out, err = cnx.DynamicLargeObjectCreateFile(&dloOpts)
+		out, err = obj.createLargeObject(ctx, cnx, loConfig, length, headers)
 	}
 	if err != nil {
 		logger.Tracef("Error opening upload stream: %v\n", err)
@@ -94,14 +227,20 @@ func (obj *SwiftObject) Create(body io.Reader, length int64) (err error) {
 	}
 
 	defer func() {
-		err := out.Close()
-		if err != nil {
-			logger.Tracef("Error closing upload stream: %v\n", err)
+		// the server response (and thus any error) is only available on close
+		closeErr := closeWithContext(ctx, out)
+		if closeErr != nil {
+			logger.Tracef("Error closing upload stream: %v\n", closeErr)
+			if err == nil {
+				err = closeErr
+			}
 		}
 	}()
 
+	// large object segments are written with context.Background(), so check
+	// the context between reads instead
 	buffer := make([]byte, streaming.DefaultRangeSize)
-	written, err := io.CopyBuffer(out, body, buffer)
+	written, err := io.CopyBuffer(out, &contextReader{ctx: ctx, r: body}, buffer)
 	if err != nil {
 		logger.Tracef("Error writing to upload stream: %v\n", err)
 	}
@@ -109,22 +248,86 @@ func (obj *SwiftObject) Create(body io.Reader, length int64) (err error) {
 	return err
 }
 
-func (obj *SwiftObject) Delete() (err error) {
-	cnx, err := obj.Endpoint.Connection()
-	if err != nil {
-		return err
-	}
-
-	// TODO: detect DynamicLargeObjects
-	err = cnx.ObjectDelete(obj.Container, obj.Name)
+// createLargeObject opens an upload stream for a static or dynamic large
+// object, falling back to a dynamic large object if the server does not
+// support static large objects
+func (obj *SwiftObject) createLargeObject(
+	ctx context.Context, cnx *swift.Connection, loConfig LargeObjectConfig, length int64, headers swift.Headers,
+) (swift.LargeObjectFile, error) {
 	logger := logging.DefaultLogger()
-	logger.Tracef("Deleting %v\n", obj)
-	if err == nil {
-		logger.Tracef("Deleted %v\n", obj)
+	opts := swift.LargeObjectOpts{
+		Container:        obj.Container,
+		ObjectName:       obj.Name,
+		Headers:          headers,
+		ChunkSize:        loConfig.SegmentSize,
+		SegmentContainer: loConfig.SegmentContainer,
+	}
+	if loConfig.Type == StaticLargeObject {
+		logger.Tracef(
+			"Object size %d is greater than large object threshold %d; creating static large object with %d-byte segments\n",
+			length, loConfig.Threshold, loConfig.SegmentSize,
+		)
+		out, err := cnx.StaticLargeObjectCreate(ctx, &opts)
+		if err != swift.SLONotSupported {
+			return out, err
+		}
+		logger.Infof("Static large objects not supported by %v; falling back to dynamic large object\n", obj.Endpoint.AuthURL)
 	} else {
-		logger.Tracef("Deleting %v failed: %v", obj, err)
+		logger.Tracef(
+			"Object size %d is greater than large object threshold %d; creating dynamic large object with %d-byte segments\n",
+			length, loConfig.Threshold, loConfig.SegmentSize,
+		)
 	}
-	return err
+	return cnx.DynamicLargeObjectCreate(ctx, &opts)
+}
+
+// closeWithContext closes the upload stream, with the specified context if
+// the stream supports it (as large object streams do)
+func closeWithContext(ctx context.Context, out io.WriteCloser) error {
+	if lo, ok := out.(swift.LargeObjectFile); ok {
+		return lo.CloseWithContext(ctx)
+	}
+	return out.Close()
+}
 
+// contextReader is an io.Reader that fails with the context's error once the
+// context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
 }
 
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// swiftHeaders returns the headers to send with a PUT for the specified
+// metadata
+func swiftHeaders(metadata *Metadata) swift.Headers {
+	if metadata == nil {
+		return nil
+	}
+	headers := swift.Metadata(metadata.User).ObjectHeaders()
+	for k, v := range map[string]string{
+		"Content-Type":     metadata.ContentType,
+		"Content-Encoding": metadata.ContentEncoding,
+		"Cache-Control":    metadata.CacheControl,
+	} {
+		if v != "" {
+			headers[k] = v
+		}
+	}
+	return headers
+}
+
+// swiftStatusCode returns the HTTP status code of a Swift error, or 0 if none
+func swiftStatusCode(err error) int {
+	var swiftErr *swift.Error
+	if errors.As(err, &swiftErr) {
+		return swiftErr.StatusCode
+	}
+	return 0
+}
@@ -4,15 +4,22 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"os"
+	"sync"
 
-	"github.com/ncw/swift"
+	"github.com/ncw/swift/v2"
 )
 
 const (
 	SwiftUserEnvVar = "ST_USER"
 	SwiftKeyEnvVar  = "ST_KEY"
-	defaultRetries  = 3
+
+	// fallback environment variables used by the OpenStack command line clients
+	openStackUserEnvVar = "OS_USERNAME"
+	openStackKeyEnvVar  = "OS_PASSWORD"
+
+	// retries within the Swift client (mainly on token expiry); other
+	// failures are retried as determined by the RetryPolicy
+	authRetries = 1
 )
 
 // ------------------------------------------------------------
@@ -23,22 +30,66 @@ type SwiftTarget struct {
 	APIKey    string
 	AuthURL   *url.URL
 	Container string
-	cnx       *swift.Connection
+	Keystone  Keystone
+	// LargeObjects determines how objects larger than the threshold are created
+	LargeObjects LargeObjectConfig
+	// VerifyETags determines whether the ETag of each (non-large) object
+	// created is checked against its MD5 digest
+	VerifyETags bool
+
+	cnx   *swift.Connection
+	cnxMu sync.Mutex
 }
 
 // ------------------------------
 // Factory method
 
-func NewSwiftEndpoint(endpointUrl *url.URL, container string) (*SwiftTarget, error) {
-	swiftAPIUser := os.Getenv(SwiftUserEnvVar)
-	if swiftAPIUser == "" {
-		return nil, errors.New("missing environment variable $" + SwiftUserEnvVar)
+func NewSwiftEndpoint(endpointUrl *url.URL, container string, creds Credentials) (*SwiftTarget, error) {
+	keystone, err := creds.Keystone.WithEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	switch swift.EndpointType(keystone.Interface) {
+	case "", swift.EndpointTypePublic, swift.EndpointTypeInternal, swift.EndpointTypeAdmin:
+	default:
+		return nil, fmt.Errorf("unsupported Keystone endpoint interface: %#v", keystone.Interface)
 	}
-	swiftAPIKey := os.Getenv(SwiftKeyEnvVar)
-	if swiftAPIKey == "" {
-		return nil, errors.New("missing environment variable $" + SwiftKeyEnvVar)
+	target := &SwiftTarget{
+		AuthURL:      endpointUrl,
+		Container:    container,
+		Keystone:     keystone,
+		LargeObjects: LargeObjectConfig{}.WithDefaults(),
+	}
+
+	if creds.Source == CredentialsStatic {
+		if creds.SwiftUser == "" || creds.SwiftKey == "" {
+			return nil, errors.New("static Swift credentials require both user and key")
+		}
+		target.UserName, target.APIKey = creds.SwiftUser, creds.SwiftKey
+		return target, nil
+	}
+	if creds.Source != CredentialsFromEnv && creds.Source != "" {
+		return nil, fmt.Errorf("unsupported credentials source for Swift: %v", creds.Source)
+	}
+
+	userEnvVar := creds.SwiftUserEnvVar
+	if userEnvVar == "" {
+		userEnvVar = SwiftUserEnvVar
+	}
+	keyEnvVar := creds.SwiftKeyEnvVar
+	if keyEnvVar == "" {
+		keyEnvVar = SwiftKeyEnvVar
+	}
+
+	setFromEnv(&target.UserName, userEnvVar, openStackUserEnvVar)
+	if target.UserName == "" {
+		return nil, fmt.Errorf("missing environment variable $%v (or $%v)", userEnvVar, openStackUserEnvVar)
 	}
-	return &SwiftTarget{UserName: swiftAPIUser, APIKey: swiftAPIKey, AuthURL: endpointUrl, Container: container}, nil
+	setFromEnv(&target.APIKey, keyEnvVar, openStackKeyEnvVar)
+	if target.APIKey == "" {
+		return nil, fmt.Errorf("missing environment variable $%v (or $%v)", keyEnvVar, openStackKeyEnvVar)
+	}
+	return target, nil
 }
 
 // ------------------------------
@@ -63,8 +114,8 @@ func (e *SwiftTarget) Pretty() string {
 		authURLStr = e.AuthURL.String()
 	}
 
-	return fmt.Sprintf("SwiftTarget { Username: %#v, APIKey: %v, AuthURL: %#v, Container: %#v }",
-		e.UserName, apiKeyStr, authURLStr, e.Container)
+	return fmt.Sprintf("SwiftTarget { Username: %#v, APIKey: %v, AuthURL: %#v, Container: %#v, Keystone: %v, LargeObjects: %v }",
+		e.UserName, apiKeyStr, authURLStr, e.Container, e.Keystone, e.LargeObjects)
 }
 
 func (e *SwiftTarget) String() string {
@@ -74,19 +125,63 @@ func (e *SwiftTarget) String() string {
 // ------------------------------
 // Miscellaneous methods
 
+// Connection returns a Swift connection for this target. Connections (and
+// thus auth tokens) are shared between all targets with the same auth URL,
+// credentials, and Keystone settings.
 func (e *SwiftTarget) Connection() (*swift.Connection, error) {
+	e.cnxMu.Lock()
+	defer e.cnxMu.Unlock()
 	if e.cnx == nil {
 		authUrl := e.AuthURL
 		if authUrl == nil {
 			return nil, fmt.Errorf("authUrl not set in SwiftTarget: %v", e)
 		}
-		authUrlStr := authUrl.String()
-		e.cnx = &swift.Connection{
+		e.cnx = sharedConnection(connectionKey{
 			UserName: e.UserName,
-			ApiKey:   e.APIKey,
-			AuthUrl:  authUrlStr,
-			Retries:  defaultRetries,
-		}
+			APIKey:   e.APIKey,
+			AuthURL:  authUrl.String(),
+			Keystone: e.Keystone,
+		})
 	}
 	return e.cnx, nil
 }
+
+// ------------------------------------------------------------
+// Unexported symbols
+
+type connectionKey struct {
+	UserName string
+	APIKey   string
+	AuthURL  string
+	Keystone Keystone
+}
+
+var (
+	connections   = map[connectionKey]*swift.Connection{}
+	connectionsMu sync.Mutex
+)
+
+// sharedConnection returns the connection for the specified settings,
+// creating it if it does not already exist
+func sharedConnection(key connectionKey) *swift.Connection {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+	if cnx, ok := connections[key]; ok {
+		return cnx
+	}
+	cnx := &swift.Connection{
+		UserName:     key.UserName,
+		ApiKey:       key.APIKey,
+		AuthUrl:      key.AuthURL,
+		AuthVersion:  key.Keystone.AuthVersion,
+		Domain:       key.Keystone.UserDomain,
+		Tenant:       key.Keystone.Project,
+		TenantId:     key.Keystone.ProjectID,
+		TenantDomain: key.Keystone.ProjectDomain,
+		Region:       key.Keystone.Region,
+		EndpointType: swift.EndpointType(key.Keystone.Interface),
+		Retries:      authRetries,
+	}
+	connections[key] = cnx
+	return cnx
+}
@@ -16,14 +16,49 @@ type Target interface {
 	Pretty() string
 }
 
-func NewTarget(endpointURL *url.URL, bucketURL *url.URL, region string) (Target, error) {
+// TargetConfig holds optional settings for creating a Target
+type TargetConfig struct {
+	// Region is the AWS region (S3; if not set, determined from the endpoint URL)
+	// or the Keystone region (Swift; if not set in the Keystone credentials)
+	Region string
+	// Credentials determines how the target obtains credentials
+	Credentials Credentials
+	// LargeObjects determines how large objects are created (Swift only)
+	LargeObjects LargeObjectConfig
+	// Multipart determines how objects are uploaded (S3 only, except for
+	// VerifyETags, which also applies to Swift)
+	Multipart MultipartConfig
+	// Encryption determines how objects are encrypted at rest (S3 only)
+	Encryption EncryptionConfig
+}
+
+func NewTarget(endpointURL *url.URL, bucketURL *url.URL, config TargetConfig) (Target, error) {
 	protocol := bucketURL.Scheme
 	bucket := bucketURL.Host
 
 	if protocol == protocolSwift {
-		return NewSwiftEndpoint(endpointURL, bucket)
+		if config.Encryption.Enabled() {
+			return nil, fmt.Errorf("server-side encryption (%v) is not supported for Swift", config.Encryption.Mode)
+		}
+		creds := config.Credentials
+		if creds.Keystone.Region == "" {
+			creds.Keystone.Region = config.Region
+		}
+		target, err := NewSwiftEndpoint(endpointURL, bucket, creds)
+		if err != nil {
+			return nil, err
+		}
+		target.LargeObjects = config.LargeObjects.WithDefaults()
+		target.VerifyETags = config.Multipart.VerifyETags
+		return target, nil
 	} else if protocol == protocolS3 {
-		return NewS3Target(region, endpointURL, bucket), nil
+		target := NewS3Target(config.Region, endpointURL, bucket, config.Credentials)
+		target.Multipart = config.Multipart
+		if err := config.Encryption.Validate(); err != nil {
+			return nil, err
+		}
+		target.Encryption = config.Encryption
+		return target, nil
 	}
 	return nil, fmt.Errorf("unsupported protocol: %#v", protocol)
 }
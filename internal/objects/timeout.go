@@ -0,0 +1,36 @@
+package objects
+
+import (
+	"context"
+	"time"
+)
+
+type operationTimeoutKey struct{}
+
+// WithOperationTimeout returns a copy of the parent context carrying the
+// specified per-operation timeout. Object implementations apply this timeout
+// to each individual operation (Create, ContentLength, DownloadRange, Delete)
+// in addition to any deadline on the context itself. A timeout of zero or
+// less means no per-operation limit.
+func WithOperationTimeout(parent context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(parent, operationTimeoutKey{}, timeout)
+}
+
+// OperationTimeout returns the per-operation timeout carried by the specified
+// context, or zero if none has been set.
+func OperationTimeout(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(operationTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return 0
+}
+
+// operationContext returns a context for a single operation, bounded by the
+// per-operation timeout (if any) carried by the specified context.
+func operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := OperationTimeout(ctx)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
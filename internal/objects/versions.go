@@ -0,0 +1,54 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ------------------------------------------------------------
+// ObjectVersion type
+
+// ObjectVersion describes a version of an object, or a delete marker, in a
+// versioned bucket
+type ObjectVersion struct {
+	VersionID    string    `json:"version_id"`
+	IsLatest     bool      `json:"is_latest"`
+	DeleteMarker bool      `json:"delete_marker,omitempty"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+func (v ObjectVersion) Pretty() string {
+	return fmt.Sprintf("ObjectVersion{ VersionID: %#v, IsLatest: %v, DeleteMarker: %v, Size: %d, ETag: %#v, LastModified: %v }",
+		v.VersionID, v.IsLatest, v.DeleteMarker, v.Size, v.ETag, v.LastModified.Format(time.RFC3339))
+}
+
+func (v ObjectVersion) String() string {
+	return v.Pretty()
+}
+
+// ------------------------------------------------------------
+// VersionedObject interface
+
+// VersionedObject is implemented by objects that support versioning
+type VersionedObject interface {
+	Object
+
+	// Version returns the object addressing the specified version (or, for
+	// the empty string, the latest version)
+	Version(versionID string) VersionedObject
+	// CurrentVersionID returns the version ID addressed by this object, or
+	// the empty string for the latest version
+	CurrentVersionID() string
+	// CreatedVersions returns the IDs of the versions created by this object
+	// in a versioned bucket, which Delete removes permanently
+	CreatedVersions() []string
+	// Versions lists the versions and delete markers of the object, newest
+	// first
+	Versions(ctx context.Context) ([]ObjectVersion, error)
+	// RestoreVersion copies the specified version over the latest version,
+	// returning the ID of the new version
+	RestoreVersion(ctx context.Context, versionID string) (string, error)
+}
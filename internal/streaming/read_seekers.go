@@ -0,0 +1,128 @@
+package streaming
+
+import (
+	"fmt"
+	"io"
+)
+
+// ------------------------------------------------------------
+// TeeReadSeeker type
+
+// TeeReadSeeker is an io.ReadSeeker that writes to w the bytes it reads
+// from rs, like io.TeeReader, but writes each byte only once, the first time
+// it is read, even if the underlying reader is rewound and read again (e.g.
+// to sign or to retry a request). Bytes are written in order, so skipping
+// ahead with Seek and reading past unread bytes is an error.
+type TeeReadSeeker struct {
+	rs      io.ReadSeeker
+	w       io.Writer
+	offset  int64
+	written int64
+}
+
+// NewTeeReadSeeker returns a TeeReadSeeker writing to w the bytes read from
+// rs, which should be positioned at its start
+func NewTeeReadSeeker(rs io.ReadSeeker, w io.Writer) *TeeReadSeeker {
+	return &TeeReadSeeker{rs: rs, w: w}
+}
+
+func (t *TeeReadSeeker) Read(p []byte) (int, error) {
+	if t.offset > t.written {
+		return 0, fmt.Errorf("can't read at offset %d: only %d bytes read in order", t.offset, t.written)
+	}
+	n, err := t.rs.Read(p)
+	if end := t.offset + int64(n); end > t.written {
+		unwritten := p[t.written-t.offset : n]
+		if _, werr := t.w.Write(unwritten); werr != nil {
+			return n, werr
+		}
+		t.written = end
+	}
+	t.offset += int64(n)
+	return n, err
+}
+
+func (t *TeeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := t.rs.Seek(offset, whence)
+	if err == nil {
+		t.offset = pos
+	}
+	return pos, err
+}
+
+// ------------------------------------------------------------
+// ReplayReader type
+
+// ReplayReader is an io.ReadSeeker over a deterministic stream of known
+// length, such as generated content, that can be re-opened from the start.
+// Seeking backward re-opens the stream; seeking forward reads and discards.
+type ReplayReader struct {
+	open   func() (io.Reader, error)
+	length int64
+	r      io.Reader
+	offset int64
+}
+
+// NewReplayReader returns a ReplayReader over the first length bytes of the
+// streams returned by open, each of which must produce the same bytes
+func NewReplayReader(open func() (io.Reader, error), length int64) *ReplayReader {
+	return &ReplayReader{open: open, length: length}
+}
+
+func (r *ReplayReader) Read(p []byte) (int, error) {
+	if r.offset >= r.length {
+		return 0, io.EOF
+	}
+	if err := r.ensureOpen(); err != nil {
+		return 0, err
+	}
+	if remaining := r.length - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.length {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *ReplayReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.length
+	}
+	if offset < 0 {
+		return r.offset, fmt.Errorf("can't seek to negative offset %d", offset)
+	}
+	if offset < r.offset {
+		r.r, r.offset = nil, 0
+	}
+	if offset > r.offset && offset <= r.length {
+		if err := r.ensureOpen(); err != nil {
+			return r.offset, err
+		}
+		n, err := io.CopyN(io.Discard, r.r, offset-r.offset)
+		r.offset += n
+		if err != nil {
+			return r.offset, err
+		}
+	}
+	// past the end, reads return EOF
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *ReplayReader) ensureOpen() error {
+	if r.r != nil {
+		return nil
+	}
+	in, err := r.open()
+	if err != nil {
+		return err
+	}
+	r.r = in
+	return nil
+}
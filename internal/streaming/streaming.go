@@ -11,10 +11,12 @@ import (
 
 const DefaultRangeSize = int64(5 * bytefmt.MEGABYTE)
 
+// NextRange returns the next range of at most maxRangeSize bytes, starting
+// at currentTotal, with an inclusive end
 func NextRange(currentTotal int64, maxRangeSize int64, contentLength int64) (start, end int64, size int) {
 	start = currentTotal
-	end = currentTotal + maxRangeSize
-	if end > contentLength {
+	end = currentTotal + maxRangeSize - 1
+	if end >= contentLength {
 		end = contentLength - 1
 	}
 	size = int((end + 1) - currentTotal)
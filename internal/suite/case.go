@@ -1,6 +1,7 @@
 package suite
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -23,13 +24,13 @@ const (
 
 type Case interface {
 	Name() string
-	RunWithSpinner(index int, target objects.Target, dryRun bool) (detail string)
+	RunWithSpinner(ctx context.Context, index int, target objects.Target, dryRun bool) (detail string)
 }
 
 // ------------------------------------------------------------
 // Unexported types
 
-type execution func(target objects.Target) (ok bool, detail string)
+type execution func(ctx context.Context, target objects.Target) (ok bool, detail string)
 
 type caseImpl struct {
 	name string
@@ -44,11 +45,11 @@ func (c *caseImpl) Name() string {
 	return c.name
 }
 
-func (c *caseImpl) RunWithSpinner(index int, target objects.Target, dryRun bool) string {
+func (c *caseImpl) RunWithSpinner(ctx context.Context, index int, target objects.Target, dryRun bool) string {
 	sp := newSpinner(c.title(index))
 	sp.Start()
 
-	elapsed, ok, detail := c.maybeExec(target, dryRun)
+	elapsed, ok, detail := c.maybeExec(ctx, target, dryRun)
 	if time.Duration(elapsed) < minTaskTime {
 		time.Sleep(minTaskTime - time.Duration(elapsed))
 	}
@@ -72,18 +73,18 @@ func (c *caseImpl) title(index int) string {
 	return fmt.Sprintf("%d. %v", index+1, c.Name())
 }
 
-func (c *caseImpl) maybeExec(target objects.Target, dryRun bool) (elapsed int64, ok bool, detail string) {
+func (c *caseImpl) maybeExec(ctx context.Context, target objects.Target, dryRun bool) (elapsed int64, ok bool, detail string) {
 	start := time.Now().UnixNano()
 	if dryRun {
 		execOrig := c.exec
 		defer func() {
 			c.exec = execOrig
 		}()
-		c.exec = func(target objects.Target) (ok bool, detail string) {
+		c.exec = func(ctx context.Context, target objects.Target) (ok bool, detail string) {
 			return true, ""
 		}
 	}
-	ok, detail = c.exec(target)
+	ok, detail = c.exec(ctx, target)
 	elapsed = time.Now().UnixNano() - start
 	return
 }
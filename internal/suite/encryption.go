@@ -0,0 +1,174 @@
+package suite
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	. "code.cloudfoundry.org/bytefmt"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/pkg"
+)
+
+// size of objects created by encryption cases; multipart cases use two
+// parts, the first of the AWS minimum part size
+const (
+	encryptionObjectSize    = 64 * KILOBYTE
+	encryptionMultipartSize = awsMinUploadPartSize + encryptionObjectSize
+)
+
+// AllEncryptionCases returns all server-side encryption cases (S3 only)
+func AllEncryptionCases() []Case {
+	var cases []Case
+	for _, mode := range []objects.EncryptionMode{objects.EncryptionS3, objects.EncryptionKMS, objects.EncryptionCustomer} {
+		cases = append(cases, EncryptionCase(mode, false))
+		cases = append(cases, EncryptionCase(mode, true))
+	}
+	cases = append(cases, CustomerKeyRequiredCase())
+	return cases
+}
+
+// EncryptionCase creates, retrieves, and verifies an object with the
+// specified encryption mode (SSE-C with a randomly generated key), checks
+// that the server reports the expected encryption, and deletes the object
+func EncryptionCase(mode objects.EncryptionMode, multipart bool) Case {
+	title := fmt.Sprintf("SSE-%v upload", strings.ToUpper(string(mode)))
+	if multipart {
+		title = fmt.Sprintf("SSE-%v multipart upload", strings.ToUpper(string(mode)))
+	}
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		s3Target, err := asEncryptionTarget(target)
+		if err != nil {
+			return false, err.Error()
+		}
+		config, err := encryptionConfig(mode)
+		if err != nil {
+			return false, err.Error()
+		}
+		encTarget := s3Target.WithEncryption(config)
+		size := int64(encryptionObjectSize)
+		if multipart {
+			size = encryptionMultipartSize
+			encTarget.Multipart = objects.MultipartConfig{Mode: objects.UploadMultipart, PartSize: awsMinUploadPartSize}
+		}
+
+		obj, err := createEncrypted(ctx, encTarget, size)
+		if err != nil {
+			return false, err.Error()
+		}
+		defer func() {
+			_ = obj.Delete(context.WithoutCancel(ctx))
+		}()
+		if err = checkEncryption(ctx, obj, config); err != nil {
+			return false, err.Error()
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// CustomerKeyRequiredCase creates an SSE-C object, and checks that neither
+// its metadata nor its content can be read without the key, or with the
+// wrong key
+func CustomerKeyRequiredCase() Case {
+	title := "SSE-C object unreadable without key"
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		s3Target, err := asEncryptionTarget(target)
+		if err != nil {
+			return false, err.Error()
+		}
+		config, err := encryptionConfig(objects.EncryptionCustomer)
+		if err != nil {
+			return false, err.Error()
+		}
+		obj, err := createEncrypted(ctx, s3Target.WithEncryption(config), encryptionObjectSize)
+		if err != nil {
+			return false, err.Error()
+		}
+		defer func() {
+			_ = obj.Delete(context.WithoutCancel(ctx))
+		}()
+
+		wrongKey, err := encryptionConfig(objects.EncryptionCustomer)
+		if err != nil {
+			return false, err.Error()
+		}
+		readers := []struct {
+			description string
+			target      *objects.S3Target
+		}{
+			{"without key", s3Target.WithEncryption(objects.EncryptionConfig{})},
+			{"with wrong key", s3Target.WithEncryption(wrongKey)},
+		}
+		var readable []string
+		for _, r := range readers {
+			reader := r.target.Object(obj.Key).(*objects.S3Object)
+			if _, err := reader.Metadata(ctx); err == nil {
+				readable = append(readable, "metadata "+r.description)
+			}
+			buffer := make([]byte, encryptionObjectSize)
+			if _, err := reader.DownloadRange(ctx, 0, encryptionObjectSize-1, buffer); err == nil {
+				readable = append(readable, "content "+r.description)
+			}
+		}
+		if len(readable) > 0 {
+			return false, fmt.Sprintf("SSE-C object readable: %v", strings.Join(readable, ", "))
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// ------------------------------------------------------------
+// Unexported symbols
+
+func asEncryptionTarget(target objects.Target) (*objects.S3Target, error) {
+	if s3Target, ok := target.(*objects.S3Target); ok {
+		return s3Target, nil
+	}
+	return nil, fmt.Errorf("encryption cases require an S3 target; got %v", target.Pretty())
+}
+
+// encryptionConfig returns the configuration for the specified mode, with a
+// new random customer key for SSE-C
+func encryptionConfig(mode objects.EncryptionMode) (objects.EncryptionConfig, error) {
+	config := objects.EncryptionConfig{Mode: mode}
+	if mode == objects.EncryptionCustomer {
+		config.CustomerKey = make([]byte, objects.CustomerKeySize)
+		if _, err := rand.Read(config.CustomerKey); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// createEncrypted creates, retrieves, and verifies an object of the
+// specified size, without deleting it
+func createEncrypted(ctx context.Context, target *objects.S3Target, size int64) (*objects.S3Object, error) {
+	key := fmt.Sprintf("cos-encryption-%v-%d.bin", target.Encryption.Mode, time.Now().UnixNano())
+	crvd := NewCrvd(target, key, size, DefaultRandomSeed)
+	if err := crvd.CreateRetrieveVerify(ctx); err != nil {
+		return nil, err
+	}
+	return crvd.Object.(*objects.S3Object), nil
+}
+
+// checkEncryption returns an error if the server does not report the
+// expected encryption for the object
+func checkEncryption(ctx context.Context, obj *objects.S3Object, config objects.EncryptionConfig) error {
+	metadata, err := obj.Metadata(ctx)
+	if err != nil {
+		return err
+	}
+	expected := config.ExpectedAlgorithm()
+	if metadata.Encryption != expected {
+		return fmt.Errorf("expected encryption %#v, got %#v", expected, metadata.Encryption)
+	}
+	if isCustomer := config.Mode == objects.EncryptionCustomer; metadata.CustomerKey != isCustomer {
+		return fmt.Errorf("expected customer key reported: %v, got %v", isCustomer, metadata.CustomerKey)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package suite
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -44,11 +45,12 @@ func FileCountCase(prefix string, count uint64) Case {
 		return bytes.NewReader(body)
 	}
 
-	execution := func(target objects.Target) (ok bool, detail string) {
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
 		var keysToDelete []string
 		defer func() {
+			cleanupCtx := context.WithoutCancel(ctx)
 			for _, k := range keysToDelete {
-				_ = target.Object(k).Delete()
+				_ = target.Object(k).Delete(cleanupCtx)
 			}
 		}()
 
@@ -66,7 +68,7 @@ func FileCountCase(prefix string, count uint64) Case {
 				ContentLength: contentLength,
 				BodyProvider:  bodyProvider,
 			}
-			err := crvd.CreateRetrieveVerify()
+			err := crvd.CreateRetrieveVerify(ctx)
 			if err != nil {
 				return false, err.Error()
 			}
@@ -1,6 +1,7 @@
 package suite
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strconv"
@@ -38,9 +39,9 @@ func FileSizeCases(sizeMax int64) []Case {
 
 func FileSizeCase(size int64) Case {
 	title := fmt.Sprintf("create/retrieve/verify/delete %v file", logging.FormatBytes(size))
-	execution := func(target objects.Target) (ok bool, detail string) {
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
 		crvd := NewCrvd(target, "", size, DefaultRandomSeed)
-		err := crvd.CreateRetrieveVerifyDelete()
+		err := crvd.CreateRetrieveVerifyDelete(ctx)
 		if err == nil {
 			return true, ""
 		} else {
@@ -0,0 +1,181 @@
+package suite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+const (
+	// maxValueToReport is the maximum length of a metadata value to include
+	// in a case's detail
+	maxValueToReport = 40
+
+	// AWS limit on the total size of user metadata (keys and values)
+	awsMaxUserMetadataSize = 2 * 1024
+)
+
+// AllMetadataCases returns all metadata cases. Object tag cases are included
+// only if tags is true (i.e., for S3 targets).
+func AllMetadataCases(tags bool) []Case {
+	var cases []Case
+	cases = append(cases, MetadataCase(
+		"Content-Type, Content-Encoding, and Cache-Control headers",
+		&objects.Metadata{ContentType: "text/csv; charset=utf-8", ContentEncoding: "gzip", CacheControl: "max-age=3600"},
+	))
+	if tags {
+		cases = append(cases, MetadataCase(
+			"object tags",
+			&objects.Metadata{Tags: map[string]string{"cos-retention": "7y", "cos-owner": "Merritt"}},
+		))
+	}
+	cases = append(cases, MetadataKeyLengthCases()...)
+	cases = append(cases, MetadataValueLengthCases()...)
+	cases = append(cases, MetadataTotalSizeCases()...)
+	cases = append(cases, MetadataCharacterCases()...)
+	return cases
+}
+
+// MetadataKeyLengthCases probes the maximum length of a user metadata key
+func MetadataKeyLengthCases() []Case {
+	var cases []Case
+	for _, length := range []int{16, 128, 256, 1024} {
+		key := "cos-" + strings.Repeat("k", length-4)
+		cases = append(cases, MetadataCase(
+			fmt.Sprintf("%d-character user metadata key", length),
+			&objects.Metadata{User: map[string]string{key: "value"}},
+		))
+	}
+	return cases
+}
+
+// MetadataValueLengthCases probes the maximum length of a user metadata value
+func MetadataValueLengthCases() []Case {
+	var cases []Case
+	for _, length := range []int{256, 1024, awsMaxUserMetadataSize - len("cos-value"), 8 * 1024} {
+		cases = append(cases, MetadataCase(
+			fmt.Sprintf("%d-byte user metadata value", length),
+			&objects.Metadata{User: map[string]string{"cos-value": strings.Repeat("v", length)}},
+		))
+	}
+	return cases
+}
+
+// MetadataTotalSizeCases probes the maximum total size of user metadata, and
+// thus of the request headers, using multiple 256-byte values, around the
+// AWS limit of 2 KiB
+func MetadataTotalSizeCases() []Case {
+	var cases []Case
+	for _, total := range []int{awsMaxUserMetadataSize, 4 * 1024, 8 * 1024, 16 * 1024} {
+		user := map[string]string{}
+		for size := 0; size+256 <= total; size += 256 {
+			key := fmt.Sprintf("cos-total-%03d", len(user))
+			user[key] = strings.Repeat("t", 256-len(key))
+		}
+		cases = append(cases, MetadataCase(
+			fmt.Sprintf("%v of user metadata (%d keys)", logging.FormatBytes(int64(total)), len(user)),
+			&objects.Metadata{User: user},
+		))
+	}
+	return cases
+}
+
+// MetadataCharacterCases probes the characters supported in user metadata
+// keys and values
+func MetadataCharacterCases() []Case {
+	var printable bytes.Buffer
+	for c := byte(' '); c < 0x7f; c++ {
+		printable.WriteByte(c)
+	}
+	return []Case{
+		MetadataCase("user metadata key with '_' and '.'", &objects.Metadata{User: map[string]string{"cos_under.dot": "value"}}),
+		MetadataCase("user metadata key with upper-case letters", &objects.Metadata{User: map[string]string{"Cos-Mixed-Case": "value"}}),
+		MetadataCase("user metadata key with non-ASCII characters", &objects.Metadata{User: map[string]string{"cos-clé": "value"}}),
+		MetadataCase("user metadata value with printable ASCII", &objects.Metadata{User: map[string]string{"cos-ascii": strings.TrimSpace(printable.String())}}),
+		MetadataCase("user metadata value with leading and trailing spaces", &objects.Metadata{User: map[string]string{"cos-spaces": "  value  "}}),
+		MetadataCase("user metadata value with UTF-8", &objects.Metadata{User: map[string]string{"cos-utf8": "héllo wörld ☃ 😀"}}),
+	}
+}
+
+// MetadataCase creates an object with the specified metadata, reads back its
+// metadata and compares it with what was sent, then deletes the object
+func MetadataCase(title string, metadata *objects.Metadata) Case {
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		key := fmt.Sprintf("cos-metadata-%d.bin", time.Now().UnixNano())
+		obj, isMetadataObject := target.Object(key).(objects.MetadataObject)
+		if !isMetadataObject {
+			return false, fmt.Sprintf("%v does not support metadata", target.Pretty())
+		}
+		body := []byte("metadata")
+		err := obj.CreateWithMetadata(ctx, bytes.NewReader(body), int64(len(body)), metadata)
+		if err != nil {
+			return false, err.Error()
+		}
+		defer func() {
+			_ = obj.Delete(context.WithoutCancel(ctx))
+		}()
+
+		actual, err := obj.Metadata(ctx)
+		if err != nil {
+			return false, err.Error()
+		}
+		mismatches := compareMetadata(metadata, actual)
+		if len(mismatches) > 0 {
+			return false, strings.Join(mismatches, "; ")
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// compareMetadata returns a description of each expected metadata value
+// that was not returned as sent
+func compareMetadata(expected, actual *objects.Metadata) []string {
+	var mismatches []string
+	compare := func(name, expected, actual string) {
+		if expected != actual {
+			mismatches = append(mismatches, fmt.Sprintf("%v: expected %#v, got %#v", name, truncate(expected), truncate(actual)))
+		}
+	}
+	if expected.ContentType != "" {
+		compare("Content-Type", expected.ContentType, actual.ContentType)
+	}
+	if expected.ContentEncoding != "" {
+		compare("Content-Encoding", expected.ContentEncoding, actual.ContentEncoding)
+	}
+	if expected.CacheControl != "" {
+		compare("Cache-Control", expected.CacheControl, actual.CacheControl)
+	}
+	for _, k := range sortedKeys(expected.User) {
+		compare("metadata "+k, expected.User[k], actual.User[strings.ToLower(k)])
+	}
+	for _, k := range sortedKeys(expected.Tags) {
+		compare("tag "+k, expected.Tags[k], actual.Tags[k])
+	}
+	return mismatches
+}
+
+func sortedKeys(values map[string]string) []string {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func truncate(value string) string {
+	if len(value) <= maxValueToReport {
+		return value
+	}
+	return value[:maxValueToReport] + "…"
+}
@@ -0,0 +1,121 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "code.cloudfoundry.org/bytefmt"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+const (
+	// PartSizeMaxDefault is the default maximum part size for MultipartPartSizeMaxCases,
+	// slightly above the AWS limit of 5 GiB
+	PartSizeMaxDefault = 5*GIGABYTE + 16*MEGABYTE
+
+	// AWS limits
+	awsMaxUploadParts    = 10000
+	awsMinUploadPartSize = 5 * MEGABYTE
+	awsMaxUploadPartSize = 5 * GIGABYTE
+)
+
+// AllMultipartCases returns all multipart upload limit cases, with part
+// sizes up to the specified maximum
+func AllMultipartCases(partSizeMax int64) []Case {
+	var cases []Case
+	cases = append(cases, MultipartPartCountCases()...)
+	cases = append(cases, MultipartPartSizeMinCases()...)
+	cases = append(cases, MultipartPartSizeMaxCases(partSizeMax)...)
+	return cases
+}
+
+// MultipartPartCountCases probes the maximum part number accepted, around
+// the AWS limit of 10,000 parts
+func MultipartPartCountCases() []Case {
+	var cases []Case
+	for _, partNumber := range []int64{1, 1000, awsMaxUploadParts, awsMaxUploadParts + 1, 1 << 16} {
+		cases = append(cases, MultipartPartNumberCase(partNumber))
+	}
+	return cases
+}
+
+// MultipartPartSizeMinCases probes the minimum size accepted for non-final
+// parts, around the AWS limit of 5 MiB
+func MultipartPartSizeMinCases() []Case {
+	var cases []Case
+	for _, size := range []int64{BYTE, KILOBYTE, 64 * KILOBYTE, MEGABYTE, awsMinUploadPartSize - 1, awsMinUploadPartSize} {
+		cases = append(cases, MultipartPartSizesCase(
+			fmt.Sprintf("multipart upload with %v (%d-byte) non-final part", logging.FormatBytes(size), size),
+			[]int64{size, BYTE},
+		))
+	}
+	return cases
+}
+
+// MultipartPartSizeMaxCases probes the maximum part size accepted, around
+// the AWS limit of 5 GiB, up to the specified maximum
+func MultipartPartSizeMaxCases(partSizeMax int64) []Case {
+	var cases []Case
+	for _, size := range []int64{awsMinUploadPartSize, 256 * MEGABYTE, GIGABYTE, awsMaxUploadPartSize, awsMaxUploadPartSize + 16*MEGABYTE} {
+		if size > partSizeMax {
+			break
+		}
+		cases = append(cases, MultipartPartSizesCase(
+			fmt.Sprintf("multipart upload with %v part", logging.FormatBytes(size)),
+			[]int64{size},
+		))
+	}
+	return cases
+}
+
+// MultipartPartNumberCase uploads a single part with the specified part
+// number, then aborts the upload
+func MultipartPartNumberCase(partNumber int64) Case {
+	title := fmt.Sprintf("multipart upload part number %d", partNumber)
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		s3Target, err := asS3Target(target)
+		if err != nil {
+			return false, err.Error()
+		}
+		err = s3Target.ProbePartNumber(ctx, probeKey("part-number"), partNumber)
+		if err != nil {
+			return false, err.Error()
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// MultipartPartSizesCase completes a multipart upload with parts of the
+// specified sizes, then deletes the resulting object
+func MultipartPartSizesCase(title string, partSizes []int64) Case {
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		s3Target, err := asS3Target(target)
+		if err != nil {
+			return false, err.Error()
+		}
+		err = s3Target.ProbePartSizes(ctx, probeKey("part-size"), partSizes)
+		if err != nil {
+			return false, err.Error()
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// ------------------------------------------------------------
+// Unexported symbols
+
+func asS3Target(target objects.Target) (*objects.S3Target, error) {
+	if s3Target, ok := target.(*objects.S3Target); ok {
+		return s3Target, nil
+	}
+	return nil, fmt.Errorf("multipart upload cases require an S3 target; got %v", target.Pretty())
+}
+
+func probeKey(prefix string) string {
+	return fmt.Sprintf("cos-multipart-%v-%d.bin", prefix, time.Now().UnixNano())
+}
@@ -1,6 +1,7 @@
 package suite
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -11,7 +12,7 @@ import (
 )
 
 type Suite interface {
-	Execute() int64
+	Execute(ctx context.Context) int64
 }
 
 func NewSuite(cases []Case, target objects.Target, logLevel logging.LogLevel, dryRun bool) Suite {
@@ -33,7 +34,7 @@ type suite struct {
 	dryRun   bool
 }
 
-func (s *suite) Execute() int64 {
+func (s *suite) Execute(ctx context.Context) int64 {
 	cases := s.cases
 	target := s.target
 	logLevel := s.logLevel
@@ -44,7 +45,11 @@ func (s *suite) Execute() int64 {
 		if c == nil {
 			log.Fatalf("nil case at index %d", index)
 		}
-		detail := c.RunWithSpinner(index, target, dryRun)
+		if err := ctx.Err(); err != nil {
+			fmt.Printf("Stopping before case %d: %v\n", index+1, err)
+			break
+		}
+		detail := c.RunWithSpinner(ctx, index, target, dryRun)
 		if detail != "" && logLevel > logging.Info {
 			fmt.Println(detail)
 		}
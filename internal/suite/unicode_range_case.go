@@ -1,6 +1,7 @@
 package suite
 
 import (
+	"context"
 	"fmt"
 	"unicode"
 
@@ -27,8 +28,11 @@ func NewRangeTableCase(prefix string, rangeName string, rt *unicode.RangeTable)
 	return &c
 }
 
-func (u *rangeCase) doExec(target objects.Target) (ok bool, detail string) {
-	invalidRunesForKey := findInvalidRunesForKeyIn(u.allRunes, target)
+func (u *rangeCase) doExec(ctx context.Context, target objects.Target) (ok bool, detail string) {
+	invalidRunesForKey := findInvalidRunesForKeyIn(ctx, u.allRunes, target)
+	if err := ctx.Err(); err != nil {
+		return false, err.Error()
+	}
 	numInvalid := len(invalidRunesForKey)
 	if numInvalid == 0 {
 		return true, ""
@@ -43,14 +47,14 @@ func (u *rangeCase) doExec(target objects.Target) (ok bool, detail string) {
 }
 
 // TODO: parallelize this?
-func findInvalidRunesForKeyIn(keyRunes []rune, target objects.Target) []rune {
+func findInvalidRunesForKeyIn(ctx context.Context, keyRunes []rune, target objects.Target) []rune {
 	if len(keyRunes) == 0 {
 		return nil
 	}
 	if len(keyRunes) < keyMaxBytes {
 		filename := string(keyRunes)
 		crvd := NewCrvd(target, filename, DefaultContentLengthBytes, DefaultRandomSeed)
-		err := crvd.CreateRetrieveVerifyDelete()
+		err := crvd.CreateRetrieveVerifyDelete(ctx)
 		if err == nil {
 			return nil
 		} else {
@@ -64,8 +68,8 @@ func findInvalidRunesForKeyIn(keyRunes []rune, target objects.Target) []rune {
 	// 1. we have too many characters to test in a single key, so we split it, or
 	// 2. we have one or more invalid key characters somewhere in this string, so we binary search for them
 	kr1, kr2 := splitRunes(keyRunes)
-	result1 := findInvalidRunesForKeyIn(kr1, target)
-	result2 := findInvalidRunesForKeyIn(kr2, target)
+	result1 := findInvalidRunesForKeyIn(ctx, kr1, target)
+	result2 := findInvalidRunesForKeyIn(ctx, kr2, target)
 	return append(result1, result2...)
 }
 
@@ -1,6 +1,7 @@
 package suite
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -29,12 +30,15 @@ func NewSeqCase(prefix string, seqName string, seqs []string, linear bool) Case
 	return &c
 }
 
-func (u *seqCase) doExec(target objects.Target) (ok bool, detail string) {
+func (u *seqCase) doExec(ctx context.Context, target objects.Target) (ok bool, detail string) {
 	var invalidSeqsForKey []string
 	if u.linear {
-		invalidSeqsForKey = listInvalidSeqsForKeyIn(u.allSeqs, target)
+		invalidSeqsForKey = listInvalidSeqsForKeyIn(ctx, u.allSeqs, target)
 	} else {
-		invalidSeqsForKey = findInvalidSeqsForKeyIn(u.allSeqs, target)
+		invalidSeqsForKey = findInvalidSeqsForKeyIn(ctx, u.allSeqs, target)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err.Error()
 	}
 	numInvalid := len(invalidSeqsForKey)
 	if numInvalid == 0 {
@@ -59,7 +63,7 @@ func toMessage(invalidSeqs []string) string {
 	return msg
 }
 
-func listInvalidSeqsForKeyIn(seqs []string, target objects.Target) []string {
+func listInvalidSeqsForKeyIn(ctx context.Context, seqs []string, target objects.Target) []string {
 	if len(seqs) == 0 {
 		return nil
 	}
@@ -69,7 +73,7 @@ func listInvalidSeqsForKeyIn(seqs []string, target objects.Target) []string {
 			panic("key too long: " + logging.FormatStringBytes(seq))
 		}
 		crvd := NewCrvd(target, seq, DefaultContentLengthBytes, DefaultRandomSeed)
-		err := crvd.CreateRetrieveVerifyDelete()
+		err := crvd.CreateRetrieveVerifyDelete(ctx)
 		if err != nil {
 			logging.DefaultLogger().Tracef("error creating %#v: %v\n", seq, err)
 			invalid = append(invalid, seq)
@@ -78,14 +82,14 @@ func listInvalidSeqsForKeyIn(seqs []string, target objects.Target) []string {
 	return invalid
 }
 
-func findInvalidSeqsForKeyIn(seqs []string, target objects.Target) []string {
+func findInvalidSeqsForKeyIn(ctx context.Context, seqs []string, target objects.Target) []string {
 	if len(seqs) == 0 {
 		return nil
 	}
 	if lenTotal(seqs) < keyMaxBytes {
 		filename := strings.Join(seqs, "")
 		crvd := NewCrvd(target, filename, DefaultContentLengthBytes, DefaultRandomSeed)
-		err := crvd.CreateRetrieveVerifyDelete()
+		err := crvd.CreateRetrieveVerifyDelete(ctx)
 		if err == nil {
 			return nil
 		} else {
@@ -99,8 +103,8 @@ func findInvalidSeqsForKeyIn(seqs []string, target objects.Target) []string {
 	// 1. we have too many characters to test in a single key, so we split it, or
 	// 2. we have one or more invalid sequences somewhere in this list, so we binary search for them
 	s1, s2 := splitStrings(seqs)
-	result1 := findInvalidSeqsForKeyIn(s1, target)
-	result2 := findInvalidSeqsForKeyIn(s2, target)
+	result1 := findInvalidSeqsForKeyIn(ctx, s1, target)
+	result2 := findInvalidSeqsForKeyIn(ctx, s2, target)
 	return append(result1, result2...)
 }
 
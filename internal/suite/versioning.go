@@ -0,0 +1,224 @@
+package suite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+// AllVersioningCases returns all object versioning cases (S3 only; these
+// require a bucket with versioning enabled)
+func AllVersioningCases() []Case {
+	return []Case{
+		VersionCreationCase(),
+		VersionRestoreCase(),
+		DeleteMarkerCase(),
+	}
+}
+
+// VersionCreationCase creates two versions of an object, checks that both
+// are listed and that each can be read by version ID, then deletes both and
+// checks that no versions are left behind
+func VersionCreationCase() Case {
+	title := "version creation, listing, and deletion"
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		obj, err := newVersionedObject(ctx, target)
+		if err != nil {
+			return false, err.Error()
+		}
+		bodies, err := createVersions(ctx, obj, 2)
+		if err != nil {
+			return false, err.Error()
+		}
+		created := obj.CreatedVersions()
+		if len(created) != 2 || created[0] == created[1] {
+			_ = obj.Delete(context.WithoutCancel(ctx))
+			return false, fmt.Sprintf("expected two distinct version IDs, got %#v", created)
+		}
+		err = checkVersions(ctx, obj, created[1], len(created))
+		if err == nil {
+			err = checkVersionContents(ctx, obj, created, bodies)
+		}
+		if err != nil {
+			_ = obj.Delete(context.WithoutCancel(ctx))
+			return false, err.Error()
+		}
+
+		if err = obj.Delete(ctx); err != nil {
+			return false, err.Error()
+		}
+		versions, err := obj.Versions(ctx)
+		if err != nil {
+			return false, err.Error()
+		}
+		if len(versions) > 0 {
+			return false, fmt.Sprintf("expected no versions after delete, got %d: %v", len(versions), versions)
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// VersionRestoreCase creates two versions of an object, restores the first
+// by copying it over the second, and checks that the new latest version has
+// the content of the first
+func VersionRestoreCase() Case {
+	title := "version restore by copy"
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		obj, err := newVersionedObject(ctx, target)
+		if err != nil {
+			return false, err.Error()
+		}
+		defer func() {
+			_ = obj.Delete(context.WithoutCancel(ctx))
+		}()
+		bodies, err := createVersions(ctx, obj, 2)
+		if err != nil {
+			return false, err.Error()
+		}
+		first := obj.CreatedVersions()[0]
+		restored, err := obj.RestoreVersion(ctx, first)
+		if err != nil {
+			return false, err.Error()
+		}
+		if restored == "" || restored == first {
+			return false, fmt.Sprintf("expected a new version ID for restored version %v, got %#v", first, restored)
+		}
+		if err = checkVersions(ctx, obj, restored, 3); err != nil {
+			return false, err.Error()
+		}
+		if err = checkContent(ctx, obj, bodies[0]); err != nil {
+			return false, fmt.Sprintf("restored version: %v", err)
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// DeleteMarkerCase creates an object, deletes it without a version ID, and
+// checks that a delete marker hides the object while its version remains
+// readable, and that deleting the marker restores the object
+func DeleteMarkerCase() Case {
+	title := "delete marker semantics"
+	execution := func(ctx context.Context, target objects.Target) (ok bool, detail string) {
+		obj, err := newVersionedObject(ctx, target)
+		if err != nil {
+			return false, err.Error()
+		}
+		defer func() {
+			_ = obj.Delete(context.WithoutCancel(ctx))
+		}()
+		bodies, err := createVersions(ctx, obj, 1)
+		if err != nil {
+			return false, err.Error()
+		}
+		version := obj.CreatedVersions()[0]
+
+		// delete through a new object, which has created no versions, and so
+		// deletes the latest version with a delete marker
+		if err = obj.Version("").Delete(ctx); err != nil {
+			return false, err.Error()
+		}
+		if _, err = obj.ContentLength(ctx); err == nil {
+			return false, "object still readable after delete"
+		}
+		versions, err := obj.Versions(ctx)
+		if err != nil {
+			return false, err.Error()
+		}
+		if len(versions) != 2 || !versions[0].DeleteMarker || !versions[0].IsLatest {
+			return false, fmt.Sprintf("expected latest delete marker and one version, got %v", versions)
+		}
+		if err = checkVersionContents(ctx, obj, []string{version}, bodies); err != nil {
+			return false, fmt.Sprintf("after delete: %v", err)
+		}
+
+		if err = obj.Version(versions[0].VersionID).Delete(ctx); err != nil {
+			return false, err.Error()
+		}
+		if err = checkContent(ctx, obj, bodies[0]); err != nil {
+			return false, fmt.Sprintf("after deleting delete marker: %v", err)
+		}
+		return true, ""
+	}
+	return newCase(title, execution)
+}
+
+// ------------------------------------------------------------
+// Unexported symbols
+
+// newVersionedObject returns a new object in the target bucket, or an error
+// if the target is not an S3 bucket with versioning enabled
+func newVersionedObject(ctx context.Context, target objects.Target) (*objects.S3Object, error) {
+	s3Target, ok := target.(*objects.S3Target)
+	if !ok {
+		return nil, fmt.Errorf("versioning cases require an S3 target; got %v", target.Pretty())
+	}
+	status, err := s3Target.VersioningStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status != "Enabled" {
+		return nil, fmt.Errorf("versioning is not enabled for bucket %v (status: %#v)", s3Target.Bucket, status)
+	}
+	key := fmt.Sprintf("cos-versioning-%d.bin", time.Now().UnixNano())
+	return s3Target.Object(key).(*objects.S3Object), nil
+}
+
+// createVersions creates the specified number of versions of the object,
+// each with different content, and returns the content of each
+func createVersions(ctx context.Context, obj *objects.S3Object, count int) ([][]byte, error) {
+	var bodies [][]byte
+	for i := 0; i < count; i++ {
+		body := []byte(fmt.Sprintf("version %d of %v", i+1, obj.Key))
+		if err := obj.Create(ctx, bytes.NewReader(body), int64(len(body))); err != nil {
+			return bodies, err
+		}
+		bodies = append(bodies, body)
+	}
+	return bodies, nil
+}
+
+// checkVersions returns an error if the object does not have the expected
+// number of versions, or if the expected version is not the latest
+func checkVersions(ctx context.Context, obj *objects.S3Object, latest string, count int) error {
+	versions, err := obj.Versions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(versions) != count {
+		return fmt.Errorf("expected %d versions, got %d: %v", count, len(versions), versions)
+	}
+	if !versions[0].IsLatest || versions[0].VersionID != latest || versions[0].DeleteMarker {
+		return fmt.Errorf("expected latest version %v, got %v", latest, versions[0])
+	}
+	return nil
+}
+
+// checkVersionContents returns an error if each version cannot be read by
+// version ID, or does not have the expected content
+func checkVersionContents(ctx context.Context, obj *objects.S3Object, versionIDs []string, bodies [][]byte) error {
+	for i, versionID := range versionIDs {
+		if err := checkContent(ctx, obj.Version(versionID), bodies[i]); err != nil {
+			return fmt.Errorf("version %v: %v", versionID, err)
+		}
+	}
+	return nil
+}
+
+// checkContent returns an error if the object cannot be read, or does not
+// have the expected content
+func checkContent(ctx context.Context, obj objects.Object, expected []byte) error {
+	buffer := make([]byte, len(expected))
+	n, err := obj.DownloadRange(ctx, 0, int64(len(expected)-1), buffer)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(buffer[:n], expected) {
+		return fmt.Errorf("expected %#v, got %#v", string(expected), string(buffer[:n]))
+	}
+	return nil
+}
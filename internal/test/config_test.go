@@ -0,0 +1,182 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/cmd"
+	. "github.com/dmolesUC3/cos/internal/config"
+	"github.com/dmolesUC3/cos/internal/objects"
+)
+
+const configYAML = `
+default_profile: minio
+profiles:
+  minio:
+    endpoint: http://127.0.0.1:9000/
+    protocol: s3
+    bucket: mrt-test
+    op_timeout: 90s
+    max_attempts: 2
+    retry_on: [5xx, throttle]
+    credentials:
+      source: aws-profile
+      aws_profile: minio
+  sdsc:
+    endpoint: http://cloud.sdsc.edu/auth/v1.0
+    protocol: swift
+    credentials:
+      user_env: SDSC_USER
+      key_env: SDSC_KEY
+`
+
+// ------------------------------------------------------------
+// Fixture
+
+type ConfigSuite struct {
+}
+
+var _ = Suite(&ConfigSuite{})
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *ConfigSuite) TestParse(c *C) {
+	cfg, err := Parse([]byte(configYAML))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.DefaultProfile, Equals, "minio")
+	c.Assert(cfg.ProfileNames(), DeepEquals, []string{"minio", "sdsc"})
+
+	minio, err := cfg.Profile("minio")
+	c.Assert(err, IsNil)
+	c.Assert(minio.Name, Equals, "minio")
+	c.Assert(minio.Endpoint, Equals, "http://127.0.0.1:9000/")
+	c.Assert(minio.Bucket, Equals, "mrt-test")
+	c.Assert(minio.OpTimeout, Equals, 90*time.Second)
+	c.Assert(minio.MaxAttempts, Equals, 2)
+	c.Assert(minio.RetryOn, DeepEquals, []string{"5xx", "throttle"})
+	c.Assert(minio.Credentials.Source, Equals, "aws-profile")
+	c.Assert(minio.Credentials.AWSProfile, Equals, "minio")
+
+	sdsc, err := cfg.Profile("sdsc")
+	c.Assert(err, IsNil)
+	c.Assert(sdsc.Protocol, Equals, "swift")
+	c.Assert(sdsc.Credentials.UserEnv, Equals, "SDSC_USER")
+	c.Assert(sdsc.Timeout, Equals, time.Duration(0))
+}
+
+func (s *ConfigSuite) TestMissingProfile(c *C) {
+	cfg, err := Parse([]byte(configYAML))
+	c.Assert(err, IsNil)
+	_, err = cfg.Profile("nonexistent")
+	c.Assert(err, ErrorMatches, "no such profile.*")
+}
+
+func (s *ConfigSuite) TestMissingDefaultProfile(c *C) {
+	_, err := Parse([]byte("default_profile: nonexistent\n"))
+	c.Assert(err, ErrorMatches, "default profile.*not found")
+}
+
+func (s *ConfigSuite) TestLoad(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "config.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte(configYAML), 0600), IsNil)
+
+	cfg, err := Load(path)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.ProfileNames(), HasLen, 2)
+
+	_, err = Load(filepath.Join(dir, "nonexistent.yaml"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ConfigSuite) TestLoadDefaultMissing(c *C) {
+	orig := os.Getenv(ConfigFileEnvVar)
+	defer func() { _ = os.Setenv(ConfigFileEnvVar, orig) }()
+	c.Assert(os.Setenv(ConfigFileEnvVar, filepath.Join(c.MkDir(), "config.yaml")), IsNil)
+
+	cfg, err := Load("")
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Profiles, HasLen, 0)
+}
+
+func (s *ConfigSuite) TestParseProbes(c *C) {
+	cfg, err := Parse([]byte(configYAML + `
+probes:
+  - name: minio-crvd
+    type: crvd
+    profile: minio
+    interval: 1m
+    size: 1M
+  - name: sdsc-check
+    type: check
+    profile: sdsc
+    url: swift://distrib.stage.9001.__c5e/ark/42
+    expected: cafe
+`))
+	c.Assert(err, IsNil)
+	c.Assert(len(cfg.Probes), Equals, 2)
+	c.Assert(cfg.Probes[0].Interval, Equals, time.Minute)
+	c.Assert(cfg.Probes[0].Size, Equals, "1M")
+	c.Assert(cfg.Probes[1].URL, Equals, "swift://distrib.stage.9001.__c5e/ark/42")
+
+	_, err = Parse([]byte(configYAML + `
+probes:
+  - name: crvd
+    type: crvd
+    profile: nonexistent
+`))
+	c.Assert(err, ErrorMatches, `.*profile "nonexistent" not found`)
+}
+
+func (s *ConfigSuite) TestWithProfile(c *C) {
+	path := filepath.Join(c.MkDir(), "config.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte(`
+default_profile: west
+profiles:
+  west:
+    endpoint: https://s3.us-west-2.amazonaws.com/
+    region: us-west-2
+    op_timeout: 90s
+    max_attempts: 2
+  east:
+    endpoint: https://s3.us-east-1.amazonaws.com/
+    region: us-east-1
+`), 0600), IsNil)
+	orig := os.Getenv(ProfileEnvVar)
+	defer func() { _ = os.Setenv(ProfileEnvVar, orig) }()
+	c.Assert(os.Unsetenv(ProfileEnvVar), IsNil)
+
+	flags := &cmd.CosFlags{}
+	cmdFlags := pflag.NewFlagSet("cos", pflag.ContinueOnError)
+	flags.AddTo(cmdFlags)
+	c.Assert(cmdFlags.Parse([]string{"--config", path, "--timeout", "1h"}), IsNil)
+	c.Assert(flags.ApplyProfile(cmdFlags), IsNil)
+	c.Assert(flags.Region, Equals, "us-west-2")
+	c.Assert(flags.OpTimeout, Equals, 90*time.Second)
+
+	east, err := flags.WithProfile("east", cmdFlags)
+	c.Assert(err, IsNil)
+	c.Assert(east.Endpoint, Equals, "https://s3.us-east-1.amazonaws.com/")
+	c.Assert(east.Region, Equals, "us-east-1")
+	// settings from the default profile don't carry over to the other endpoint
+	c.Assert(east.OpTimeout, Equals, time.Duration(0))
+	c.Assert(east.MaxAttempts, Equals, objects.DefaultMaxAttempts)
+	// explicit flags still apply
+	c.Assert(east.Timeout, Equals, time.Hour)
+
+	west, err := east.WithProfile("west", cmdFlags)
+	c.Assert(err, IsNil)
+	c.Assert(west.Region, Equals, "us-west-2")
+	c.Assert(west.OpTimeout, Equals, 90*time.Second)
+	c.Assert(west.MaxAttempts, Equals, 2)
+
+	// the original flags are unchanged
+	c.Assert(flags.Region, Equals, "us-west-2")
+	c.Assert(flags.OpTimeout, Equals, 90*time.Second)
+}
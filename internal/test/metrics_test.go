@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/metrics"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type MetricsSuite struct {
+}
+
+var _ = Suite(&MetricsSuite{})
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *MetricsSuite) TestWriteTo(c *C) {
+	r := metrics.NewRegistry()
+	runs := r.Counter("runs_total", "Runs.", "probe", "result")
+	up := r.Gauge("up", "Up.")
+	duration := r.Histogram("duration_seconds", "Duration.", []float64{0.1, 1}, "probe")
+
+	runs.Inc("b", "success")
+	runs.Add(2, "a\"1", "success")
+	up.Set(1)
+	duration.Observe(0.05, "a")
+	duration.Observe(0.5, "a")
+	duration.Observe(5, "a")
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(buf.Len()))
+
+	expected := strings.Join([]string{
+		`# HELP runs_total Runs.`,
+		`# TYPE runs_total counter`,
+		`runs_total{probe="a\"1",result="success"} 2`,
+		`runs_total{probe="b",result="success"} 1`,
+		`# HELP up Up.`,
+		`# TYPE up gauge`,
+		`up 1`,
+		`# HELP duration_seconds Duration.`,
+		`# TYPE duration_seconds histogram`,
+		`duration_seconds_bucket{probe="a",le="0.1"} 1`,
+		`duration_seconds_bucket{probe="a",le="1"} 2`,
+		`duration_seconds_bucket{probe="a",le="+Inf"} 3`,
+		`duration_seconds_sum{probe="a"} 5.55`,
+		`duration_seconds_count{probe="a"} 3`,
+	}, "\n") + "\n"
+	c.Assert(buf.String(), Equals, expected)
+}
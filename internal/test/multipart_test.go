@@ -0,0 +1,77 @@
+package test
+
+import (
+	"context"
+	"strings"
+
+	. "code.cloudfoundry.org/bytefmt"
+	. "gopkg.in/check.v1"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+
+	"github.com/dmolesUC3/cos/internal/suite"
+)
+
+type MultipartSuite struct {
+}
+
+var _ = Suite(&MultipartSuite{})
+
+func names(cases []suite.Case) []string {
+	var names []string
+	for _, c := range cases {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+func (s *MultipartSuite) TestPartSizeMaxCases(c *C) {
+	expected := []string{
+		"multipart upload with 5M part",
+		"multipart upload with 256M part",
+		"multipart upload with 1G part",
+		"multipart upload with 5G part",
+		"multipart upload with " + logging.FormatBytes(suite.PartSizeMaxDefault) + " part",
+	}
+	c.Assert(names(suite.MultipartPartSizeMaxCases(suite.PartSizeMaxDefault)), DeepEquals, expected)
+
+	// sizes up to and including the maximum are kept; larger sizes are dropped
+	c.Assert(names(suite.MultipartPartSizeMaxCases(GIGABYTE)), DeepEquals, expected[:3])
+	c.Assert(names(suite.MultipartPartSizeMaxCases(GIGABYTE-1)), DeepEquals, expected[:2])
+	c.Assert(names(suite.MultipartPartSizeMaxCases(5*MEGABYTE-1)), HasLen, 0)
+}
+
+func (s *MultipartSuite) TestPartCountCases(c *C) {
+	expected := []string{
+		"multipart upload part number 1",
+		"multipart upload part number 1000",
+		"multipart upload part number 10000",
+		"multipart upload part number 10001",
+		"multipart upload part number 65536",
+	}
+	c.Assert(names(suite.MultipartPartCountCases()), DeepEquals, expected)
+}
+
+func (s *MultipartSuite) TestAllMultipartCases(c *C) {
+	countCases := suite.MultipartPartCountCases()
+	minCases := suite.MultipartPartSizeMinCases()
+	for _, partSizeMax := range []int64{5 * MEGABYTE, GIGABYTE, suite.PartSizeMaxDefault} {
+		maxCases := suite.MultipartPartSizeMaxCases(partSizeMax)
+
+		var expected []string
+		expected = append(expected, names(countCases)...)
+		expected = append(expected, names(minCases)...)
+		expected = append(expected, names(maxCases)...)
+		c.Check(names(suite.AllMultipartCases(partSizeMax)), DeepEquals, expected, Commentf("partSizeMax %d", partSizeMax))
+	}
+	for _, name := range names(minCases) {
+		c.Check(strings.HasSuffix(name, "non-final part"), Equals, true, Commentf(name))
+	}
+}
+
+func (s *MultipartSuite) TestRequiresS3Target(c *C) {
+	target := NewMemoryTarget()
+	detail := suite.MultipartPartNumberCase(1).RunWithSpinner(context.Background(), 0, target, false)
+	c.Assert(detail, Matches, "multipart upload cases require an S3 target.*")
+	c.Assert(target.Data, HasLen, 0)
+}
@@ -0,0 +1,1196 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	"github.com/dmolesUC3/cos/internal/streaming"
+	"github.com/dmolesUC3/cos/pkg"
+)
+
+// ------------------------------------------------------------
+// Helper types
+
+// MemoryTarget is an in-memory Target for testing
+type MemoryTarget struct {
+	Data     map[string][]byte
+	Metadata map[string]*Metadata
+}
+
+func NewMemoryTarget() *MemoryTarget {
+	return &MemoryTarget{Data: map[string][]byte{}, Metadata: map[string]*Metadata{}}
+}
+
+func (t *MemoryTarget) Object(key string) Object {
+	return &MemoryObject{Target: t, Key: key}
+}
+
+func (t *MemoryTarget) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var infos []ObjectInfo
+	for key, data := range t.Data {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, ObjectInfo{Key: key, Size: int64(len(data))})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, ctx.Err()
+}
+
+func (t *MemoryTarget) Pretty() string {
+	return fmt.Sprintf("MemoryTarget{ %d objects }", len(t.Data))
+}
+
+// MemoryObject is an in-memory Object for testing
+type MemoryObject struct {
+	Target *MemoryTarget
+	Key    string
+}
+
+func (o *MemoryObject) GetEndpoint() Target {
+	return o.Target
+}
+
+func (o *MemoryObject) Create(ctx context.Context, body io.Reader, length int64) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	o.Target.Data[o.Key] = data
+	return ctx.Err()
+}
+
+func (o *MemoryObject) ContentLength(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	data, ok := o.Target.Data[o.Key]
+	if !ok {
+		return 0, fmt.Errorf("no such object: %v: %w", o.Key, ErrNotFound)
+	}
+	return int64(len(data)), nil
+}
+
+func (o *MemoryObject) DownloadRange(ctx context.Context, startInclusive, endInclusive int64, buffer []byte) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	data := o.Target.Data[o.Key]
+	n := copy(buffer, data[startInclusive:endInclusive+1])
+	return int64(n), nil
+}
+
+func (o *MemoryObject) CreateWithMetadata(ctx context.Context, body io.Reader, length int64, metadata *Metadata) error {
+	if metadata != nil {
+		o.Target.Metadata[o.Key] = metadata
+	}
+	return o.Create(ctx, body, length)
+}
+
+func (o *MemoryObject) Metadata(ctx context.Context) (*Metadata, error) {
+	if _, err := o.ContentLength(ctx); err != nil {
+		return nil, err
+	}
+	if metadata, ok := o.Target.Metadata[o.Key]; ok {
+		return metadata, nil
+	}
+	return &Metadata{}, nil
+}
+
+func (o *MemoryObject) Delete(ctx context.Context) error {
+	delete(o.Target.Data, o.Key)
+	delete(o.Target.Metadata, o.Key)
+	return nil
+}
+
+func (o *MemoryObject) Pretty() string {
+	return "mem://" + o.Key
+}
+
+// failingObject is a MemoryObject whose uploads fail after reading the
+// specified number of bytes
+type failingObject struct {
+	*MemoryObject
+	after int64
+}
+
+func (o *failingObject) Create(ctx context.Context, body io.Reader, length int64) error {
+	if _, err := io.CopyN(ioutil.Discard, body, o.after); err != nil {
+		return err
+	}
+	return fmt.Errorf("upload of %v failed", o.Key)
+}
+
+// ------------------------------------------------------------
+// Fixture
+
+type ObjectsSuite struct {
+	target *MemoryTarget
+}
+
+var _ = Suite(&ObjectsSuite{})
+
+func (s *ObjectsSuite) SetUpTest(c *C) {
+	s.target = NewMemoryTarget()
+}
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *ObjectsSuite) TestOperationTimeout(c *C) {
+	ctx := context.Background()
+	c.Assert(OperationTimeout(ctx), Equals, time.Duration(0))
+
+	ctx = WithOperationTimeout(ctx, 90*time.Second)
+	c.Assert(OperationTimeout(ctx), Equals, 90*time.Second)
+}
+
+func (s *ObjectsSuite) TestCalcDigest(c *C) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	s.target.Data["digest"] = data
+
+	digest, err := CalcDigest(context.Background(), s.target.Object("digest"), 64, "sha256")
+	c.Assert(err, IsNil)
+
+	expected := sha256.Sum256(data)
+	c.Assert(digest, DeepEquals, expected[:])
+}
+
+func (s *ObjectsSuite) TestDownloadCancelled(c *C) {
+	s.target.Data["cancelled"] = make([]byte, 1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Download(ctx, s.target.Object("cancelled"), streaming.DefaultRangeSize, ioutil.Discard)
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *ObjectsSuite) TestKeystoneEnvironment(c *C) {
+	env := map[string]string{
+		"OS_IDENTITY_API_VERSION": "3",
+		"OS_PROJECT_NAME":         "env-project",
+		"OS_USER_DOMAIN_NAME":     "Default",
+		"OS_ENDPOINT_TYPE":        "internalURL",
+	}
+	for k, v := range env {
+		orig, set := os.LookupEnv(k)
+		c.Assert(os.Setenv(k, v), IsNil)
+		defer func(k, orig string, set bool) {
+			if set {
+				_ = os.Setenv(k, orig)
+			} else {
+				_ = os.Unsetenv(k)
+			}
+		}(k, orig, set)
+	}
+
+	keystone, err := Keystone{Project: "config-project"}.WithEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(keystone.AuthVersion, Equals, 3)
+	c.Assert(keystone.Project, Equals, "config-project")
+	c.Assert(keystone.UserDomain, Equals, "Default")
+	c.Assert(keystone.Interface, Equals, "internal")
+}
+
+func (s *ObjectsSuite) TestSwiftConnectionShared(c *C) {
+	authURL, err := url.Parse("http://keystone.example.org:5000/v3")
+	c.Assert(err, IsNil)
+	creds := Credentials{Source: CredentialsStatic, SwiftUser: "user", SwiftKey: "key"}
+
+	t1, err := NewSwiftEndpoint(authURL, "container-1", creds)
+	c.Assert(err, IsNil)
+	t2, err := NewSwiftEndpoint(authURL, "container-2", creds)
+	c.Assert(err, IsNil)
+
+	cnx1, err := t1.Connection()
+	c.Assert(err, IsNil)
+	cnx2, err := t2.Connection()
+	c.Assert(err, IsNil)
+	c.Assert(cnx1 == cnx2, Equals, true)
+}
+
+func (s *ObjectsSuite) TestS3ClientsShared(c *C) {
+	endpoint, _ := url.Parse("http://127.0.0.1:9000/")
+	creds := Credentials{Source: CredentialsStatic, AccessKeyID: "key", SecretAccessKey: "secret"}
+	target := NewS3Target("us-west-2", endpoint, "mrt-test", creds)
+	encrypted := target.WithEncryption(EncryptionConfig{Mode: EncryptionS3})
+
+	// clients are created once, even when first requested concurrently, and
+	// shared with copies
+	clients := make(chan interface{}, 8)
+	for i := 0; i < cap(clients); i++ {
+		t := target
+		if i%2 == 1 {
+			t = encrypted
+		}
+		go func() {
+			s3Svc, err := t.S3()
+			if err != nil {
+				clients <- err
+				return
+			}
+			clients <- s3Svc
+		}()
+	}
+	first := <-clients
+	for i := 1; i < cap(clients); i++ {
+		c.Assert(<-clients, Equals, first)
+	}
+}
+
+func (s *ObjectsSuite) TestLargeObjectConfig(c *C) {
+	loType, err := ParseLargeObjectType("")
+	c.Assert(err, IsNil)
+	c.Assert(loType, Equals, StaticLargeObject)
+	_, err = ParseLargeObjectType("mpu")
+	c.Assert(err, NotNil)
+
+	loConfig := LargeObjectConfig{Type: DynamicLargeObject, SegmentSize: 1024}.WithDefaults()
+	c.Assert(loConfig.Type, Equals, DynamicLargeObject)
+	c.Assert(loConfig.SegmentSize, Equals, int64(1024))
+	c.Assert(loConfig.Threshold, Equals, DefaultLargeObjectThreshold)
+}
+
+func (s *ObjectsSuite) TestMultipartETag(c *C) {
+	part1 := md5.Sum([]byte("part 1"))
+	part2 := md5.Sum([]byte("part 2"))
+	concatenated := md5.Sum(append(part1[:], part2[:]...))
+
+	expected := fmt.Sprintf("%x-2", concatenated)
+	c.Assert(MultipartETag([][]byte{part1[:], part2[:]}), Equals, expected)
+
+	mode, err := ParseUploadMode("")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, UploadAuto)
+	_, err = ParseUploadMode("chunked")
+	c.Assert(err, NotNil)
+}
+
+func (s *ObjectsSuite) TestMultipartLimits(c *C) {
+	// the limits are checked before anything is sent, so no server is needed
+	endpoint, _ := url.Parse("http://127.0.0.1:1/")
+	creds := Credentials{Source: CredentialsStatic, AccessKeyID: "key", SecretAccessKey: "secret"}
+	target := NewS3Target("us-west-2", endpoint, "mrt-test", creds)
+
+	target.Multipart = MultipartConfig{Mode: UploadMultipart, PartSize: 1024 * 1024}
+	err := target.Object("small-parts").Create(context.Background(), bytes.NewReader(nil), 3*1024*1024)
+	c.Assert(err, ErrorMatches, ".*non-final parts must be at least 5M")
+
+	target.Multipart = MultipartConfig{Mode: UploadAuto, PartSize: 5 * 1024 * 1024}
+	err = target.Object("too-many-parts").Create(context.Background(), bytes.NewReader(nil), 10001*5*1024*1024)
+	c.Assert(err, ErrorMatches, ".*10001 parts would exceed the S3 maximum of 10000")
+}
+
+func (s *ObjectsSuite) TestDownloadFrom(c *C) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	s.target.Data["resume"] = data
+
+	var out bytes.Buffer
+	n, err := DownloadFrom(context.Background(), s.target.Object("resume"), 250, 64, &out)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(750))
+	c.Assert(out.Bytes(), DeepEquals, data[250:])
+
+	_, err = DownloadFrom(context.Background(), s.target.Object("resume"), 1001, 64, &out)
+	c.Assert(err, NotNil)
+}
+
+func (s *ObjectsSuite) TestBulkCopy(c *C) {
+	src := NewMemoryTarget()
+	src.Data["src/a"] = []byte("alpha")
+	src.Data["src/b"] = []byte("beta")
+	src.Data["src/c"] = []byte("gamma")
+
+	var receipts []*pkg.Receipt
+	b := pkg.BulkCopy{
+		Source:            src,
+		SourcePrefix:      "src/",
+		Destination:       s.target,
+		DestinationPrefix: "dst/",
+		Keys:              []string{"a", "b", "c"},
+		Verify:            pkg.VerifyDownload,
+		Concurrency:       1,
+		Done:              []string{"mem://src/b"},
+		Copied:            func(r *pkg.Receipt) { receipts = append(receipts, r) },
+	}
+	copied, skipped, failed, err := b.CopyAll(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(copied, Equals, 2)
+	c.Assert(skipped, Equals, 1)
+	c.Assert(failed, Equals, 0)
+
+	c.Assert(s.target.Data["dst/a"], DeepEquals, []byte("alpha"))
+	c.Assert(s.target.Data["dst/c"], DeepEquals, []byte("gamma"))
+	_, ok := s.target.Data["dst/b"]
+	c.Assert(ok, Equals, false)
+
+	c.Assert(receipts, HasLen, 2)
+	expected := sha256.Sum256([]byte("alpha"))
+	c.Assert(receipts[0].Digests["sha256"], Equals, fmt.Sprintf("%x", expected))
+	c.Assert(receipts[0].Source, Equals, "mem://src/a")
+}
+
+func (s *ObjectsSuite) TestCopyUploadError(c *C) {
+	src := NewMemoryTarget()
+	src.Data["src"] = bytes.Repeat([]byte("0123456789"), 1000)
+	for _, after := range []int64{0, 64} {
+		dst := &failingObject{MemoryObject: s.target.Object("dst").(*MemoryObject), after: after}
+		cp := pkg.Copy{Source: src.Object("src"), Destination: dst, Verify: pkg.VerifyNone}
+		_, err := cp.CopyAndVerify(context.Background())
+		c.Assert(err, ErrorMatches, "upload of dst failed")
+	}
+}
+
+func (s *ObjectsSuite) TestDiff(c *C) {
+	src := NewMemoryTarget()
+	src.Data["src/same"] = []byte("same")
+	src.Data["src/missing"] = []byte("missing")
+	src.Data["src/size"] = []byte("size")
+	src.Data["src/digest"] = []byte("digest")
+
+	s.target.Data["dst/same"] = []byte("same")
+	s.target.Data["dst/size"] = []byte("sizes")
+	s.target.Data["dst/digest"] = []byte("DIGEST")
+	s.target.Data["dst/extra"] = []byte("extra")
+
+	d := pkg.Diff{
+		Source:            src,
+		SourcePrefix:      "src/",
+		Destination:       s.target,
+		DestinationPrefix: "dst/",
+		Digests:           true,
+		Concurrency:       1,
+	}
+	report, err := d.Compare(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(report.Compared, Equals, 5)
+
+	var statuses []string
+	for _, diff := range report.Differences {
+		statuses = append(statuses, diff.Key+":"+diff.Status)
+	}
+	c.Assert(statuses, DeepEquals, []string{"digest:digest", "extra:extra", "missing:missing", "size:size"})
+}
+
+func (s *ObjectsSuite) TestNextRange(c *C) {
+	start, end, size := streaming.NextRange(0, 5, 10)
+	c.Assert([]int64{start, end, int64(size)}, DeepEquals, []int64{0, 4, 5})
+	start, end, size = streaming.NextRange(5, 5, 10)
+	c.Assert([]int64{start, end, int64(size)}, DeepEquals, []int64{5, 9, 5})
+	start, end, size = streaming.NextRange(8, 5, 10)
+	c.Assert([]int64{start, end, int64(size)}, DeepEquals, []int64{8, 9, 2})
+
+	// ranges end exactly at the content length, and at the last byte
+	start, end, size = streaming.NextRange(0, 10, 10)
+	c.Assert([]int64{start, end, int64(size)}, DeepEquals, []int64{0, 9, 10})
+	start, end, size = streaming.NextRange(9, 5, 10)
+	c.Assert([]int64{start, end, int64(size)}, DeepEquals, []int64{9, 9, 1})
+	start, end, size = streaming.NextRange(0, 1, 10)
+	c.Assert([]int64{start, end, int64(size)}, DeepEquals, []int64{0, 0, 1})
+	start, end, size = streaming.NextRange(0, 64, 1)
+	c.Assert([]int64{start, end, int64(size)}, DeepEquals, []int64{0, 0, 1})
+
+	// consecutive ranges cover the content exactly once
+	var covered int64
+	for pos := int64(0); pos < 1000; {
+		start, end, size := streaming.NextRange(pos, 64, 1000)
+		c.Assert(start, Equals, pos)
+		c.Assert(size <= 64, Equals, true)
+		c.Assert(end-start+1, Equals, int64(size))
+		covered += int64(size)
+		pos = end + 1
+	}
+	c.Assert(covered, Equals, int64(1000))
+}
+
+func (s *ObjectsSuite) TestTeeReadSeeker(c *C) {
+	data := []byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit")
+	var teed bytes.Buffer
+	rs := streaming.NewTeeReadSeeker(bytes.NewReader(data), &teed)
+
+	// read part of the way, rewind, and read the whole thing twice, as when
+	// signing and then sending a request
+	buffer := make([]byte, 10)
+	_, err := io.ReadFull(rs, buffer)
+	c.Assert(err, IsNil)
+	for i := 0; i < 2; i++ {
+		_, err = rs.Seek(0, io.SeekStart)
+		c.Assert(err, IsNil)
+		all, err := ioutil.ReadAll(rs)
+		c.Assert(err, IsNil)
+		c.Assert(all, DeepEquals, data)
+	}
+	c.Assert(teed.Bytes(), DeepEquals, data)
+
+	// skipping unread bytes is an error
+	rs = streaming.NewTeeReadSeeker(bytes.NewReader(data), &teed)
+	_, err = rs.Seek(5, io.SeekStart)
+	c.Assert(err, IsNil)
+	_, err = rs.Read(buffer)
+	c.Assert(err, ErrorMatches, "can't read at offset 5.*")
+}
+
+func (s *ObjectsSuite) TestReplayReader(c *C) {
+	opened := 0
+	open := func() (io.Reader, error) {
+		opened++
+		gen, _ := pkg.Generator{Kind: pkg.GeneratorOffset}.NewReader(1024)
+		return gen, nil
+	}
+	expected, _ := pkg.Generator{Kind: pkg.GeneratorOffset}.NewReader(1000)
+	data, err := ioutil.ReadAll(expected)
+	c.Assert(err, IsNil)
+
+	rs := streaming.NewReplayReader(open, 1000)
+	all, err := ioutil.ReadAll(rs)
+	c.Assert(err, IsNil)
+	c.Assert(all, DeepEquals, data)
+
+	// seeking backward re-opens; seeking forward skips
+	pos, err := rs.Seek(-100, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(pos, Equals, int64(900))
+	all, err = ioutil.ReadAll(rs)
+	c.Assert(err, IsNil)
+	c.Assert(all, DeepEquals, data[900:])
+	c.Assert(opened, Equals, 2)
+
+	_, err = rs.Seek(200, io.SeekStart)
+	c.Assert(err, IsNil)
+	part := make([]byte, 50)
+	_, err = io.ReadFull(rs, part)
+	c.Assert(err, IsNil)
+	c.Assert(part, DeepEquals, data[200:250])
+	c.Assert(opened, Equals, 3)
+
+	// a stream shorter than expected is an error
+	short := streaming.NewReplayReader(open, 2000)
+	_, err = ioutil.ReadAll(short)
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *ObjectsSuite) TestLatencies(c *C) {
+	l := &pkg.Latencies{}
+	for i := 1; i <= 100; i++ {
+		l.Record(time.Duration(i)*time.Millisecond, 1e6, nil)
+	}
+	l.Record(time.Second, 1e6, fmt.Errorf("failed"))
+
+	summary := l.Summary(10 * time.Second)
+	c.Assert(summary.Count, Equals, 100)
+	c.Assert(summary.Errors, Equals, 1)
+	c.Assert(summary.OpsPerSecond, Equals, 10.0)
+	c.Assert(summary.MBPerSecond, Equals, 10.0)
+	c.Assert(summary.P50, Equals, 50.0)
+	c.Assert(summary.P90, Equals, 90.0)
+	c.Assert(summary.P99, Equals, 99.0)
+	c.Assert(summary.Max, Equals, 100.0)
+}
+
+func (s *ObjectsSuite) TestLatencyHistogram(c *C) {
+	l := &pkg.Latencies{}
+	for i := 1; i <= 100; i++ {
+		l.Record(time.Duration(i)*time.Millisecond, 0, nil)
+	}
+	l.Record(time.Minute, 0, nil)
+
+	bounds := []time.Duration{10 * time.Millisecond, 50 * time.Millisecond, time.Second}
+	histogram := l.Histogram(bounds)
+	c.Assert(len(histogram), Equals, 4)
+	counts := []int{10, 40, 50, 1}
+	for i, count := range counts {
+		c.Assert(histogram[i].Count, Equals, count)
+	}
+	c.Assert(histogram[1].UpperBound, Equals, 50.0)
+	c.Assert(math.IsInf(histogram[3].UpperBound, 1), Equals, true)
+
+	data, err := json.Marshal(histogram[3])
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{"le_ms":"+Inf","count":1}`)
+}
+
+// memoryResolver resolves all job URLs as keys in a MemoryTarget
+type memoryResolver struct {
+	target *MemoryTarget
+}
+
+func (r memoryResolver) Target(req *pkg.JobRequest) (Target, error) {
+	return r.target, nil
+}
+
+func (r memoryResolver) Object(req *pkg.JobRequest) (Object, error) {
+	return r.target.Object(req.URL), nil
+}
+
+func (s *ObjectsSuite) TestJobServer(c *C) {
+	dir := c.MkDir()
+	s.target.Data["a"] = []byte("alpha")
+	expected := sha256.Sum256([]byte("alpha"))
+
+	server, err := pkg.NewJobServer(dir, 1, memoryResolver{s.target})
+	c.Assert(err, IsNil)
+	_, err = server.Submit(pkg.JobRequest{Type: "fsck", URL: "a"})
+	c.Assert(err, NotNil)
+	job, err := server.Submit(pkg.JobRequest{Type: pkg.JobCheck, URL: "a", Expected: fmt.Sprintf("%x", expected)})
+	c.Assert(err, IsNil)
+	c.Assert(job.State, Equals, pkg.JobQueued)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.Run(ctx)
+		close(done)
+	}()
+	for !job.Done() {
+		time.Sleep(10 * time.Millisecond)
+		job, _ = server.Job(job.ID)
+	}
+	cancel()
+	<-done
+
+	c.Assert(job.State, Equals, pkg.JobSucceeded)
+	c.Assert(job.Progress.Completed, Equals, int64(5))
+	var result pkg.CheckJobResult
+	c.Assert(json.Unmarshal(job.Result, &result), IsNil)
+	c.Assert(result.Digest, Equals, fmt.Sprintf("%x", expected))
+	c.Assert(result.Verified, Equals, true)
+
+	// a job left running by a previous server is restarted
+	interrupted := pkg.Job{ID: "interrupted", Request: pkg.JobRequest{Type: pkg.JobCrvd}, State: pkg.JobRunning, Created: time.Now()}
+	data, err := json.Marshal(interrupted)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "interrupted.json"), data, 0644), IsNil)
+
+	server, err = pkg.NewJobServer(dir, 1, memoryResolver{s.target})
+	c.Assert(err, IsNil)
+	jobs := server.Jobs()
+	c.Assert(jobs, HasLen, 2)
+	c.Assert(jobs[0].State, Equals, pkg.JobSucceeded)
+	c.Assert(jobs[1].State, Equals, pkg.JobQueued)
+	c.Assert(jobs[1].Restarts, Equals, 1)
+}
+
+func (s *ObjectsSuite) TestAudit(c *C) {
+	db, err := pkg.OpenAuditDB(filepath.Join(c.MkDir(), "audit.db"))
+	c.Assert(err, IsNil)
+	defer func() {
+		_ = db.Close()
+	}()
+	s.target.Data["a"] = []byte("alpha")
+	s.target.Data["b"] = []byte("bravo")
+	s.target.Data["c"] = []byte("charlie")
+	added, err := db.Add(
+		pkg.AuditObject{URL: "a", Size: 5},
+		pkg.AuditObject{URL: "b", Size: 5},
+		pkg.AuditObject{URL: "c", Size: 7, Priority: 1},
+	)
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 3)
+
+	var order []string
+	audit := &pkg.Audit{
+		DB:       db,
+		MinAge:   time.Hour,
+		MaxBytes: 12,
+		Resolve: func(obj *pkg.AuditObject) (Object, error) {
+			return s.target.Object(obj.URL), nil
+		},
+		Report: func(obj *pkg.AuditObject, check pkg.AuditCheck) {
+			order = append(order, check.URL)
+		},
+	}
+	summary, err := audit.Run(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"c", "a"})
+	c.Assert(summary.OK, Equals, 2)
+	c.Assert(summary.Deferred, Equals, 1)
+
+	// recently checked objects are not due again
+	delete(s.target.Data, "a")
+	s.target.Data["c"] = []byte("charlie!")
+	order = nil
+	audit.MaxBytes = 0
+	summary, err = audit.Run(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"b"})
+	c.Assert(summary.Failed(), Equals, 0)
+
+	audit.MinAge = 0
+	summary, err = audit.Run(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(summary.Checked, Equals, 3)
+	c.Assert(summary.Changed, Equals, 1)
+	c.Assert(summary.Missing, Equals, 1)
+
+	obj, err := db.Object("c")
+	c.Assert(err, IsNil)
+	c.Assert(obj.LastStatus, Equals, pkg.AuditChanged)
+	c.Assert(obj.Expected, Equals, fmt.Sprintf("%x", sha256.Sum256([]byte("charlie"))))
+	history, err := db.History("a")
+	c.Assert(err, IsNil)
+	c.Assert(history, HasLen, 2)
+	c.Assert(history[0].Status, Equals, pkg.AuditOK)
+	c.Assert(history[1].Status, Equals, pkg.AuditMissing)
+
+	removed, err := db.Remove("a")
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, true)
+	history, err = db.History("")
+	c.Assert(err, IsNil)
+	c.Assert(history, HasLen, 4)
+}
+
+func (s *ObjectsSuite) TestAuditDBLocation(c *C) {
+	db, err := pkg.OpenAuditDB(filepath.Join(c.MkDir(), "audit.db"))
+	c.Assert(err, IsNil)
+	defer func() {
+		_ = db.Close()
+	}()
+	const url = "s3://mrt-test/ark/42"
+	source := pkg.AuditObject{URL: url, Endpoint: "http://127.0.0.1:9000/", Region: "us-west-2", Size: 5}
+	added, err := db.Add(source)
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 1)
+
+	// re-adding at the same location updates the settings
+	source.Priority = 2
+	added, err = db.Add(source)
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 0)
+
+	// the same URL on another endpoint is rejected, not merged
+	destination := pkg.AuditObject{URL: url, Endpoint: "https://s3.us-east-1.amazonaws.com/", Region: "us-west-2", Size: 5}
+	_, err = db.Add(destination)
+	c.Assert(err, ErrorMatches, url+" is already audited with .*remove it first.*")
+	destination = pkg.AuditObject{URL: url, Endpoint: source.Endpoint, Profile: "minio", Size: 5}
+	_, err = db.Add(destination)
+	c.Assert(err, NotNil)
+
+	obj, err := db.Object(url)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Endpoint, Equals, source.Endpoint)
+	c.Assert(obj.Profile, Equals, "")
+	c.Assert(obj.Priority, Equals, 2)
+}
+
+func (s *ObjectsSuite) TestAuditBudgets(c *C) {
+	db, err := pkg.OpenAuditDB(filepath.Join(c.MkDir(), "audit.db"))
+	c.Assert(err, IsNil)
+	defer func() {
+		_ = db.Close()
+	}()
+	s.target.Data["first"] = []byte("charlie")
+	s.target.Data["large"] = bytes.Repeat([]byte("x"), 100)
+	s.target.Data["second"] = []byte("abc")
+	s.target.Data["last"] = []byte("bravo")
+	_, err = db.Add(
+		pkg.AuditObject{URL: "first", Size: 7, Priority: 3},
+		pkg.AuditObject{URL: "large", Size: 100, Priority: 2},
+		pkg.AuditObject{URL: "second", Size: 3, Priority: 1},
+		pkg.AuditObject{URL: "last", Size: 5},
+	)
+	c.Assert(err, IsNil)
+
+	// "large" is deferred by the byte budget, and "last" by the time budget
+	var order []string
+	audit := &pkg.Audit{
+		DB:       db,
+		MaxBytes: 10,
+		MaxTime:  50 * time.Millisecond,
+		Resolve: func(obj *pkg.AuditObject) (Object, error) {
+			return s.target.Object(obj.URL), nil
+		},
+		Report: func(obj *pkg.AuditObject, check pkg.AuditCheck) {
+			order = append(order, check.URL)
+			if check.URL == "second" {
+				time.Sleep(60 * time.Millisecond)
+			}
+		},
+	}
+	summary, err := audit.Run(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"first", "second"})
+	c.Assert(summary.Checked, Equals, 2)
+	c.Assert(summary.Deferred, Equals, 2)
+}
+
+func (s *ObjectsSuite) TestSampleStatistics(c *C) {
+	n, err := pkg.DiscoverySampleSize(1000000000, 0.95, 0.01)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 299)
+	n, err = pkg.DiscoverySampleSize(100, 0.95, 0.01)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 95)
+	n, err = pkg.DiscoverySampleSize(10, 0.99, 0.01)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 10)
+	_, err = pkg.DiscoverySampleSize(10, 1, 0.01)
+	c.Assert(err, NotNil)
+
+	c.Assert(pkg.UpperConfidenceBound(0, 299, 0.95) <= 0.01, Equals, true)
+	lower, upper := pkg.ClopperPearsonInterval(5, 10, 0.95)
+	c.Assert(math.Abs(lower-0.1871) < 1e-4, Equals, true, Commentf("lower: %v", lower))
+	c.Assert(math.Abs(upper-0.8129) < 1e-4, Equals, true, Commentf("upper: %v", upper))
+	lower, upper = pkg.ClopperPearsonInterval(0, 10, 0.95)
+	c.Assert(lower, Equals, 0.0)
+	c.Assert(math.Abs(upper-0.3085) < 1e-4, Equals, true, Commentf("upper: %v", upper))
+}
+
+func (s *ObjectsSuite) TestSampleAudit(c *C) {
+	var manifest []pkg.ManifestEntry
+	for i := 0; i < 100; i++ {
+		data := []byte(fmt.Sprintf("object %d", i))
+		digest := sha256.Sum256(data)
+		key := fmt.Sprintf("%02d", i)
+		s.target.Data["ark/"+key] = data
+		manifest = append(manifest, pkg.ManifestEntry{Key: key, Size: int64(len(data)), Digest: digest[:]})
+	}
+	sampled := func(manifest []pkg.ManifestEntry) (*pkg.SampleReport, []string) {
+		var keys []string
+		audit := &pkg.SampleAudit{
+			Target: s.target, Prefix: "ark/", Manifest: manifest, Confidence: 0.95, ErrorRate: 0.05, Seed: 42, Concurrency: 1,
+			Report: func(r pkg.SampleResult) { keys = append(keys, r.Key) },
+		}
+		report, err := audit.Run(context.Background())
+		c.Assert(err, IsNil)
+		return report, keys
+	}
+	report, keys := sampled(nil)
+	c.Assert(report.Population, Equals, 100)
+	c.Assert(report.SampleSize, Equals, 45)
+	c.Assert(report.Failed, Equals, 0)
+	c.Assert(report.UpperBound > 0, Equals, true)
+	_, again := sampled(manifest)
+	c.Assert(again, DeepEquals, keys)
+
+	s.target.Data["ark/"+keys[0]] = []byte("corrupted")
+	s.target.Data["ark/"+keys[1]] = []byte("object ?")
+	delete(s.target.Data, "ark/"+keys[2])
+	report, _ = sampled(manifest)
+	c.Assert(report.Failed, Equals, 3)
+	statuses := map[string]string{}
+	for _, f := range report.Failures {
+		statuses[f.Key] = f.Status
+	}
+	c.Assert(statuses, DeepEquals, map[string]string{keys[0]: pkg.AuditChanged, keys[1]: pkg.AuditChanged, keys[2]: pkg.AuditMissing})
+	c.Assert(report.FailureRate, Equals, 3.0/45)
+	c.Assert(report.IntervalLower > 0, Equals, true)
+	c.Assert(report.IntervalUpper > report.FailureRate, Equals, true)
+}
+
+func (s *ObjectsSuite) TestBlockManifest(c *C) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	s.target.Data["blocks"] = data
+	obj := s.target.Object("blocks")
+
+	rangeDigest, err := CalcRangeDigest(context.Background(), obj, 100, 199, 64, "sha256")
+	c.Assert(err, IsNil)
+	expected := sha256.Sum256(data[100:200])
+	c.Assert(rangeDigest, DeepEquals, expected[:])
+	_, err = CalcRangeDigest(context.Background(), obj, 100, 1000, 64, "sha256")
+	c.Assert(err, NotNil)
+
+	manifest, err := pkg.NewBlockManifest(context.Background(), obj, 300, "sha256")
+	c.Assert(err, IsNil)
+	c.Assert(manifest.Size, Equals, int64(1000))
+	c.Assert(manifest.Blocks, HasLen, 4)
+	c.Assert(manifest.BlockCount(), Equals, 4)
+	lastBlock := sha256.Sum256(data[900:])
+	c.Assert(manifest.Blocks[3], Equals, fmt.Sprintf("%x", lastBlock))
+	start, end := manifest.BlockRange(3)
+	c.Assert([]int64{start, end}, DeepEquals, []int64{900, 999})
+
+	path := filepath.Join(c.MkDir(), "blocks.json")
+	c.Assert(manifest.Write(path), IsNil)
+	manifest, err = pkg.ReadBlockManifest(path)
+	c.Assert(err, IsNil)
+
+	spot := pkg.SpotCheck{Object: obj, Manifest: manifest, Blocks: 10, Seed: 1}
+	results, err := spot.Run(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 4)
+
+	data[650] ^= 0xff
+	results, err = spot.Run(context.Background())
+	c.Assert(err, NotNil)
+	for _, r := range results {
+		c.Assert(r.OK(), Equals, r.Block != 2, Commentf("block %d", r.Block))
+	}
+
+	s.target.Data["blocks"] = data[:999]
+	_, err = spot.Run(context.Background())
+	c.Assert(err, ErrorMatches, "size mismatch.*")
+}
+
+func (s *ObjectsSuite) TestBlockTree(c *C) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	s.target.Data["tree"] = data
+	obj := s.target.Object("tree")
+
+	expected, err := pkg.NewBlockManifest(context.Background(), obj, 100, "sha256")
+	c.Assert(err, IsNil)
+	c.Assert(expected.Root, Not(Equals), "")
+
+	sidecar := s.target.Object("tree" + pkg.SidecarSuffix)
+	c.Assert(expected.Upload(context.Background(), sidecar), IsNil)
+	expected, err = pkg.DownloadBlockManifest(context.Background(), sidecar)
+	c.Assert(err, IsNil)
+
+	actual, err := pkg.NewBlockManifest(context.Background(), obj, 100, "sha256")
+	c.Assert(err, IsNil)
+	c.Assert(actual.Root, Equals, expected.Root)
+	ranges, err := expected.Compare(actual)
+	c.Assert(err, IsNil)
+	c.Assert(ranges, HasLen, 0)
+
+	changed := append([]byte(nil), data...)
+	changed[50] ^= 0xff
+	changed[250] ^= 0xff
+	changed[350] ^= 0xff
+	changed[999] ^= 0xff
+	s.target.Data["tree"] = changed
+	actual, err = pkg.NewBlockManifest(context.Background(), obj, 100, "sha256")
+	c.Assert(err, IsNil)
+	c.Assert(actual.Root, Not(Equals), expected.Root)
+	ranges, err = expected.Compare(actual)
+	c.Assert(err, IsNil)
+	c.Assert(ranges, DeepEquals, []pkg.ByteRange{{Start: 0, End: 99}, {Start: 200, End: 399}, {Start: 900, End: 999}})
+
+	s.target.Data["tree"] = data[:550]
+	actual, err = pkg.NewBlockManifest(context.Background(), obj, 100, "sha256")
+	c.Assert(err, IsNil)
+	ranges, err = expected.Compare(actual)
+	c.Assert(err, IsNil)
+	c.Assert(ranges, DeepEquals, []pkg.ByteRange{{Start: 500, End: 999}})
+
+	actual, err = pkg.NewBlockManifest(context.Background(), obj, 200, "sha256")
+	c.Assert(err, IsNil)
+	_, err = expected.Compare(actual)
+	c.Assert(err, NotNil)
+
+	_, err = pkg.ParseBlockManifest([]byte(`{"size": 200, "block_size": 100, "algorithm": "sha256", "root": "00", "blocks": ["01", "02"]}`), "test")
+	c.Assert(err, ErrorMatches, ".*do not match root.*")
+}
+
+func (s *ObjectsSuite) TestGenerators(c *C) {
+	read := func(g pkg.Generator, size int64) []byte {
+		r, err := g.NewReader(size)
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		c.Assert(data, HasLen, int(size))
+		return data
+	}
+
+	for _, kind := range pkg.GeneratorKinds {
+		g := pkg.Generator{Kind: kind, Seed: 42, Pattern: "abc"}
+		c.Assert(read(g, 1000), DeepEquals, read(g, 1000), Commentf("%v", g))
+	}
+	c.Assert(read(pkg.Generator{Kind: pkg.GeneratorCrypto, Seed: 1}, 64), Not(DeepEquals), read(pkg.Generator{Kind: pkg.GeneratorCrypto, Seed: 2}, 64))
+	c.Assert(read(pkg.Generator{Kind: pkg.GeneratorZero}, 16), DeepEquals, make([]byte, 16))
+	c.Assert(string(read(pkg.Generator{Kind: pkg.GeneratorPattern, Pattern: "abc"}, 8)), Equals, "abcabcab")
+
+	text := read(pkg.Generator{Kind: pkg.GeneratorText, Seed: 1}, 10000)
+	c.Assert(strings.Count(string(text), "\n") > 0, Equals, true)
+
+	offsets := read(pkg.Generator{Kind: pkg.GeneratorOffset}, 8*1024+3)
+	for _, offset := range []int{0, 8, 4096, 8 * 1023} {
+		c.Assert(binary.BigEndian.Uint64(offsets[offset:offset+8]), Equals, uint64(offset))
+	}
+	c.Assert(offsets[8*1024:], DeepEquals, []byte{0, 0, 0})
+
+	_, err := pkg.Generator{Kind: "bogus"}.NewReader(8)
+	c.Assert(err, NotNil)
+	_, err = pkg.Generator{Kind: pkg.GeneratorPattern}.NewReader(8)
+	c.Assert(err, NotNil)
+
+	crvd, err := pkg.NewCrvdWithGenerator(s.target, "generated", 1000, pkg.Generator{Kind: pkg.GeneratorOffset})
+	c.Assert(err, IsNil)
+	c.Assert(crvd.CreateRetrieveVerify(context.Background()), IsNil)
+	c.Assert(s.target.Data["generated"], DeepEquals, offsets[:1000])
+}
+
+func (s *ObjectsSuite) TestCrvdVerifyExisting(c *C) {
+	generator := pkg.Generator{Kind: pkg.GeneratorText, Seed: 7}
+	crvd, err := pkg.NewCrvdWithGenerator(s.target, "kept", 5000, generator)
+	c.Assert(err, IsNil)
+	crvd.WriteMetadata = true
+	c.Assert(crvd.CreateRetrieveVerify(context.Background()), IsNil)
+
+	user := s.target.Metadata["kept"].User
+	c.Assert(user[pkg.CrvdMetaGenerator], Equals, pkg.GeneratorText)
+	c.Assert(user[pkg.CrvdMetaSeed], Equals, "7")
+	c.Assert(user[pkg.CrvdMetaSize], Equals, "5000")
+	expected := sha256.Sum256(s.target.Data["kept"])
+	c.Assert(user[pkg.CrvdMetaSHA256], Equals, fmt.Sprintf("%x", expected))
+
+	receipt, err := crvd.NewReceipt(time.Now())
+	c.Assert(err, IsNil)
+	path := filepath.Join(c.MkDir(), "receipt.json")
+	c.Assert(receipt.WriteTo(path), IsNil)
+	receipt, err = pkg.ReadReceipt(path)
+	c.Assert(err, IsNil)
+	c.Assert(*receipt.Generator, Equals, generator)
+
+	existing, err := pkg.CrvdFromMetadata(context.Background(), s.target.Object("kept"))
+	c.Assert(err, IsNil)
+	digest, err := existing.VerifyExisting(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(digest, DeepEquals, expected[:])
+
+	fromReceipt, err := pkg.CrvdFromReceipt(s.target.Object("kept"), receipt)
+	c.Assert(err, IsNil)
+	_, err = fromReceipt.VerifyExisting(context.Background())
+	c.Assert(err, IsNil)
+
+	s.target.Data["kept"][100] ^= 0xff
+	_, err = existing.VerifyExisting(context.Background())
+	c.Assert(err, ErrorMatches, "(?s)digest mismatch.*")
+
+	user[pkg.CrvdMetaSeed] = "8"
+	changed, err := pkg.CrvdFromMetadata(context.Background(), s.target.Object("kept"))
+	c.Assert(err, IsNil)
+	_, err = changed.VerifyExisting(context.Background())
+	c.Assert(err, ErrorMatches, "regenerated digest .* does not match recorded digest .*")
+
+	s.target.Data["plain"] = []byte("plain")
+	_, err = pkg.CrvdFromMetadata(context.Background(), s.target.Object("plain"))
+	c.Assert(err, ErrorMatches, ".* has no crvd metadata")
+}
+
+func (s *ObjectsSuite) TestPut(c *C) {
+	data := []byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit")
+	path := filepath.Join(c.MkDir(), "lorem.txt")
+	c.Assert(ioutil.WriteFile(path, data, 0644), IsNil)
+
+	for _, verify := range pkg.VerifyModes {
+		key := "lorem-" + verify
+		put := pkg.Put{Object: s.target.Object(key), Path: path, Verify: verify}
+		receipt, err := put.UploadAndVerify(context.Background())
+		c.Assert(err, IsNil, Commentf(verify))
+		c.Assert(s.target.Data[key], DeepEquals, data, Commentf(verify))
+
+		c.Check(receipt.Object, Equals, s.target.Object(key).Pretty())
+		c.Check(receipt.Source, Equals, path)
+		c.Check(receipt.Destination, Equals, "")
+		c.Check(receipt.Size, Equals, int64(len(data)))
+		c.Check(receipt.Verification, Equals, verify)
+		c.Check(receipt.Digests, DeepEquals, map[string]string{
+			"md5":    fmt.Sprintf("%x", md5.Sum(data)),
+			"sha256": fmt.Sprintf("%x", sha256.Sum256(data)),
+		})
+	}
+
+	put := pkg.Put{Object: s.target.Object("lorem-bad"), Path: path, Verify: "md5"}
+	_, err := put.UploadAndVerify(context.Background())
+	c.Assert(err, ErrorMatches, "unsupported verification mode.*")
+	c.Assert(s.target.Data["lorem-bad"], IsNil)
+}
+
+func (s *ObjectsSuite) TestReceiptJSON(c *C) {
+	receipt := pkg.Receipt{
+		Object:         "s3://mrt-test/lorem.txt",
+		Source:         "/tmp/lorem.txt",
+		Size:           56,
+		Digests:        map[string]string{"sha256": "2a3a5f"},
+		Verification:   pkg.VerifyDownload,
+		Started:        time.Date(2019, 3, 14, 15, 9, 26, 0, time.UTC),
+		ElapsedSeconds: 1.5,
+	}
+
+	data, err := json.Marshal(receipt)
+	c.Assert(err, IsNil)
+	var fields map[string]interface{}
+	c.Assert(json.Unmarshal(data, &fields), IsNil)
+	c.Assert(fields, DeepEquals, map[string]interface{}{
+		"object":          "s3://mrt-test/lorem.txt",
+		"source":          "/tmp/lorem.txt",
+		"size":            float64(56),
+		"digests":         map[string]interface{}{"sha256": "2a3a5f"},
+		"verification":    "download",
+		"started":         "2019-03-14T15:09:26Z",
+		"elapsed_seconds": 1.5,
+	})
+
+	path := filepath.Join(c.MkDir(), "receipt.json")
+	c.Assert(receipt.WriteTo(path), IsNil)
+	actual, err := pkg.ReadReceipt(path)
+	c.Assert(err, IsNil)
+	c.Assert(*actual, DeepEquals, receipt)
+
+	logPath := filepath.Join(c.MkDir(), "receipts.jsonl")
+	log, err := pkg.OpenReceiptLog(logPath)
+	c.Assert(err, IsNil)
+	c.Assert(log.Append(&receipt), IsNil)
+	c.Assert(log.Close(), IsNil)
+	// an incomplete final line is ignored
+	partial, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	c.Assert(err, IsNil)
+	_, err = partial.Write(data[:len(data)/2])
+	c.Assert(err, IsNil)
+	c.Assert(partial.Close(), IsNil)
+
+	receipts, err := pkg.ReadReceiptLog(logPath)
+	c.Assert(err, IsNil)
+	c.Assert(receipts, DeepEquals, []pkg.Receipt{receipt})
+}
+
+func (s *ObjectsSuite) TestPutWithMetadata(c *C) {
+	path := filepath.Join(c.MkDir(), "report.csv")
+	c.Assert(ioutil.WriteFile(path, []byte("a,b\n1,2\n"), 0644), IsNil)
+
+	metadata := &Metadata{
+		ContentType: "text/csv",
+		User:        map[string]string{"source": "merritt"},
+		Tags:        map[string]string{"retention": "7y"},
+	}
+	put := pkg.Put{Object: s.target.Object("report.csv"), Path: path, Verify: pkg.VerifyDownload, Metadata: metadata}
+	_, err := put.UploadAndVerify(context.Background())
+	c.Assert(err, IsNil)
+
+	actual, err := s.target.Object("report.csv").(MetadataObject).Metadata(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(actual.ContentType, Equals, "text/csv")
+	c.Assert(actual.User, DeepEquals, metadata.User)
+	c.Assert(actual.Tags, DeepEquals, metadata.Tags)
+}
+
+func (s *ObjectsSuite) TestGetResume(c *C) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	s.target.Data["resume.bin"] = data
+	expected := sha256.Sum256(data)
+	path := filepath.Join(c.MkDir(), "resume.bin")
+
+	// without verification, an existing file is only resumed with Resume
+	c.Assert(ioutil.WriteFile(path, data[:300], 0644), IsNil)
+	get := pkg.Get{Object: s.target.Object("resume.bin"), Path: path}
+	_, err := get.DownloadAndVerify(context.Background())
+	c.Assert(err, ErrorMatches, "existing file .* can't be resumed: .*")
+
+	get.Resume = true
+	receipt, err := get.DownloadAndVerify(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(receipt.Verification, Equals, pkg.VerifyNone)
+	c.Assert(receipt.Digests["sha256"], Equals, hex.EncodeToString(expected[:]))
+
+	// with verification, a partial file is resumed
+	c.Assert(ioutil.WriteFile(path, data[:300], 0644), IsNil)
+	get = pkg.Get{Object: s.target.Object("resume.bin"), Path: path, Expected: expected[:]}
+	receipt, err = get.DownloadAndVerify(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(receipt.Verification, Equals, pkg.VerifyExpected)
+	actual, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(actual, DeepEquals, data)
+
+	// an unrelated file fails verification, and is removed
+	c.Assert(ioutil.WriteFile(path, []byte("unrelated"), 0644), IsNil)
+	_, err = get.DownloadAndVerify(context.Background())
+	c.Assert(err, ErrorMatches, "(?s)digest mismatch.*\\(removed .*\\)")
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ObjectsSuite) TestMultipartUploadMatches(c *C) {
+	now := time.Now()
+	upload := MultipartUpload{Key: "cos-crvd-1234", UploadID: "upload-1", Initiated: now.Add(-time.Hour)}
+
+	c.Check(upload.Matches("", time.Time{}), Equals, true)
+	c.Check(upload.Matches("cos-crvd-", time.Time{}), Equals, true)
+	c.Check(upload.Matches("cos-crvd-1234", time.Time{}), Equals, true)
+	c.Check(upload.Matches("cos-bench-", time.Time{}), Equals, false)
+	c.Check(upload.Matches("cos-crvd-12345", time.Time{}), Equals, false)
+
+	c.Check(upload.Matches("", now), Equals, true)
+	c.Check(upload.Matches("", now.Add(-2*time.Hour)), Equals, false)
+	// initiated exactly at the cutoff isn't "before" it
+	c.Check(upload.Matches("", upload.Initiated), Equals, false)
+
+	c.Check(upload.Matches("cos-crvd-", now), Equals, true)
+	c.Check(upload.Matches("cos-bench-", now), Equals, false)
+	c.Check(upload.Matches("cos-crvd-", now.Add(-2*time.Hour)), Equals, false)
+}
+
+func (s *ObjectsSuite) TestEncryptionConfig(c *C) {
+	key := make([]byte, CustomerKeySize)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	dir := c.MkDir()
+	for name, data := range map[string][]byte{
+		"raw":    key,
+		"base64": []byte(base64.StdEncoding.EncodeToString(key) + "\n"),
+		"hex":    []byte(hex.EncodeToString(key) + "\n"),
+	} {
+		path := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(path, data, 0600), IsNil)
+		actual, err := ReadCustomerKey(path)
+		c.Assert(err, IsNil)
+		c.Assert(actual, DeepEquals, key)
+	}
+	short := filepath.Join(dir, "short")
+	c.Assert(ioutil.WriteFile(short, key[:16], 0600), IsNil)
+	_, err := ReadCustomerKey(short)
+	c.Assert(err, ErrorMatches, ".* does not contain a 32-byte customer key .*")
+
+	mode, err := ParseEncryptionMode("KMS")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, EncryptionKMS)
+	_, err = ParseEncryptionMode("aes")
+	c.Assert(err, ErrorMatches, "unsupported encryption mode.*")
+
+	c.Assert(EncryptionConfig{}.Validate(), IsNil)
+	c.Assert(EncryptionConfig{}.Enabled(), Equals, false)
+	c.Assert(EncryptionConfig{Mode: EncryptionCustomer, CustomerKey: key}.Validate(), IsNil)
+	c.Assert(EncryptionConfig{Mode: EncryptionCustomer}.Validate(), ErrorMatches, "SSE-C requires a 32-byte customer key.*")
+	c.Assert(EncryptionConfig{Mode: EncryptionS3, KMSKeyID: "alias/cos"}.Validate(), ErrorMatches, "a KMS key ID requires .*")
+	c.Assert(EncryptionConfig{Mode: EncryptionKMS}.ETagIsMD5(), Equals, false)
+	c.Assert(EncryptionConfig{Mode: EncryptionS3}.ExpectedAlgorithm(), Equals, "AES256")
+
+	swift, _ := url.Parse("swift://container/")
+	endpoint, _ := url.Parse("http://swift.example.org/auth/v1.0")
+	_, err = NewTarget(endpoint, swift, TargetConfig{Encryption: EncryptionConfig{Mode: EncryptionS3}})
+	c.Assert(err, ErrorMatches, "server-side encryption .* is not supported for Swift")
+}
+
+func (s *ObjectsSuite) TestS3ObjectVersion(c *C) {
+	endpoint, _ := url.Parse("http://127.0.0.1:9000/")
+	obj := NewS3Target("us-west-2", endpoint, "mrt-test", Credentials{}).Object("archive.zip").(*S3Object)
+	c.Assert(obj.CurrentVersionID(), Equals, "")
+	c.Assert(obj.CreatedVersions(), HasLen, 0)
+
+	version := obj.Version("3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY")
+	c.Assert(version.CurrentVersionID(), Equals, "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY")
+	c.Assert(version.Pretty(), Equals, "s3://mrt-test/archive.zip (version 3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY)")
+	c.Assert(version.Version("").Pretty(), Equals, obj.Pretty())
+
+	err := version.Create(context.Background(), strings.NewReader("data"), 4)
+	c.Assert(err, ErrorMatches, "can't create .*: versions can't be overwritten")
+	_, err = version.RestoreVersion(context.Background(), "older")
+	c.Assert(err, ErrorMatches, "can't restore over .*: versions can't be overwritten")
+}
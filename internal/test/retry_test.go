@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/ncw/swift/v2"
+	. "gopkg.in/check.v1"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+)
+
+// ------------------------------------------------------------
+// Fixture
+
+type RetrySuite struct {
+}
+
+var _ = Suite(&RetrySuite{})
+
+// ------------------------------------------------------------
+// Tests
+
+func (s *RetrySuite) TestClassifyFailure(c *C) {
+	cases := []struct {
+		statusCode int
+		err        error
+		class      RetryClass
+		ok         bool
+	}{
+		{500, errors.New("InternalError"), RetryServerError, true},
+		{503, errors.New("SlowDown: Please reduce your request rate."), RetryThrottled, true},
+		{429, errors.New("TooManyRequests"), RetryThrottled, true},
+		{0, syscall.ECONNRESET, RetryConnection, true},
+		{0, io.ErrUnexpectedEOF, RetryConnection, true},
+		{404, errors.New("NotFound"), "", false},
+		{403, errors.New("AccessDenied"), "", false},
+		{0, context.DeadlineExceeded, "", false},
+		{0, nil, "", false},
+
+		// AWS errors are classified by code
+		{503, awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "req-1"), RetryThrottled, true},
+		{400, awserr.NewRequestFailure(awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil), 400, "req-2"), RetryThrottled, true},
+		{500, awserr.NewRequestFailure(awserr.New("InternalError", "Throttling queue full", nil), 500, "req-3"), RetryServerError, true},
+		{404, awserr.NewRequestFailure(awserr.New("NoSuchKey", "No such key: reports/SlowDown.csv", nil), 404, "req-4"), "", false},
+		{0, fmt.Errorf("copy failed: %w", awserr.New("SlowDown", "Please reduce your request rate.", nil)), RetryThrottled, true},
+
+		// Swift errors are classified by status
+		{498, swift.RateLimit, RetryThrottled, true},
+		{429, swift.TooManyRequests, RetryThrottled, true},
+		{0, fmt.Errorf("uploading segments/Throttling.bin: %w", swift.ObjectNotFound), "", false},
+
+		// other errors fall back to the message
+		{0, errors.New("RequestLimitExceeded"), RetryThrottled, true},
+		{0, errors.New("AccessDenied"), "", false},
+	}
+	for _, tc := range cases {
+		class, ok := ClassifyFailure(tc.statusCode, tc.err)
+		c.Check(ok, Equals, tc.ok, Commentf("%d %v", tc.statusCode, tc.err))
+		c.Check(class, Equals, tc.class, Commentf("%d %v", tc.statusCode, tc.err))
+	}
+}
+
+func (s *RetrySuite) TestShouldRetry(c *C) {
+	policy := RetryPolicy{MaxAttempts: 3, RetryOn: []RetryClass{RetryServerError}}
+	serverErr := errors.New("InternalError")
+
+	c.Assert(policy.ShouldRetry(1, 500, serverErr), Equals, true)
+	c.Assert(policy.ShouldRetry(2, 500, serverErr), Equals, true)
+	c.Assert(policy.ShouldRetry(3, 500, serverErr), Equals, false)
+	c.Assert(policy.ShouldRetry(1, 429, errors.New("TooManyRequests")), Equals, false)
+}
+
+func (s *RetrySuite) TestBackoff(c *C) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt := 1; attempt <= 10; attempt++ {
+		for i := 0; i < 100; i++ {
+			delay := policy.Backoff(attempt)
+			c.Assert(delay >= 0, Equals, true)
+			c.Assert(delay <= 5*time.Second, Equals, true)
+			if attempt == 1 {
+				c.Assert(delay <= time.Second, Equals, true)
+			}
+		}
+	}
+}
+
+func (s *RetrySuite) TestBackoffUncapped(c *C) {
+	// with no MaxDelay, the delay stops doubling rather than overflowing
+	policy := RetryPolicy{MaxAttempts: 1000, BaseDelay: time.Second}
+	for _, attempt := range []int{30, 64, 100, 1000} {
+		for i := 0; i < 100; i++ {
+			c.Assert(policy.Backoff(attempt) >= 0, Equals, true)
+		}
+	}
+	policy = RetryPolicy{MaxAttempts: 2, BaseDelay: math.MaxInt64, MaxDelay: math.MaxInt64}
+	c.Assert(policy.Backoff(2) >= 0, Equals, true)
+}
+
+func (s *RetrySuite) TestParseRetryClass(c *C) {
+	for _, class := range AllRetryClasses {
+		parsed, err := ParseRetryClass(string(class))
+		c.Assert(err, IsNil)
+		c.Assert(parsed, Equals, class)
+	}
+	_, err := ParseRetryClass("4xx")
+	c.Assert(err, NotNil)
+}
+
+func (s *RetrySuite) TestRetryPolicyFrom(c *C) {
+	ctx := context.Background()
+	c.Assert(RetryPolicyFrom(ctx).MaxAttempts, Equals, DefaultMaxAttempts)
+
+	policy := RetryPolicy{MaxAttempts: 7}
+	c.Assert(RetryPolicyFrom(WithRetryPolicy(ctx, policy)).MaxAttempts, Equals, 7)
+}
@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// ------------------------------------------------------------
+// AuditSummary type
+
+// The AuditSummary struct records the result of an Audit run
+type AuditSummary struct {
+	// Due is the number of objects due for a check
+	Due     int `json:"due"`
+	Checked int `json:"checked"`
+	OK      int `json:"ok"`
+	Changed int `json:"changed"`
+	Missing int `json:"missing"`
+	Errors  int `json:"errors"`
+	// Deferred is the number of due objects not checked because the byte or
+	// time budget was exhausted
+	Deferred int           `json:"deferred"`
+	Bytes    int64         `json:"bytes"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// Failed returns the number of checks that did not succeed
+func (s *AuditSummary) Failed() int {
+	return s.Changed + s.Missing + s.Errors
+}
+
+// ------------------------------------------------------------
+// Audit type
+
+// The Audit struct represents one run of a scheduled fixity audit: it checks
+// the objects in an AuditDB that are due for a check, highest priority and
+// least recently checked first, within a byte and time budget, recording the
+// results in the database.
+type Audit struct {
+	DB *AuditDB
+	// Resolve returns the Object for an AuditObject
+	Resolve func(obj *AuditObject) (Object, error)
+	// MinAge is the minimum time between checks of an object; objects checked
+	// more recently are not due
+	MinAge time.Duration
+	// MaxBytes, if > 0, is the maximum number of bytes to read. An object
+	// that would exceed the budget is deferred, unless it is the first
+	// object checked.
+	MaxBytes int64
+	// MaxTime, if > 0, is the time after which no further checks are started
+	MaxTime time.Duration
+	// Report, if set, is called with each check as it is recorded
+	Report func(obj *AuditObject, check AuditCheck)
+}
+
+// Due returns the objects due for a check as of the specified time, in the
+// order in which they should be checked
+func (a *Audit) Due(now time.Time) ([]*AuditObject, error) {
+	objs, err := a.DB.Objects()
+	if err != nil {
+		return nil, err
+	}
+	var due []*AuditObject
+	for _, obj := range objs {
+		if !obj.Checked() || now.Sub(obj.LastChecked) >= a.MinAge {
+			due = append(due, obj)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		if due[i].Priority != due[j].Priority {
+			return due[i].Priority > due[j].Priority
+		}
+		return due[i].LastChecked.Before(due[j].LastChecked)
+	})
+	return due, nil
+}
+
+// Run checks the objects due for a check, returning a summary. Failed checks
+// are recorded and counted in the summary, but do not cause Run to return an
+// error; an error is returned only if the database cannot be read or
+// updated, or if the context is cancelled.
+func (a *Audit) Run(ctx context.Context) (*AuditSummary, error) {
+	start := time.Now()
+	due, err := a.Due(start)
+	if err != nil {
+		return nil, err
+	}
+	summary := &AuditSummary{Due: len(due)}
+	defer func() {
+		summary.Elapsed = time.Since(start)
+	}()
+	for i, obj := range due {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		if a.MaxTime > 0 && time.Since(start) >= a.MaxTime {
+			summary.Deferred += len(due) - i
+			break
+		}
+		if a.MaxBytes > 0 && summary.Checked > 0 && summary.Bytes+obj.Size > a.MaxBytes {
+			summary.Deferred++
+			continue
+		}
+		check := a.check(ctx, obj)
+		if ctx.Err() != nil {
+			// interrupted; don't record a spurious failure
+			return summary, ctx.Err()
+		}
+		if err := a.DB.Record(check); err != nil {
+			return summary, err
+		}
+		summary.Checked++
+		if check.Size > 0 {
+			summary.Bytes += check.Size
+		}
+		switch check.Status {
+		case AuditOK:
+			summary.OK++
+		case AuditChanged:
+			summary.Changed++
+		case AuditMissing:
+			summary.Missing++
+		default:
+			summary.Errors++
+		}
+		if a.Report != nil {
+			a.Report(obj, check)
+		}
+	}
+	return summary, nil
+}
+
+// check checks a single object
+func (a *Audit) check(ctx context.Context, obj *AuditObject) AuditCheck {
+	start := time.Now()
+	check := AuditCheck{URL: obj.URL, Time: start, Size: -1}
+	fail := func(err error) AuditCheck {
+		check.Elapsed = time.Since(start)
+		check.Status = AuditError
+		if IsNotFound(err) {
+			check.Status = AuditMissing
+		}
+		check.Error = logging.FormatError(err)
+		return check
+	}
+
+	expected, err := hex.DecodeString(obj.Expected)
+	if err != nil {
+		return fail(fmt.Errorf("invalid expected digest %#v: %v", obj.Expected, err))
+	}
+	o, err := a.Resolve(obj)
+	if err != nil {
+		return fail(err)
+	}
+	if check.Size, err = o.ContentLength(ctx); err != nil {
+		check.Size = -1
+		return fail(err)
+	}
+	digest, err := CalcDigest(ctx, o, DefaultRangeSize, obj.Algorithm)
+	if err != nil {
+		return fail(err)
+	}
+	check.Elapsed = time.Since(start)
+	check.Digest = hex.EncodeToString(digest)
+	check.Status = AuditOK
+	if len(expected) > 0 && check.Digest != hex.EncodeToString(expected) {
+		check.Status = AuditChanged
+		check.Error = fmt.Sprintf("expected %v digest %v, got %v", obj.Algorithm, obj.Expected, check.Digest)
+	}
+	return check
+}
@@ -0,0 +1,331 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Audit check statuses
+const (
+	// AuditOK indicates that the object's digest matched the expected digest
+	// (or, on the first check of an object with no expected digest, that the
+	// digest was recorded)
+	AuditOK = "ok"
+	// AuditChanged indicates that the object's digest did not match the
+	// expected digest
+	AuditChanged = "changed"
+	// AuditMissing indicates that the object no longer exists
+	AuditMissing = "missing"
+	// AuditError indicates that the object could not be checked
+	AuditError = "error"
+)
+
+var (
+	auditObjectsBucket = []byte("objects")
+	auditHistoryBucket = []byte("history")
+)
+
+// ------------------------------------------------------------
+// AuditObject type
+
+// The AuditObject struct describes an object known to an AuditDB, with its
+// expected digest and the result of its most recent check
+type AuditObject struct {
+	URL string `json:"url"`
+	// Profile, Endpoint, and Region, if set, override the defaults when
+	// resolving the URL
+	Profile  string `json:"profile,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	// Algorithm is the digest algorithm (md5 or sha256)
+	Algorithm string `json:"algorithm"`
+	// Expected is the expected digest, in hex; if empty, the digest
+	// calculated by the first successful check is recorded
+	Expected string `json:"expected,omitempty"`
+	// Size is the object size, as of when it was added or last checked, or
+	// -1 if unknown
+	Size int64 `json:"size"`
+	// Priority orders objects due for a check; higher priorities are checked
+	// first
+	Priority    int       `json:"priority,omitempty"`
+	Added       time.Time `json:"added"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	LastStatus  string    `json:"last_status,omitempty"`
+}
+
+// Checked returns true if the object has been checked at least once
+func (o *AuditObject) Checked() bool {
+	return !o.LastChecked.IsZero()
+}
+
+// location describes the profile, endpoint, and region used to resolve the
+// object's URL
+func (o *AuditObject) location() string {
+	return fmt.Sprintf("profile %#v, endpoint %#v, region %#v", o.Profile, o.Endpoint, o.Region)
+}
+
+// sameLocation returns true if the objects' URLs are resolved with the same
+// profile, endpoint, and region
+func sameLocation(o1, o2 *AuditObject) bool {
+	return o1.Profile == o2.Profile && o1.Endpoint == o2.Endpoint && o1.Region == o2.Region
+}
+
+// ------------------------------------------------------------
+// AuditCheck type
+
+// The AuditCheck struct records one check of an object in an AuditDB
+type AuditCheck struct {
+	URL    string    `json:"url"`
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"`
+	// Digest is the calculated digest, in hex, if the object could be read
+	Digest  string        `json:"digest,omitempty"`
+	Size    int64         `json:"size"`
+	Elapsed time.Duration `json:"elapsed"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ------------------------------------------------------------
+// AuditDB type
+
+// The AuditDB struct is a persistent record of the objects to be audited,
+// their expected digests, and the history of their checks, stored in a local
+// bbolt database file.
+type AuditDB struct {
+	Path string
+	db   *bolt.DB
+}
+
+// OpenAuditDB opens the audit database at the specified path, creating it
+// (and its parent directory) if it does not exist
+func OpenAuditDB(path string) (*AuditDB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit database %v: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{auditObjectsBucket, auditHistoryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &AuditDB{Path: path, db: db}, nil
+}
+
+// Close closes the database
+func (a *AuditDB) Close() error {
+	return a.db.Close()
+}
+
+// Add adds the specified objects to the database, returning the number of
+// objects not previously present. Objects already present keep their check
+// history, but have their settings replaced, except that an empty expected
+// digest does not replace a recorded one. Since objects are identified by
+// URL alone, an object already present with a different profile, endpoint,
+// or region (e.g. the same URL on another endpoint) is an error, rather than
+// mixing the two objects' histories.
+func (a *AuditDB) Add(objs ...AuditObject) (added int, err error) {
+	now := time.Now()
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditObjectsBucket)
+		for _, obj := range objs {
+			if obj.URL == "" {
+				return fmt.Errorf("audit object has no URL")
+			}
+			if obj.Algorithm == "" {
+				obj.Algorithm = "sha256"
+			}
+			existing, err := getAuditObject(b, obj.URL)
+			if err != nil {
+				return err
+			}
+			if existing == nil {
+				added++
+				if obj.Added.IsZero() {
+					obj.Added = now
+				}
+			} else {
+				if !sameLocation(existing, &obj) {
+					return fmt.Errorf(
+						"%v is already audited with %v; remove it first to audit it with %v",
+						obj.URL, existing.location(), obj.location(),
+					)
+				}
+				obj.Added = existing.Added
+				obj.LastChecked = existing.LastChecked
+				obj.LastStatus = existing.LastStatus
+				if obj.Expected == "" && obj.Algorithm == existing.Algorithm {
+					obj.Expected = existing.Expected
+				}
+				if obj.Size < 0 {
+					obj.Size = existing.Size
+				}
+			}
+			if err := putAuditObject(b, &obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return added, err
+}
+
+// Remove removes the object with the specified URL, and its check history,
+// from the database, returning false if it was not present
+func (a *AuditDB) Remove(url string) (removed bool, err error) {
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditObjectsBucket)
+		if b.Get([]byte(url)) == nil {
+			return nil
+		}
+		removed = true
+		if err := b.Delete([]byte(url)); err != nil {
+			return err
+		}
+		c := tx.Bucket(auditHistoryBucket).Cursor()
+		prefix := historyPrefix(url)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// Object returns the object with the specified URL, or nil if it is not
+// present
+func (a *AuditDB) Object(url string) (obj *AuditObject, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		obj, err = getAuditObject(tx.Bucket(auditObjectsBucket), url)
+		return err
+	})
+	return obj, err
+}
+
+// Objects returns all objects in the database, sorted by URL
+func (a *AuditDB) Objects() ([]*AuditObject, error) {
+	var objs []*AuditObject
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditObjectsBucket).ForEach(func(k, v []byte) error {
+			var obj AuditObject
+			if err := json.Unmarshal(v, &obj); err != nil {
+				return fmt.Errorf("invalid audit object %#v: %v", string(k), err)
+			}
+			objs = append(objs, &obj)
+			return nil
+		})
+	})
+	return objs, err
+}
+
+// Record records the specified check in the object's history, and updates
+// the object's last check time and status. If the object has no expected
+// digest and the check succeeded, the calculated digest becomes the
+// expected digest.
+func (a *AuditDB) Record(check AuditCheck) error {
+	return a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditObjectsBucket)
+		obj, err := getAuditObject(b, check.URL)
+		if err != nil {
+			return err
+		}
+		if obj == nil {
+			return fmt.Errorf("no such audit object: %v", check.URL)
+		}
+		obj.LastChecked = check.Time
+		obj.LastStatus = check.Status
+		if check.Status == AuditOK {
+			obj.Size = check.Size
+			if obj.Expected == "" {
+				obj.Expected = check.Digest
+			}
+		}
+		if err := putAuditObject(b, obj); err != nil {
+			return err
+		}
+		data, err := json.Marshal(check)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(auditHistoryBucket).Put(historyKey(check.URL, check.Time), data)
+	})
+}
+
+// History returns the recorded checks of the object with the specified URL,
+// or of all objects if the URL is empty, in order of time
+func (a *AuditDB) History(url string) ([]AuditCheck, error) {
+	var checks []AuditCheck
+	err := a.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(auditHistoryBucket).Cursor()
+		prefix := []byte{}
+		if url != "" {
+			prefix = historyPrefix(url)
+		}
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var check AuditCheck
+			if err := json.Unmarshal(v, &check); err != nil {
+				return fmt.Errorf("invalid audit history entry: %v", err)
+			}
+			checks = append(checks, check)
+		}
+		return nil
+	})
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].Time.Before(checks[j].Time) })
+	return checks, err
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+func getAuditObject(b *bolt.Bucket, url string) (*AuditObject, error) {
+	data := b.Get([]byte(url))
+	if data == nil {
+		return nil, nil
+	}
+	var obj AuditObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("invalid audit object %#v: %v", url, err)
+	}
+	return &obj, nil
+}
+
+func putAuditObject(b *bolt.Bucket, obj *AuditObject) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(obj.URL), data)
+}
+
+// historyPrefix returns the prefix of the history keys for the specified URL;
+// the NUL separator keeps one URL's history from matching another URL that
+// it is a prefix of
+func historyPrefix(url string) []byte {
+	return append([]byte(url), 0)
+}
+
+// historyKey returns the history key for a check, ordered by time within
+// each URL
+func historyKey(url string, t time.Time) []byte {
+	key := historyPrefix(url)
+	return binary.BigEndian.AppendUint64(key, uint64(t.UnixNano()))
+}
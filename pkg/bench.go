@@ -0,0 +1,399 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// Benchmark operations
+const (
+	BenchPut    = "put"
+	BenchGet    = "get"
+	BenchRange  = "range"
+	BenchHead   = "head"
+	BenchDelete = "delete"
+)
+
+// BenchOps lists the supported benchmark operations, in report order
+var BenchOps = []string{BenchPut, BenchGet, BenchRange, BenchHead, BenchDelete}
+
+// DefaultBenchMix is the default mix of operations, as relative weights
+var DefaultBenchMix = map[string]int{BenchPut: 20, BenchGet: 30, BenchRange: 20, BenchHead: 20, BenchDelete: 10}
+
+const (
+	// DefaultBenchRangeSize is the default size of ranged GETs
+	DefaultBenchRangeSize = 64 * 1024
+	// DefaultBenchSeedCount is the default number of objects of each size
+	// created before the benchmark starts, for GET, HEAD, and DELETE to act on
+	DefaultBenchSeedCount = 8
+)
+
+// ------------------------------------------------------------
+// Bench type
+
+// The Bench struct represents a benchmark running a weighted mix of
+// operations against a target, at the specified object sizes and
+// concurrency, for the specified duration. All objects are created under the
+// specified prefix and deleted when the benchmark ends.
+type Bench struct {
+	Target Target
+	Prefix string
+	// Mix maps operations (see BenchOps) to relative weights
+	Mix map[string]int
+	// Sizes lists the object sizes to benchmark; each operation uses a size
+	// chosen at random
+	Sizes []int64
+	// RangeSize is the size of ranged GETs (or the object size, if smaller)
+	RangeSize int64
+	// SeedCount is the number of objects of each size created before the
+	// benchmark starts
+	SeedCount   int
+	Concurrency int
+	Duration    time.Duration
+	// RandomSeed seeds the choice of operations, sizes, keys, and ranges
+	RandomSeed int64
+}
+
+// The BenchResult struct summarizes the benchmark results for one operation
+// at one object size
+type BenchResult struct {
+	Operation string `json:"operation"`
+	Size      int64  `json:"size"`
+	LatencySummary
+}
+
+// The BenchReport struct records the results of a benchmark
+type BenchReport struct {
+	Target         string        `json:"target"`
+	Concurrency    int           `json:"concurrency"`
+	ElapsedSeconds float64       `json:"elapsed_seconds"`
+	Results        []BenchResult `json:"results"`
+}
+
+// Run runs the benchmark and returns a report. Operations that fail are
+// counted as errors, but do not stop the benchmark.
+func (b *Bench) Run(ctx context.Context) (*BenchReport, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	logger := logging.DefaultLogger()
+	r := newBenchRun(b)
+	defer r.cleanup(context.WithoutCancel(ctx))
+
+	if b.needsSeeds() {
+		logger.Detailf("Creating %d seed objects of each size under %v\n", b.SeedCount, b.Target.Object(b.Prefix))
+		if err := r.seed(ctx); err != nil {
+			return nil, fmt.Errorf("error creating seed objects: %v", err)
+		}
+	}
+
+	logger.Detailf("Running benchmark for %v with %d workers\n", b.Duration, b.Concurrency)
+	runCtx, cancel := context.WithTimeout(ctx, b.Duration)
+	defer cancel()
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < b.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			r.work(ctx, runCtx, worker)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	report := &BenchReport{
+		Target:         b.Target.Object(b.Prefix).Pretty(),
+		Concurrency:    b.Concurrency,
+		ElapsedSeconds: elapsed.Seconds(),
+	}
+	for _, op := range BenchOps {
+		for i, size := range b.Sizes {
+			summary := r.latencies[op][i].Summary(elapsed)
+			if summary.Count == 0 && summary.Errors == 0 {
+				continue
+			}
+			report.Results = append(report.Results, BenchResult{Operation: op, Size: size, LatencySummary: summary})
+		}
+	}
+	return report, ctx.Err()
+}
+
+func (b *Bench) validate() error {
+	total := 0
+	for op, weight := range b.Mix {
+		if !isBenchOp(op) {
+			return fmt.Errorf("unsupported benchmark operation: %#v (expected one of %v)", op, BenchOps)
+		}
+		if weight < 0 {
+			return fmt.Errorf("invalid weight for %v: %d", op, weight)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("no operations to benchmark")
+	}
+	if len(b.Sizes) == 0 {
+		return fmt.Errorf("no object sizes to benchmark")
+	}
+	for _, size := range b.Sizes {
+		if size <= 0 {
+			return fmt.Errorf("invalid object size: %d", size)
+		}
+	}
+	if b.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency: %d", b.Concurrency)
+	}
+	if b.Duration <= 0 {
+		return fmt.Errorf("invalid duration: %v", b.Duration)
+	}
+	return nil
+}
+
+func (b *Bench) needsSeeds() bool {
+	for op, weight := range b.Mix {
+		if op != BenchPut && weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isBenchOp(op string) bool {
+	for _, o := range BenchOps {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------------------------------------
+// benchRun type
+
+// benchRun holds the state of a running benchmark
+type benchRun struct {
+	*Bench
+	body      []byte
+	ops       []string // one entry per unit of weight
+	nextKey   int64
+	mux       sync.Mutex
+	pools     [][]string // existing keys, by size index
+	orphans   []string   // keys of failed PUTs and DELETEs, for cleanup
+	inUse     map[string]int
+	latencies map[string][]*Latencies
+}
+
+func newBenchRun(b *Bench) *benchRun {
+	var maxSize int64
+	for _, size := range b.Sizes {
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+	body := make([]byte, maxSize)
+	rand.New(rand.NewSource(b.RandomSeed)).Read(body)
+
+	var ops []string
+	for _, op := range BenchOps {
+		for i := 0; i < b.Mix[op]; i++ {
+			ops = append(ops, op)
+		}
+	}
+	latencies := map[string][]*Latencies{}
+	for _, op := range BenchOps {
+		for range b.Sizes {
+			latencies[op] = append(latencies[op], &Latencies{})
+		}
+	}
+	return &benchRun{
+		Bench:     b,
+		body:      body,
+		ops:       ops,
+		pools:     make([][]string, len(b.Sizes)),
+		inUse:     map[string]int{},
+		latencies: latencies,
+	}
+}
+
+func (r *benchRun) seed(ctx context.Context) error {
+	for i := range r.Sizes {
+		for n := 0; n < r.SeedCount; n++ {
+			if _, err := r.put(ctx, i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// work performs randomly chosen operations until the run context is done.
+// The operations themselves use the parent context, so that operations in
+// progress when the duration expires are allowed to complete.
+func (r *benchRun) work(ctx, runCtx context.Context, worker int) {
+	random := rand.New(rand.NewSource(r.RandomSeed + int64(worker) + 1))
+	bufferSize := r.RangeSize
+	if bufferSize < DefaultRangeSize {
+		bufferSize = DefaultRangeSize
+	}
+	if bufferSize > int64(len(r.body)) {
+		bufferSize = int64(len(r.body))
+	}
+	buffer := make([]byte, bufferSize)
+
+	for runCtx.Err() == nil {
+		op := r.ops[random.Intn(len(r.ops))]
+		sizeIndex := random.Intn(len(r.Sizes))
+		start := time.Now()
+		op, n, err := r.perform(ctx, op, sizeIndex, random, buffer)
+		r.latencies[op][sizeIndex].Record(time.Since(start), n, err)
+		if err != nil {
+			logging.DefaultLogger().Detailf("%v failed: %v\n", op, logging.FormatError(err))
+		}
+	}
+}
+
+// perform performs the specified operation, returning the operation actually
+// performed (a PUT, if there are no objects of the chosen size to act on) and
+// the number of bytes transferred
+func (r *benchRun) perform(ctx context.Context, op string, sizeIndex int, random *rand.Rand, buffer []byte) (string, int64, error) {
+	size := r.Sizes[sizeIndex]
+	if op == BenchPut {
+		n, err := r.put(ctx, sizeIndex)
+		return op, n, err
+	}
+	key, ok := r.choose(sizeIndex, random, op == BenchDelete)
+	if !ok {
+		n, err := r.put(ctx, sizeIndex)
+		return BenchPut, n, err
+	}
+	defer r.release(key)
+	obj := r.Target.Object(key)
+	switch op {
+	case BenchGet:
+		for pos := int64(0); pos < size; {
+			start, end, n := NextRange(pos, int64(len(buffer)), size)
+			if _, err := getRange(ctx, obj, start, end, buffer[:n]); err != nil {
+				return op, 0, err
+			}
+			pos += int64(n)
+		}
+		return op, size, nil
+	case BenchRange:
+		length := r.RangeSize
+		if length > size {
+			length = size
+		}
+		start := random.Int63n(size - length + 1)
+		_, err := getRange(ctx, obj, start, start+length-1, buffer[:length])
+		return op, length, err
+	case BenchHead:
+		_, err := obj.ContentLength(ctx)
+		return op, 0, err
+	default: // BenchDelete
+		err := obj.Delete(ctx)
+		if err != nil {
+			r.mux.Lock()
+			r.orphans = append(r.orphans, key)
+			r.mux.Unlock()
+		}
+		return op, 0, err
+	}
+}
+
+// getRange downloads the specified range with a single request, if the
+// object supports it, so that latencies don't include any other requests
+// made by DownloadRange (see RangeGetter)
+func getRange(ctx context.Context, obj Object, startInclusive, endInclusive int64, buffer []byte) (int64, error) {
+	if getter, ok := obj.(RangeGetter); ok {
+		return getter.GetRange(ctx, startInclusive, endInclusive, buffer)
+	}
+	return obj.DownloadRange(ctx, startInclusive, endInclusive, buffer)
+}
+
+func (r *benchRun) put(ctx context.Context, sizeIndex int) (int64, error) {
+	size := r.Sizes[sizeIndex]
+	key := fmt.Sprintf("%vobject-%d.bin", r.Prefix, atomic.AddInt64(&r.nextKey, 1))
+	err := r.Target.Object(key).Create(ctx, bytes.NewReader(r.body[:size]), size)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if err != nil {
+		r.orphans = append(r.orphans, key)
+		return 0, err
+	}
+	r.pools[sizeIndex] = append(r.pools[sizeIndex], key)
+	return size, nil
+}
+
+// choose chooses an existing key of the specified size at random, marking it
+// as in use until released. If take is true (for DELETE), the key is removed
+// from the pool, and only keys not in use by other operations are chosen.
+func (r *benchRun) choose(sizeIndex int, random *rand.Rand, take bool) (string, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	pool := r.pools[sizeIndex]
+	if len(pool) == 0 || (take && len(pool) <= 1) {
+		return "", false
+	}
+	offset := random.Intn(len(pool))
+	for j := range pool {
+		i := (offset + j) % len(pool)
+		key := pool[i]
+		if take && r.inUse[key] > 0 {
+			continue
+		}
+		if take {
+			pool[i] = pool[len(pool)-1]
+			r.pools[sizeIndex] = pool[:len(pool)-1]
+		}
+		r.inUse[key]++
+		return key, true
+	}
+	return "", false
+}
+
+// release marks the specified key as no longer in use
+func (r *benchRun) release(key string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.inUse[key]--; r.inUse[key] <= 0 {
+		delete(r.inUse, key)
+	}
+}
+
+// cleanup deletes all objects remaining in the pools, and any objects that
+// failed PUTs or DELETEs may have left behind
+func (r *benchRun) cleanup(ctx context.Context) {
+	keys := append([]string(nil), r.orphans...)
+	for _, pool := range r.pools {
+		keys = append(keys, pool...)
+	}
+	sort.Strings(keys)
+	logging.DefaultLogger().Detailf("Deleting %d benchmark objects\n", len(keys))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, r.Concurrency)
+	for _, key := range keys {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := r.Target.Object(key).Delete(ctx); err != nil {
+				logging.DefaultLogger().Infof("Error deleting %v: %v\n", key, logging.FormatError(err))
+			}
+		}(key)
+	}
+	wg.Wait()
+}
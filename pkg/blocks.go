@@ -0,0 +1,295 @@
+package pkg
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+const (
+	// DefaultBlockSize is the default block size for block-hash manifests
+	DefaultBlockSize = 1024 * 1024
+	// DefaultSpotCheckBlocks is the default number of blocks to check in a
+	// spot check
+	DefaultSpotCheckBlocks = 8
+)
+
+// ------------------------------------------------------------
+// BlockHasher type
+
+// The BlockHasher struct is an io.Writer that calculates a separate digest
+// for each fixed-size block of the bytes written to it, e.g. from Download.
+type BlockHasher struct {
+	BlockSize int64
+
+	algorithm string
+	current   hash.Hash
+	written   int64
+	sums      [][]byte
+}
+
+// NewBlockHasher creates a new BlockHasher with the specified algorithm (md5
+// or sha256) and block size
+func NewBlockHasher(algorithm string, blockSize int64) (*BlockHasher, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size: %d", blockSize)
+	}
+	if _, err := NewHash(algorithm); err != nil {
+		return nil, err
+	}
+	return &BlockHasher{BlockSize: blockSize, algorithm: algorithm}, nil
+}
+
+// Write adds the specified bytes to the current block's digest, starting a
+// new block whenever the current one is full
+func (h *BlockHasher) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if h.current == nil {
+			h.current, _ = NewHash(h.algorithm)
+		}
+		remaining := h.BlockSize - h.written%h.BlockSize
+		chunk := p
+		if int64(len(chunk)) > remaining {
+			chunk = p[:remaining]
+		}
+		_, _ = h.current.Write(chunk)
+		h.written += int64(len(chunk))
+		n += len(chunk)
+		p = p[len(chunk):]
+		if h.written%h.BlockSize == 0 {
+			h.sums = append(h.sums, h.current.Sum(nil))
+			h.current = nil
+		}
+	}
+	return n, nil
+}
+
+// Sums returns the digests of the blocks written so far, including the final
+// partial block (if any)
+func (h *BlockHasher) Sums() [][]byte {
+	if h.current == nil {
+		return h.sums
+	}
+	return append(h.sums[:len(h.sums):len(h.sums)], h.current.Sum(nil))
+}
+
+// ------------------------------------------------------------
+// BlockManifest type
+
+// The BlockManifest struct records the digests of each fixed-size block of an
+// object, along with the digest of the whole object, so that ranges of the
+// object can later be verified without downloading all of it (see
+// SpotCheck).
+type BlockManifest struct {
+	Object    string    `json:"object"`
+	Size      int64     `json:"size"`
+	Algorithm string    `json:"algorithm"`
+	BlockSize int64     `json:"block_size"`
+	Digest    string    `json:"digest"`
+	Created   time.Time `json:"created"`
+	// Root is the root of the hash tree over the blocks (see MerkleTree), in
+	// hex
+	Root string `json:"root,omitempty"`
+	// Blocks holds the digest of each block, in hex
+	Blocks []string `json:"blocks"`
+}
+
+// NewBlockManifest downloads the object, calculating the digest of each block
+// of the specified size, and of the whole object
+func NewBlockManifest(ctx context.Context, obj Object, blockSize int64, algorithm string) (*BlockManifest, error) {
+	blocks, err := NewBlockHasher(algorithm, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	whole, _ := NewHash(algorithm)
+	size, err := Download(ctx, obj, DefaultRangeSize, io.MultiWriter(blocks, whole))
+	if err != nil {
+		return nil, err
+	}
+	m := &BlockManifest{
+		Object:    obj.Pretty(),
+		Size:      size,
+		Algorithm: algorithm,
+		BlockSize: blockSize,
+		Digest:    hex.EncodeToString(whole.Sum(nil)),
+		Created:   time.Now().UTC(),
+		Blocks:    []string{},
+	}
+	sums := blocks.Sums()
+	for _, sum := range sums {
+		m.Blocks = append(m.Blocks, hex.EncodeToString(sum))
+	}
+	tree, err := MerkleTree(algorithm, sums)
+	if err != nil {
+		return nil, err
+	}
+	m.Root = hex.EncodeToString(tree[len(tree)-1][0])
+	return m, nil
+}
+
+// ReadBlockManifest reads a block manifest from the specified JSON file
+func ReadBlockManifest(path string) (*BlockManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBlockManifest(data, path)
+}
+
+// ParseBlockManifest parses a JSON block manifest, read from the specified
+// source (used in error messages)
+func ParseBlockManifest(data []byte, source string) (*BlockManifest, error) {
+	var m BlockManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid block manifest %v: %v", source, err)
+	}
+	if m.BlockSize <= 0 {
+		return nil, fmt.Errorf("invalid block manifest %v: invalid block size %d", source, m.BlockSize)
+	}
+	if expected := m.BlockCount(); len(m.Blocks) != expected {
+		return nil, fmt.Errorf("invalid block manifest %v: expected %d blocks for %d bytes, got %d", source, expected, m.Size, len(m.Blocks))
+	}
+	if m.Root != "" {
+		tree, err := m.Tree()
+		if err != nil {
+			return nil, fmt.Errorf("invalid block manifest %v: %v", source, err)
+		}
+		if root := hex.EncodeToString(tree[len(tree)-1][0]); root != m.Root {
+			return nil, fmt.Errorf("invalid block manifest %v: block digests do not match root %v", source, m.Root)
+		}
+	}
+	return &m, nil
+}
+
+// JSON returns the manifest as indented JSON
+func (m *BlockManifest) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Write writes the manifest, as JSON, to the specified file, or to standard
+// output if the path is empty or "-"
+func (m *BlockManifest) Write(path string) error {
+	data, err := m.JSON()
+	if err != nil {
+		return err
+	}
+	if path == "" || path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// BlockCount returns the number of blocks in an object of the manifest's size
+func (m *BlockManifest) BlockCount() int {
+	return int((m.Size + m.BlockSize - 1) / m.BlockSize)
+}
+
+// BlockRange returns the byte range (with the end inclusive) of the
+// specified block
+func (m *BlockManifest) BlockRange(block int) (startInclusive, endInclusive int64) {
+	startInclusive = int64(block) * m.BlockSize
+	endInclusive = startInclusive + m.BlockSize - 1
+	if endInclusive >= m.Size {
+		endInclusive = m.Size - 1
+	}
+	return startInclusive, endInclusive
+}
+
+// ------------------------------------------------------------
+// SpotCheck type
+
+// The SpotCheckResult struct records the check of one block in a SpotCheck
+type SpotCheckResult struct {
+	Block    int    `json:"block"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// OK returns true if the block's digest matched the expected digest
+func (r SpotCheckResult) OK() bool {
+	return r.Error == "" && r.Actual == r.Expected
+}
+
+// The SpotCheck struct represents a partial fixity check of an object: the
+// digests of randomly chosen blocks are compared with those recorded in a
+// block manifest, so that damage to (a sample of) the object can be detected
+// without downloading all of it.
+type SpotCheck struct {
+	Object   Object
+	Manifest *BlockManifest
+	// Blocks is the number of blocks to check
+	Blocks int
+	// Seed is the random seed used to choose the blocks
+	Seed int64
+}
+
+// Run checks the object's size and the chosen blocks, returning the result
+// for each block, and an error if the size does not match or any block
+// could not be verified.
+func (s *SpotCheck) Run(ctx context.Context) ([]SpotCheckResult, error) {
+	size, err := s.Object.ContentLength(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if size != s.Manifest.Size {
+		return nil, fmt.Errorf("size mismatch: expected %d bytes, got %d", s.Manifest.Size, size)
+	}
+
+	logger := logging.DefaultLogger()
+	var results []SpotCheckResult
+	failed := 0
+	for _, block := range s.chooseBlocks() {
+		start, end := s.Manifest.BlockRange(block)
+		result := SpotCheckResult{Block: block, Start: start, End: end, Expected: s.Manifest.Blocks[block]}
+		digest, err := CalcRangeDigest(ctx, s.Object, start, end, DefaultRangeSize, s.Manifest.Algorithm)
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			result.Error = logging.FormatError(err)
+		} else {
+			result.Actual = hex.EncodeToString(digest)
+		}
+		if !result.OK() {
+			failed++
+		}
+		logger.Detailf("block %d (bytes %d-%d): ok: %v\n", block, start, end, result.OK())
+		results = append(results, result)
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d blocks do not match block manifest", failed, len(results))
+	}
+	return results, nil
+}
+
+// chooseBlocks returns the indices of the blocks to check, in order
+func (s *SpotCheck) chooseBlocks() []int {
+	count := s.Manifest.BlockCount()
+	blocks := rand.New(rand.NewSource(s.Seed)).Perm(count)
+	if s.Blocks < count {
+		blocks = blocks[:s.Blocks]
+	}
+	sort.Ints(blocks)
+	return blocks
+}
@@ -2,23 +2,44 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 
 	. "github.com/dmolesUC3/cos/internal/objects"
 	. "github.com/dmolesUC3/cos/internal/streaming"
 )
 
+// The ByteRange struct represents a range of bytes in an object
+type ByteRange struct {
+	Start int64
+	// End is the end of the range (inclusive), or -1 for the end of the object
+	End int64
+}
+
+func (r ByteRange) String() string {
+	if r.End < 0 {
+		return fmt.Sprintf("%d-", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
 // The Check struct represents a fixity check operation
 type Check struct {
 	Object    Object
 	Expected  []byte
 	Algorithm string
+	// Range, if not nil, restricts the check to the specified range of bytes
+	Range *ByteRange
 }
 
 // VerifyDigest gets the digest, returning an error if the object cannot be retrieved or,
 // when an expected digest is provided, if the calculated digest does not match.
-func (c Check) VerifyDigest() ([]byte, error) {
-	actualDigest, err := CalcDigest(c.Object, DefaultRangeSize, c.Algorithm)
+func (c Check) VerifyDigest(ctx context.Context) ([]byte, error) {
+	start, end := int64(0), int64(-1)
+	if c.Range != nil {
+		start, end = c.Range.Start, c.Range.End
+	}
+	actualDigest, err := CalcRangeDigest(ctx, c.Object, start, end, DefaultRangeSize, c.Algorithm)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,239 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// DefaultCopyConcurrency is the default number of objects copied at once in
+// a bulk copy
+const DefaultCopyConcurrency = 4
+
+// ------------------------------------------------------------
+// Copy type
+
+// The Copy struct represents a copy of an object from one target to another
+// (possibly on a different endpoint), streamed without staging to local disk
+type Copy struct {
+	Source      Object
+	Destination Object
+	// Verify is the verification mode (see VerifyModes). Note that VerifyETag
+	// relies on the destination target having been created with ETag
+	// verification enabled.
+	Verify string
+}
+
+// CopyAndVerify streams the source object into the destination object,
+// computing the SHA-256 and MD5 digests of the source along the way, verifies
+// the copy, and returns a receipt.
+func (c *Copy) CopyAndVerify(ctx context.Context) (*Receipt, error) {
+	if err := ValidVerifyMode(c.Verify); err != nil {
+		return nil, err
+	}
+	src, dst := c.Source, c.Destination
+	logger := logging.DefaultLogger()
+	started := time.Now()
+
+	contentLength, err := src.ContentLength(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sha256Digest := sha256.New()
+	md5Digest := md5.New()
+
+	// download in the background, piping the bytes into the upload
+	pr, pw := io.Pipe()
+	downloaded := make(chan error, 1)
+	go func() {
+		_, err := Download(ctx, src, DefaultRangeSize, io.MultiWriter(pw, sha256Digest, md5Digest))
+		_ = pw.CloseWithError(err)
+		downloaded <- err
+	}()
+
+	logger.Detailf("Copying %v (%v) to %v\n", src, logging.FormatBytes(contentLength), dst)
+	err = dst.Create(ctx, pr, contentLength)
+	// unblock the download, if the upload failed before reading all of it
+	uploadEnded := fmt.Errorf("upload to %v ended", dst)
+	_ = pr.CloseWithError(uploadEnded)
+	downloadErr := <-downloaded
+	if errors.Is(downloadErr, uploadEnded) {
+		// the download was stopped by the upload, which failed on its own
+		downloadErr = nil
+	}
+	if err != nil && downloadErr == nil {
+		return nil, err
+	}
+	if downloadErr != nil {
+		// the upload (if it failed) failed because the download closed the pipe
+		return nil, fmt.Errorf("error reading %v: %v", src, downloadErr)
+	}
+	expectedDigest := sha256Digest.Sum(nil)
+	expectedMD5 := md5Digest.Sum(nil)
+
+	actualLength, err := dst.ContentLength(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine content-length after copy: %v", err)
+	}
+	if actualLength != contentLength {
+		return nil, fmt.Errorf("content-length mismatch: expected: %d, actual: %d", contentLength, actualLength)
+	}
+
+	switch c.Verify {
+	case VerifyDownload:
+		logger.Detailf("Verifying %v (expected digest: %x)\n", dst, expectedDigest)
+		actualDigest, err := CalcDigest(ctx, dst, DefaultRangeSize, "sha256")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(expectedDigest, actualDigest) {
+			return nil, fmt.Errorf("digest mismatch:\nexpected:\n%x\nactual: %x", expectedDigest, actualDigest)
+		}
+	case VerifyETag:
+		if reporter, ok := dst.(MD5Reporter); ok {
+			actualMD5, err := reporter.ContentMD5(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if actualMD5 != nil && !bytes.Equal(expectedMD5, actualMD5) {
+				return nil, fmt.Errorf("MD5 mismatch: source: %x, destination: %x", expectedMD5, actualMD5)
+			}
+		}
+	}
+
+	return &Receipt{
+		Object: dst.Pretty(),
+		Source: src.Pretty(),
+		Size:   contentLength,
+		Digests: map[string]string{
+			"md5":    fmt.Sprintf("%x", expectedMD5),
+			"sha256": fmt.Sprintf("%x", expectedDigest),
+		},
+		Verification:   c.Verify,
+		Started:        started,
+		ElapsedSeconds: time.Since(started).Seconds(),
+	}, nil
+}
+
+// ------------------------------------------------------------
+// BulkCopy type
+
+// The BulkCopy struct represents a copy of many objects from a source bucket
+// and prefix to a destination bucket and prefix. Each object's key relative
+// to the source prefix is preserved relative to the destination prefix.
+type BulkCopy struct {
+	Source            Target
+	SourcePrefix      string
+	Destination       Target
+	DestinationPrefix string
+	// Keys lists the keys to copy, relative to the source prefix; if nil, all
+	// objects under the source prefix are listed and copied
+	Keys []string
+	// Verify is the verification mode for each copy (see Copy)
+	Verify string
+	// Concurrency is the number of objects to copy at once
+	Concurrency int
+	// Log, if not nil, records a receipt for each object copied
+	Log *ReceiptLog
+	// Done lists source object URLs already copied (e.g. as recorded in the log
+	// of a previous, interrupted run), which will be skipped
+	Done []string
+	// Copied, if not nil, is called after each successful copy
+	Copied func(r *Receipt)
+}
+
+// CopyAll copies the objects, returning the number copied, skipped as already
+// done, and failed. Failures are logged, but do not stop the copy unless the
+// context is cancelled.
+func (b *BulkCopy) CopyAll(ctx context.Context) (copied, skipped, failed int, err error) {
+	logger := logging.DefaultLogger()
+
+	keys := b.Keys
+	if keys == nil {
+		infos, err := ListObjects(ctx, b.Source, b.SourcePrefix)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, info := range infos {
+			keys = append(keys, strings.TrimPrefix(info.Key, b.SourcePrefix))
+		}
+	}
+	done := map[string]bool{}
+	for _, url := range b.Done {
+		done[url] = true
+	}
+
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCopyConcurrency
+	}
+
+	var (
+		mux sync.Mutex
+		wg  sync.WaitGroup
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, key := range keys {
+		src := b.Source.Object(b.SourcePrefix + key)
+		if done[src.Pretty()] {
+			logger.Detailf("Skipping %v (already copied)\n", src)
+			skipped++
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		dst := b.Destination.Object(b.DestinationPrefix + key)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r, err := b.copyOne(ctx, src, dst)
+
+			mux.Lock()
+			defer mux.Unlock()
+			if err != nil {
+				failed++
+				logger.Infof("Copying %v to %v failed: %v\n", src, dst, logging.FormatError(err))
+				return
+			}
+			copied++
+			if b.Copied != nil {
+				b.Copied(r)
+			}
+		}()
+	}
+	wg.Wait()
+	return copied, skipped, failed, ctx.Err()
+}
+
+func (b *BulkCopy) copyOne(ctx context.Context, src, dst Object) (*Receipt, error) {
+	c := Copy{Source: src, Destination: dst, Verify: b.Verify}
+	r, err := c.CopyAndVerify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.Log != nil {
+		if err := b.Log.Append(r); err != nil {
+			return nil, fmt.Errorf("error writing receipt log: %v", err)
+		}
+	}
+	return r, nil
+}
@@ -1,13 +1,17 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"math/rand"
+	"strconv"
 	"time"
 
 	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
 
 	"github.com/dmolesUC3/cos/internal/logging"
 )
@@ -17,11 +21,30 @@ const (
 	DefaultRandomSeed         = 1
 )
 
+// User metadata keys recorded by crvd (see Crvd.WriteMetadata)
+const (
+	CrvdMetaGenerator = "cos-generator"
+	CrvdMetaSeed      = "cos-seed"
+	CrvdMetaPattern   = "cos-pattern"
+	CrvdMetaSize      = "cos-size"
+	CrvdMetaSHA256    = "cos-sha256"
+)
+
 type Crvd struct {
 	Object        Object
 	ContentLength int64
-	RandomSeed    int64
-	BodyProvider  func() io.Reader
+	// Generator generates the object's body
+	Generator Generator
+	// BodyProvider, if not nil, provides the object's body instead of
+	// Generator
+	BodyProvider func() io.Reader
+	// WriteMetadata, if true, records the generator, seed, size, and digest
+	// of the object as user metadata on the object (see CrvdMetaGenerator
+	// etc.), so that it can later be verified with VerifyExisting
+	WriteMetadata bool
+
+	expected []byte // digest of the generated body, once calculated
+	recorded []byte // digest recorded in metadata or a receipt, if any
 }
 
 func NewDefaultCrvd(target Target, key string) *Crvd {
@@ -36,27 +59,171 @@ func NewCrvd(target Target, key string, contentLength int64, randomSeed int64) *
 	var crvd = Crvd{
 		Object:        obj,
 		ContentLength: contentLength,
-		RandomSeed:    randomSeed, // TODO: clean this up so we set BodyProvider instead of RandomSeed
+		Generator:     RandomGenerator(randomSeed),
 	}
 	return &crvd
 }
 
-func (c *Crvd) CreateRetrieveVerifyDelete() error {
-	err := c.CreateRetrieveVerify()
-	err2 := c.Object.Delete()
+// NewCrvdWithGenerator creates a Crvd whose body is generated by the specified
+// generator
+func NewCrvdWithGenerator(target Target, key string, contentLength int64, generator Generator) (*Crvd, error) {
+	if err := generator.Validate(); err != nil {
+		return nil, err
+	}
+	crvd := NewCrvd(target, key, contentLength, generator.Seed)
+	crvd.Generator = generator
+	return crvd, nil
+}
+
+// CrvdFromMetadata returns a Crvd for an existing object created with
+// WriteMetadata, with the generator and size recorded in its user metadata
+func CrvdFromMetadata(ctx context.Context, obj Object) (*Crvd, error) {
+	mdObj, ok := obj.(MetadataObject)
+	if !ok {
+		return nil, fmt.Errorf("%v does not support metadata", obj.Pretty())
+	}
+	md, err := mdObj.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user := md.User
+	if user[CrvdMetaGenerator] == "" || user[CrvdMetaSize] == "" {
+		return nil, fmt.Errorf("%v has no crvd metadata", obj.Pretty())
+	}
+	c := &Crvd{Object: obj, Generator: Generator{Kind: user[CrvdMetaGenerator], Pattern: user[CrvdMetaPattern]}}
+	if c.ContentLength, err = strconv.ParseInt(user[CrvdMetaSize], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid %v metadata for %v: %v", CrvdMetaSize, obj.Pretty(), err)
+	}
+	if seed := user[CrvdMetaSeed]; seed != "" {
+		if c.Generator.Seed, err = strconv.ParseInt(seed, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid %v metadata for %v: %v", CrvdMetaSeed, obj.Pretty(), err)
+		}
+	}
+	if c.recorded, err = hex.DecodeString(user[CrvdMetaSHA256]); err != nil {
+		return nil, fmt.Errorf("invalid %v metadata for %v: %v", CrvdMetaSHA256, obj.Pretty(), err)
+	}
+	return c, c.Generator.Validate()
+}
+
+// CrvdFromReceipt returns a Crvd for an existing object, with the generator,
+// size, and digest recorded in a receipt (see Crvd.NewReceipt)
+func CrvdFromReceipt(obj Object, r *Receipt) (*Crvd, error) {
+	if r.Generator == nil {
+		return nil, fmt.Errorf("receipt for %v does not record a generator", r.Object)
+	}
+	c := &Crvd{Object: obj, ContentLength: r.Size, Generator: *r.Generator}
+	var err error
+	if c.recorded, err = hex.DecodeString(r.Digests["sha256"]); err != nil {
+		return nil, fmt.Errorf("invalid sha256 digest in receipt for %v: %v", r.Object, err)
+	}
+	return c, c.Generator.Validate()
+}
+
+// ExpectedDigest returns the SHA-256 digest of the generated body,
+// calculating it (without uploading anything) if necessary
+func (c *Crvd) ExpectedDigest() ([]byte, error) {
+	if c.expected != nil {
+		return c.expected, nil
+	}
+	if c.BodyProvider != nil {
+		return nil, fmt.Errorf("can't calculate expected digest of a body from BodyProvider")
+	}
+	body, err := c.Generator.NewReader(c.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, body); err != nil {
+		return nil, err
+	}
+	c.expected = digest.Sum(nil)
+	return c.expected, nil
+}
+
+// Metadata returns the user metadata recording the generator, seed, size,
+// and digest of the object
+func (c *Crvd) Metadata() (*Metadata, error) {
+	digest, err := c.ExpectedDigest()
+	if err != nil {
+		return nil, err
+	}
+	user := map[string]string{
+		CrvdMetaGenerator: c.Generator.Kind,
+		CrvdMetaSeed:      strconv.FormatInt(c.Generator.Seed, 10),
+		CrvdMetaSize:      strconv.FormatInt(c.ContentLength, 10),
+		CrvdMetaSHA256:    hex.EncodeToString(digest),
+	}
+	if c.Generator.Pattern != "" {
+		user[CrvdMetaPattern] = c.Generator.Pattern
+	}
+	return &Metadata{User: user}, nil
+}
+
+// NewReceipt returns a receipt recording the object's generator, size, and
+// digest, for an object created and verified starting at the specified time
+func (c *Crvd) NewReceipt(started time.Time) (*Receipt, error) {
+	digest, err := c.ExpectedDigest()
+	if err != nil {
+		return nil, err
+	}
+	generator := c.Generator
+	return &Receipt{
+		Object:         c.Object.Pretty(),
+		Size:           c.ContentLength,
+		Digests:        map[string]string{"sha256": hex.EncodeToString(digest)},
+		Verification:   VerifyDownload,
+		Started:        started,
+		ElapsedSeconds: time.Since(started).Seconds(),
+		Generator:      &generator,
+	}, nil
+}
+
+// VerifyExisting regenerates the expected digest of an existing object (see
+// CrvdFromMetadata and CrvdFromReceipt), and verifies the object's size and
+// digest, returning the digest.
+func (c *Crvd) VerifyExisting(ctx context.Context) ([]byte, error) {
+	logger := logging.DefaultLogger()
+	logger.Detailf("Regenerating %v of %v\n", logging.FormatBytes(c.ContentLength), c.Generator)
+	expected, err := c.ExpectedDigest()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.recorded) > 0 && !bytes.Equal(c.recorded, expected) {
+		return nil, fmt.Errorf("regenerated digest %x does not match recorded digest %x", expected, c.recorded)
+	}
+	actualLength, err := c.Object.ContentLength(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if actualLength != c.ContentLength {
+		return nil, fmt.Errorf("content-length mismatch: expected: %d, actual: %d", c.ContentLength, actualLength)
+	}
+	logger.Detailf("Verifying %v (expected digest: %x)\n", c.Object, expected)
+	check := Check{Object: c.Object, Expected: expected, Algorithm: "sha256"}
+	return check.VerifyDigest(ctx)
+}
+
+// CreateRetrieveVerifyDelete creates, retrieves, verifies, and deletes the
+// object. The object is deleted even if the context is cancelled or its
+// deadline expires before verification is complete.
+func (c *Crvd) CreateRetrieveVerifyDelete(ctx context.Context) error {
+	err := c.CreateRetrieveVerify(ctx)
+	err2 := c.Object.Delete(context.WithoutCancel(ctx))
 	if err == nil {
 		return err2
 	}
 	return err
 }
 
-func (c *Crvd) CreateRetrieveVerify() error {
+// CreateRetrieveVerify creates, retrieves, and verifies the object, returning
+// an error if any step fails or the context is cancelled.
+func (c *Crvd) CreateRetrieveVerify(ctx context.Context) error {
 	obj := c.Object
 	contentLength := c.ContentLength
 
 	logger := logging.DefaultLogger()
 	logger.Tracef("Creating object (%v) at %v\n", logging.FormatBytes(contentLength), obj)
-	expectedDigest, err := c.create()
+	expectedDigest, err := c.create(ctx)
 	if err != nil {
 		return err
 	}
@@ -64,7 +231,7 @@ func (c *Crvd) CreateRetrieveVerify() error {
 	logger.Tracef("Calculated digest on upload: %x\n", expectedDigest)
 
 	var actualLength int64
-	actualLength, err = obj.ContentLength()
+	actualLength, err = obj.ContentLength(ctx)
 	if err != nil {
 		return fmt.Errorf("unable to determine content-length after upload: %v", err)
 	}
@@ -75,36 +242,61 @@ func (c *Crvd) CreateRetrieveVerify() error {
 	logger.Tracef("Uploaded %d bytes\n", contentLength)
 	logger.Detailf("Verifying %v (expected digest: %x)\n", obj, expectedDigest)
 	check := Check{Object: obj, Expected: expectedDigest, Algorithm: "sha256"}
-	actualDigest, err := check.VerifyDigest()
+	actualDigest, err := check.VerifyDigest(ctx)
 	if err == nil {
 		logger.Tracef("Verified %v (%d bytes, SHA-256 digest %x)\n", obj, contentLength, actualDigest)
 	}
 	return err
 }
 
-func (c *Crvd) NewBody() io.Reader {
+// NewBody returns a reader for the object's body, from BodyProvider if set,
+// otherwise from Generator
+func (c *Crvd) NewBody() (io.Reader, error) {
 	if c.BodyProvider != nil {
-		return c.BodyProvider()
+		return c.BodyProvider(), nil
 	}
-	random := rand.New(rand.NewSource(c.RandomSeed))
-	return io.LimitReader(random, c.ContentLength)
+	return c.Generator.NewReader(c.ContentLength)
 }
 
-func (c *Crvd) create() ([] byte, error) {
+func (c *Crvd) create(ctx context.Context) ([] byte, error) {
 	obj := c.Object
 	logger := logging.DefaultLogger()
 
+	var metadata *Metadata
+	var err error
+	if c.WriteMetadata {
+		if metadata, err = c.Metadata(); err != nil {
+			return nil, err
+		}
+	}
 	digest := sha256.New()
-	tr := io.TeeReader(c.NewBody(), digest)
 
 	contentLength := c.ContentLength
-	in := logging.NewProgressReader(tr, contentLength)
-	in.LogTo(logger, 2 * time.Second)
+	progress := logging.NewProgressWriter(digest, contentLength)
+	progress.LogTo(logger, 2 * time.Second)
+	progress.ObserveFrom(ctx, "upload")
+	defer progress.Stop()
+	// the body is regenerated as needed, so that a single PUT can be sent
+	// without holding the body in memory
+	in := NewTeeReadSeeker(NewReplayReader(c.NewBody, contentLength), progress)
 
-	err := obj.Create(in, contentLength)
+	err = createWithMetadata(ctx, obj, in, contentLength, metadata)
 	if err != nil {
 		return nil, err
 	}
-	logger.Detailf("%v to %v\n", logging.FormatBytes(in.TotalBytes()), obj)
+	logger.Detailf("%v to %v\n", logging.FormatBytes(progress.TotalBytes()), obj)
 	return digest.Sum(nil), err
 }
+
+// createWithMetadata creates the object with the specified metadata, if not
+// nil, returning an error if the object does not support metadata
+func createWithMetadata(ctx context.Context, obj Object, body io.Reader, length int64, metadata *Metadata) error {
+	if metadata == nil {
+		return obj.Create(ctx, body, length)
+	}
+	mdObj, ok := obj.(MetadataObject)
+	if !ok {
+		return fmt.Errorf("%v does not support metadata", obj.Pretty())
+	}
+	return mdObj.CreateWithMetadata(ctx, body, length, metadata)
+}
@@ -0,0 +1,220 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// Difference statuses
+const (
+	// DiffMissing indicates an object present in the source but not the destination
+	DiffMissing = "missing"
+	// DiffExtra indicates an object present in the destination but not the source
+	DiffExtra = "extra"
+	// DiffSize indicates an object whose size differs between source and destination
+	DiffSize = "size"
+	// DiffDigest indicates an object whose digest differs between source and destination
+	DiffDigest = "digest"
+	// DiffError indicates an object whose digests could not be compared
+	DiffError = "error"
+)
+
+// ------------------------------------------------------------
+// DiffReport type
+
+// The Difference struct describes one object that differs between the source
+// and destination
+type Difference struct {
+	// Key is the object key, relative to the source or destination prefix
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	// SourceSize is the size of the source object, or -1 if missing or unknown
+	SourceSize int64 `json:"source_size"`
+	// DestinationSize is the size of the destination object, or -1 if missing
+	DestinationSize int64 `json:"destination_size"`
+	// Detail gives the differing digests, or the error, if any
+	Detail string `json:"detail,omitempty"`
+}
+
+// The DiffReport struct records the result of a Diff
+type DiffReport struct {
+	Source      string       `json:"source"`
+	Destination string       `json:"destination"`
+	Compared    int          `json:"compared"`
+	Differences []Difference `json:"differences"`
+}
+
+// ------------------------------------------------------------
+// Diff type
+
+// The Diff struct represents a comparison of the objects under a source prefix
+// (or listed in a manifest) with those under a destination prefix
+type Diff struct {
+	Source       Target
+	SourcePrefix string
+	// Manifest, if not nil, lists the expected objects in place of the source
+	Manifest          []ManifestEntry
+	Destination       Target
+	DestinationPrefix string
+	// Digests determines whether the digests of objects present on both sides
+	// with the same size are compared. Digests are calculated with SHA-256,
+	// unless the manifest gives an MD5 digest.
+	Digests bool
+	// Concurrency is the number of digests to calculate at once
+	Concurrency int
+}
+
+// Compare lists the source (or reads the manifest) and the destination, and
+// reports objects missing from the destination, extra objects in the
+// destination, and objects whose sizes (and optionally digests) differ.
+func (d *Diff) Compare(ctx context.Context) (*DiffReport, error) {
+	expected, err := d.expected(ctx)
+	if err != nil {
+		return nil, err
+	}
+	actual := map[string]ObjectInfo{}
+	infos, err := ListObjects(ctx, d.Destination, d.DestinationPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		actual[strings.TrimPrefix(info.Key, d.DestinationPrefix)] = info
+	}
+
+	var keys []string
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	for k := range actual {
+		if _, ok := expected[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	report := &DiffReport{Source: d.sourcePretty(), Destination: d.Destination.Object(d.DestinationPrefix).Pretty()}
+	var toDigest []Difference
+	for _, k := range keys {
+		e, inSource := expected[k]
+		a, inDest := actual[k]
+		report.Compared++
+		switch {
+		case !inDest:
+			report.Differences = append(report.Differences, Difference{Key: k, Status: DiffMissing, SourceSize: e.Size, DestinationSize: -1})
+		case !inSource:
+			report.Differences = append(report.Differences, Difference{Key: k, Status: DiffExtra, SourceSize: -1, DestinationSize: a.Size})
+		case e.Size >= 0 && e.Size != a.Size:
+			report.Differences = append(report.Differences, Difference{Key: k, Status: DiffSize, SourceSize: e.Size, DestinationSize: a.Size})
+		case d.Digests && (e.Digest != nil || d.Manifest == nil):
+			toDigest = append(toDigest, Difference{Key: k, SourceSize: e.Size, DestinationSize: a.Size})
+		}
+	}
+
+	report.Differences = append(report.Differences, d.compareDigests(ctx, toDigest, expected)...)
+	sort.SliceStable(report.Differences, func(i, j int) bool {
+		return report.Differences[i].Key < report.Differences[j].Key
+	})
+	return report, ctx.Err()
+}
+
+// expected returns the expected objects, from the manifest or from a listing
+// of the source, keyed by their keys relative to the source prefix
+func (d *Diff) expected(ctx context.Context) (map[string]ManifestEntry, error) {
+	expected := map[string]ManifestEntry{}
+	if d.Manifest != nil {
+		for _, e := range d.Manifest {
+			expected[e.Key] = e
+		}
+		return expected, nil
+	}
+	infos, err := ListObjects(ctx, d.Source, d.SourcePrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		key := strings.TrimPrefix(info.Key, d.SourcePrefix)
+		expected[key] = ManifestEntry{Key: key, Size: info.Size}
+	}
+	return expected, nil
+}
+
+// compareDigests compares the digests of the specified objects, returning
+// those that differ (or could not be compared)
+func (d *Diff) compareDigests(ctx context.Context, candidates []Difference, expected map[string]ManifestEntry) []Difference {
+	logger := logging.DefaultLogger()
+	concurrency := d.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCopyConcurrency
+	}
+
+	var (
+		mux   sync.Mutex
+		wg    sync.WaitGroup
+		diffs []Difference
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, diff := range candidates {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(diff Difference) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			srcDigest, dstDigest, err := d.digests(ctx, expected[diff.Key])
+			if err == nil && bytes.Equal(srcDigest, dstDigest) {
+				logger.Detailf("%v: digests match (%x)\n", diff.Key, dstDigest)
+				return
+			}
+			if err != nil {
+				diff.Status = DiffError
+				diff.Detail = err.Error()
+			} else {
+				diff.Status = DiffDigest
+				diff.Detail = fmt.Sprintf("%x != %x", srcDigest, dstDigest)
+			}
+			mux.Lock()
+			diffs = append(diffs, diff)
+			mux.Unlock()
+		}(diff)
+	}
+	wg.Wait()
+	return diffs
+}
+
+// digests returns the source and destination digests of the specified object
+func (d *Diff) digests(ctx context.Context, e ManifestEntry) (srcDigest, dstDigest []byte, err error) {
+	algorithm := "sha256"
+	if len(e.Digest) == 16 {
+		algorithm = "md5"
+	}
+	if srcDigest = e.Digest; srcDigest == nil {
+		if srcDigest, err = CalcDigest(ctx, d.Source.Object(d.SourcePrefix+e.Key), DefaultRangeSize, algorithm); err != nil {
+			return nil, nil, fmt.Errorf("source: %v", err)
+		}
+	}
+	if dstDigest, err = CalcDigest(ctx, d.Destination.Object(d.DestinationPrefix+e.Key), DefaultRangeSize, algorithm); err != nil {
+		return nil, nil, fmt.Errorf("destination: %v", err)
+	}
+	return srcDigest, dstDigest, nil
+}
+
+func (d *Diff) sourcePretty() string {
+	if d.Manifest != nil {
+		return "manifest"
+	}
+	return d.Source.Object(d.SourcePrefix).Pretty()
+}
@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+)
+
+// Generator kinds
+const (
+	// GeneratorRandom generates pseudo-random bytes with the Go math/rand
+	// generator, seeded with the generator's seed
+	GeneratorRandom = "random"
+	// GeneratorCrypto generates cryptographically strong (incompressible, and
+	// not deduplicable) bytes: an AES-256-CTR keystream, keyed by the SHA-256
+	// digest of the generator's seed
+	GeneratorCrypto = "crypto"
+	// GeneratorZero generates zero bytes
+	GeneratorZero = "zero"
+	// GeneratorPattern repeats the generator's pattern
+	GeneratorPattern = "pattern"
+	// GeneratorText generates highly compressible English-like text, with
+	// words chosen using the generator's seed
+	GeneratorText = "text"
+	// GeneratorOffset generates position-encoded bytes: each 8-byte word is
+	// its own offset in the object, as a big-endian unsigned integer, so that
+	// misplaced or corrupted data identifies where it came from
+	GeneratorOffset = "offset"
+)
+
+// DefaultPattern is the default pattern for GeneratorPattern
+const DefaultPattern = "0123456789abcdef"
+
+// GeneratorKinds lists the supported generator kinds
+var GeneratorKinds = []string{
+	GeneratorRandom, GeneratorCrypto, GeneratorZero, GeneratorPattern, GeneratorText, GeneratorOffset,
+}
+
+// ------------------------------------------------------------
+// Generator type
+
+// The Generator struct describes how to generate the body of a test object.
+// Every generator is deterministic, so the same body (and digest) can be
+// re-created later from the same parameters.
+type Generator struct {
+	// Kind is the kind of generator (see GeneratorKinds)
+	Kind string `json:"kind"`
+	// Seed seeds the random, crypto, and text generators
+	Seed int64 `json:"seed,omitempty"`
+	// Pattern is the pattern repeated by the pattern generator
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// RandomGenerator returns a Generator of seeded pseudo-random bytes
+func RandomGenerator(seed int64) Generator {
+	return Generator{Kind: GeneratorRandom, Seed: seed}
+}
+
+// Validate returns an error if the generator kind is unknown, or its
+// parameters are invalid
+func (g Generator) Validate() error {
+	switch g.Kind {
+	case GeneratorRandom, GeneratorCrypto, GeneratorZero, GeneratorText, GeneratorOffset:
+		return nil
+	case GeneratorPattern:
+		if g.Pattern == "" {
+			return fmt.Errorf("pattern generator requires a pattern")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown generator: %#v (expected one of: %v)", g.Kind, strings.Join(GeneratorKinds, ", "))
+}
+
+// NewReader returns a reader for the first contentLength bytes generated
+func (g Generator) NewReader(contentLength int64) (io.Reader, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	var r io.Reader
+	switch g.Kind {
+	case GeneratorRandom:
+		r = rand.New(rand.NewSource(g.Seed))
+	case GeneratorCrypto:
+		r = newCryptoReader(g.Seed)
+	case GeneratorZero:
+		r = &patternReader{pattern: []byte{0}}
+	case GeneratorPattern:
+		r = &patternReader{pattern: []byte(g.Pattern)}
+	case GeneratorText:
+		r = &textReader{random: rand.New(rand.NewSource(g.Seed))}
+	case GeneratorOffset:
+		r = &offsetReader{}
+	}
+	return io.LimitReader(r, contentLength), nil
+}
+
+// String returns a description of the generator and its parameters
+func (g Generator) String() string {
+	switch g.Kind {
+	case GeneratorRandom, GeneratorCrypto, GeneratorText:
+		return fmt.Sprintf("%v (seed %d)", g.Kind, g.Seed)
+	case GeneratorPattern:
+		return fmt.Sprintf("%v (%#v)", g.Kind, g.Pattern)
+	}
+	return g.Kind
+}
+
+// ------------------------------------------------------------
+// Unexported types
+
+// cryptoReader reads an AES-256-CTR keystream
+type cryptoReader struct {
+	stream cipher.Stream
+}
+
+func newCryptoReader(seed int64) *cryptoReader {
+	var seedBytes [8]byte
+	binary.BigEndian.PutUint64(seedBytes[:], uint64(seed))
+	key := sha256.Sum256(seedBytes[:])
+	block, _ := aes.NewCipher(key[:])
+	return &cryptoReader{stream: cipher.NewCTR(block, make([]byte, aes.BlockSize))}
+}
+
+func (r *cryptoReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	r.stream.XORKeyStream(p, p)
+	return len(p), nil
+}
+
+// patternReader repeats a pattern
+type patternReader struct {
+	pattern []byte
+	offset  int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.pattern[r.offset]
+		r.offset = (r.offset + 1) % len(r.pattern)
+	}
+	return len(p), nil
+}
+
+// offsetReader writes the offset of each 8-byte word as the word's value
+type offsetReader struct {
+	offset uint64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	for i := range p {
+		word := r.offset &^ 7
+		shift := 8 * (7 - r.offset%8)
+		p[i] = byte(word >> shift)
+		r.offset++
+	}
+	return len(p), nil
+}
+
+// textWords is the vocabulary for textReader
+var textWords = strings.Fields(`
+	the of and to in is was for that with as on by at from it this be are or
+	an which were not but have had has one all their also been its more other
+	object storage bucket cloud digest verify check copy archive preserve
+	data file block byte segment version replica fixity integrity
+`)
+
+// textReader generates lines of words chosen at random from textWords
+type textReader struct {
+	random *rand.Rand
+	line   []byte
+}
+
+func (r *textReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.line) == 0 {
+			r.line = r.nextLine()
+		}
+		copied := copy(p[n:], r.line)
+		r.line = r.line[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+func (r *textReader) nextLine() []byte {
+	words := make([]string, 8+r.random.Intn(8))
+	for i := range words {
+		words[i] = textWords[r.random.Intn(len(textWords))]
+	}
+	return []byte(strings.Join(words, " ") + ".\n")
+}
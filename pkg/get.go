@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// Verification modes for downloads
+const (
+	// VerifyExpected compares the downloaded digest with an expected digest
+	VerifyExpected = "expected"
+	// VerifyServerMD5 compares the downloaded MD5 digest with the MD5 digest
+	// recorded by the server (see MD5Reporter)
+	VerifyServerMD5 = "server-md5"
+)
+
+// The Get struct represents a download to a local file
+type Get struct {
+	Object Object
+	Path   string
+	// Algorithms lists the digest algorithms to compute
+	Algorithms []string
+	// Expected is the expected digest (MD5 or SHA-256, determined by its length)
+	Expected []byte
+	// Overwrite causes any existing file to be replaced, rather than resumed
+	Overwrite bool
+	// Resume causes an existing file to be resumed even when the completed
+	// download can't be verified (no expected digest, and no server MD5)
+	Resume bool
+}
+
+// DownloadAndVerify downloads the object to the file, computing its digests
+// along the way, and returns a receipt. The download is verified against the
+// expected digest, if any, or else against the MD5 digest recorded by the
+// server, if available; if verification fails, the file is removed.
+//
+// If the file already exists and is shorter than the object, the download
+// resumes from the end of the file (unless Overwrite is set), provided the
+// download can be verified, or Resume is set. Otherwise an existing file is
+// an error, since it may not be a partial download of the object.
+func (g *Get) DownloadAndVerify(ctx context.Context) (*Receipt, error) {
+	obj := g.Object
+	logger := logging.DefaultLogger()
+	started := time.Now()
+
+	algorithms, expectedAlg, err := g.algorithms()
+	if err != nil {
+		return nil, err
+	}
+
+	verification := VerifyNone
+	var serverMD5 []byte
+	if expectedAlg != "" {
+		verification = VerifyExpected
+	} else if reporter, ok := obj.(MD5Reporter); ok {
+		if serverMD5, err = reporter.ContentMD5(ctx); err != nil {
+			return nil, err
+		}
+		if serverMD5 != nil {
+			verification = VerifyServerMD5
+			algorithms = appendIfMissing(algorithms, "md5")
+		}
+	}
+
+	hashes := map[string]hash.Hash{}
+	var writers []io.Writer
+	for _, alg := range algorithms {
+		h, err := NewHash(alg)
+		if err != nil {
+			return nil, err
+		}
+		hashes[alg] = h
+		writers = append(writers, h)
+	}
+	digest := io.MultiWriter(writers...)
+
+	contentLength, err := obj.ContentLength(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resume := g.Resume || verification != VerifyNone
+	file, offset, err := g.openFile(contentLength, digest, resume)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		logger.Infof("Resuming download of %v at %d of %d bytes\n", obj, offset, contentLength)
+	}
+	_, err = DownloadFrom(ctx, obj, offset, DefaultRangeSize, io.MultiWriter(file, digest))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	digests := map[string][]byte{}
+	hexDigests := map[string]string{}
+	for alg, h := range hashes {
+		digests[alg] = h.Sum(nil)
+		hexDigests[alg] = fmt.Sprintf("%x", digests[alg])
+	}
+
+	var verifyErr error
+	switch verification {
+	case VerifyExpected:
+		if !bytes.Equal(g.Expected, digests[expectedAlg]) {
+			verifyErr = fmt.Errorf("digest mismatch:\nexpected:\n%x\nactual: %x", g.Expected, digests[expectedAlg])
+		}
+	case VerifyServerMD5:
+		if !bytes.Equal(serverMD5, digests["md5"]) {
+			verifyErr = fmt.Errorf("MD5 mismatch: server: %x, downloaded: %x", serverMD5, digests["md5"])
+		}
+	}
+	if verifyErr != nil {
+		// remove the file, so a later attempt doesn't resume it
+		if err := os.Remove(g.Path); err != nil {
+			return nil, fmt.Errorf("%v (unable to remove %v: %v)", verifyErr, g.Path, err)
+		}
+		return nil, fmt.Errorf("%v (removed %v)", verifyErr, g.Path)
+	}
+
+	return &Receipt{
+		Object:         obj.Pretty(),
+		Destination:    g.Path,
+		Size:           contentLength,
+		Digests:        hexDigests,
+		Verification:   verification,
+		Started:        started,
+		ElapsedSeconds: time.Since(started).Seconds(),
+	}, nil
+}
+
+// algorithms returns the digest algorithms to compute, including the
+// algorithm of the expected digest (if any), along with that algorithm
+func (g *Get) algorithms() (algorithms []string, expectedAlg string, err error) {
+	algorithms = append(algorithms, g.Algorithms...)
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha256"}
+	}
+	switch len(g.Expected) {
+	case 0:
+		return algorithms, "", nil
+	case 16:
+		expectedAlg = "md5"
+	case 32:
+		expectedAlg = "sha256"
+	default:
+		return nil, "", fmt.Errorf("expected digest %x is neither an MD5 nor a SHA-256 digest", g.Expected)
+	}
+	return appendIfMissing(algorithms, expectedAlg), expectedAlg, nil
+}
+
+// openFile opens the file for writing, returning the offset at which to
+// resume the download. Any existing content is read into the digest. If
+// resume is false, an existing non-empty file is an error.
+func (g *Get) openFile(contentLength int64, digest io.Writer, resume bool) (*os.File, int64, error) {
+	if g.Overwrite {
+		file, err := os.Create(g.Path)
+		return file, 0, err
+	}
+	if info, err := os.Stat(g.Path); err == nil && info.Size() > 0 && !resume {
+		return nil, 0, fmt.Errorf(
+			"existing file %v can't be resumed: no expected digest, and no MD5 digest recorded by the server, to verify the result",
+			g.Path,
+		)
+	}
+	file, err := os.OpenFile(g.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := io.Copy(digest, file)
+	if err == nil && offset > contentLength {
+		err = fmt.Errorf("existing file %v (%d bytes) is larger than %v (%d bytes)", g.Path, offset, g.Object, contentLength)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+	// after reading, the file is positioned at the end, ready to append
+	return file, offset, nil
+}
+
+func appendIfMissing(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,619 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/keys"
+	. "github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// Job types
+const (
+	JobCheck = "check"
+	JobCrvd  = "crvd"
+	JobKeys  = "keys"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// DefaultJobWorkers is the default number of jobs run at once
+const DefaultJobWorkers = 4
+
+// ------------------------------------------------------------
+// JobRequest type
+
+// The JobRequest struct describes a job to be run by a JobServer
+type JobRequest struct {
+	// Type is JobCheck, JobCrvd, or JobKeys
+	Type string `json:"type"`
+	// URL is the object URL (check) or bucket URL (crvd, keys)
+	URL string `json:"url"`
+	// Profile, Endpoint, and Region override the server's defaults
+	Profile  string `json:"profile,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+
+	// Algorithm and Expected are the digest algorithm (default sha256) and
+	// the expected digest, in hex (check)
+	Algorithm string `json:"algorithm,omitempty"`
+	Expected  string `json:"expected,omitempty"`
+
+	// Key, Size, and Seed are the key (default cos-crvd-TIMESTAMP.bin), size
+	// in bytes, and random seed of the object to create (crvd)
+	Key  string `json:"key,omitempty"`
+	Size int64  `json:"size,omitempty"`
+	Seed int64  `json:"seed,omitempty"`
+	// Generator and Pattern are the content generator (default random) and
+	// the pattern for the pattern generator (crvd; see Generator)
+	Generator string `json:"generator,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	// List and Sample are the name of the key list to check (default
+	// "Default") and the sample size, or 0 for all keys (keys)
+	List   string `json:"list,omitempty"`
+	Sample int    `json:"sample,omitempty"`
+}
+
+func (r *JobRequest) validate() error {
+	switch r.Type {
+	case JobCheck:
+		if r.URL == "" {
+			return fmt.Errorf("check job requires an object URL")
+		}
+		if r.Algorithm != "" && r.Algorithm != "sha256" && r.Algorithm != "md5" {
+			return fmt.Errorf("unsupported digest algorithm: %#v", r.Algorithm)
+		}
+		if _, err := hex.DecodeString(r.Expected); err != nil {
+			return fmt.Errorf("invalid expected digest: %v", err)
+		}
+	case JobCrvd:
+		if r.Size < 0 {
+			return fmt.Errorf("invalid size: %d", r.Size)
+		}
+		if r.Generator != "" {
+			if err := r.generator().Validate(); err != nil {
+				return err
+			}
+		}
+	case JobKeys:
+		if r.Sample < 0 {
+			return fmt.Errorf("invalid sample size: %d", r.Sample)
+		}
+		if r.List != "" {
+			if _, err := KeyListForName(r.List); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported job type: %#v (expected %v, %v, or %v)", r.Type, JobCheck, JobCrvd, JobKeys)
+	}
+	return nil
+}
+
+// generator returns the content generator for a crvd request
+func (r *JobRequest) generator() Generator {
+	g := Generator{Kind: r.Generator, Seed: r.Seed, Pattern: r.Pattern}
+	if g.Kind == "" {
+		g.Kind = GeneratorRandom
+	}
+	if g.Seed == 0 {
+		g.Seed = DefaultRandomSeed
+	}
+	if g.Kind == GeneratorPattern && g.Pattern == "" {
+		g.Pattern = DefaultPattern
+	}
+	return g
+}
+
+// JobResolver resolves the targets and objects named in job requests
+type JobResolver interface {
+	// Target returns the target for the request's bucket URL
+	Target(req *JobRequest) (Target, error)
+	// Object returns the object for the request's object URL
+	Object(req *JobRequest) (Object, error)
+}
+
+// ------------------------------------------------------------
+// Job type
+
+// The Job struct records the state of a job submitted to a JobServer
+type Job struct {
+	ID       string     `json:"id"`
+	Request  JobRequest `json:"request"`
+	State    string     `json:"state"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Restarts counts the times the job was interrupted by a server shutdown
+	// and restarted
+	Restarts int          `json:"restarts,omitempty"`
+	Progress *JobProgress `json:"progress,omitempty"`
+	// Result is the job's result (see CheckJobResult, CrvdJobResult, and
+	// KeysJobResult), if any
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+
+	cancelRequested bool
+}
+
+// Done returns true if the job has finished, successfully or not
+func (j *Job) Done() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCancelled
+}
+
+func (j *Job) snapshot() Job {
+	s := *j
+	if j.Progress != nil {
+		progress := *j.Progress
+		s.Progress = &progress
+	}
+	return s
+}
+
+// JobProgress reports the progress of a running job: bytes uploaded or
+// downloaded by the current operation (check, crvd), or keys checked (keys)
+type JobProgress struct {
+	Operation string `json:"operation"`
+	Completed int64  `json:"completed"`
+	Total     int64  `json:"total"`
+	Unit      string `json:"unit"`
+}
+
+// CheckJobResult is the result of a check job
+type CheckJobResult struct {
+	Object    string `json:"object"`
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+	// Verified is true if an expected digest was given and matched
+	Verified bool `json:"verified"`
+}
+
+// CrvdJobResult is the result of a crvd job
+type CrvdJobResult struct {
+	Object    string    `json:"object"`
+	Size      int64     `json:"size"`
+	Seed      int64     `json:"seed"`
+	Generator Generator `json:"generator"`
+}
+
+// KeysJobResult is the result of a keys job
+type KeysJobResult struct {
+	List     string           `json:"list"`
+	Count    int              `json:"count"`
+	Failures []KeysJobFailure `json:"failures"`
+}
+
+// KeysJobFailure records a key that failed in a keys job
+type KeysJobFailure struct {
+	Index int    `json:"index"`
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// ------------------------------------------------------------
+// JobServer type
+
+// The JobServer struct runs submitted jobs on a bounded pool of workers,
+// persisting the state of each job as a JSON file in a state directory, so
+// that jobs survive restarts: jobs queued or running when the server stops
+// are run again when it starts.
+type JobServer struct {
+	Dir      string
+	Workers  int
+	Resolver JobResolver
+
+	mux     sync.Mutex
+	jobs    map[string]*Job
+	pending []string
+	cancels map[string]context.CancelFunc
+	wake    chan struct{}
+}
+
+// NewJobServer creates a JobServer with the specified state directory,
+// number of workers, and resolver, loading any jobs saved in the directory
+func NewJobServer(dir string, workers int, resolver JobResolver) (*JobServer, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("invalid number of workers: %d", workers)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &JobServer{
+		Dir:      dir,
+		Workers:  workers,
+		Resolver: resolver,
+		jobs:     map[string]*Job{},
+		cancels:  map[string]context.CancelFunc{},
+		wake:     make(chan struct{}, 1),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run runs queued jobs until the context is cancelled. Jobs interrupted by
+// cancellation are left in the running state, to be restarted by the next
+// server loaded from the same directory.
+func (s *JobServer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Submit validates and queues the specified job request
+func (s *JobServer) Submit(req JobRequest) (Job, error) {
+	if err := req.validate(); err != nil {
+		return Job{}, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{ID: id, Request: req, State: JobQueued, Created: time.Now()}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if err = s.save(job); err != nil {
+		return Job{}, err
+	}
+	s.jobs[id] = job
+	s.enqueue(id)
+	return job.snapshot(), nil
+}
+
+// Job returns the job with the specified ID
+func (s *JobServer) Job(id string) (Job, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		return job.snapshot(), true
+	}
+	return Job{}, false
+}
+
+// Jobs returns all jobs, in order of creation
+func (s *JobServer) Jobs() []Job {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs
+}
+
+// Cancel cancels the job with the specified ID, if it has not yet finished
+func (s *JobServer) Cancel(id string) (Job, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("no such job: %v", id)
+	}
+	if job.Done() {
+		return job.snapshot(), fmt.Errorf("job %v already %v", id, job.State)
+	}
+	if cancel, running := s.cancels[id]; running {
+		// the worker records the cancellation when the job stops
+		job.cancelRequested = true
+		cancel()
+		delete(s.cancels, id)
+		return job.snapshot(), nil
+	}
+	for i, pendingID := range s.pending {
+		if pendingID == id {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	s.finish(job, nil, context.Canceled)
+	return job.snapshot(), nil
+}
+
+// ------------------------------------------------------------
+// Unexported methods
+
+func (s *JobServer) load() error {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.Dir, f.Name()))
+		if err != nil {
+			return err
+		}
+		job := &Job{}
+		if err = json.Unmarshal(data, job); err != nil {
+			return fmt.Errorf("error reading job file %v: %v", f.Name(), err)
+		}
+		s.jobs[job.ID] = job
+	}
+
+	var unfinished []*Job
+	for _, job := range s.jobs {
+		if !job.Done() {
+			unfinished = append(unfinished, job)
+		}
+	}
+	sort.Slice(unfinished, func(i, j int) bool { return unfinished[i].Created.Before(unfinished[j].Created) })
+	for _, job := range unfinished {
+		if job.State == JobRunning {
+			job.State = JobQueued
+			job.Started = nil
+			job.Restarts++
+			if err = s.save(job); err != nil {
+				return err
+			}
+		}
+		s.enqueue(job.ID)
+	}
+	return nil
+}
+
+// enqueue adds the specified job to the queue; the caller must hold the lock
+func (s *JobServer) enqueue(id string) {
+	s.pending = append(s.pending, id)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes the next job from the queue and marks it running, returning
+// false if the queue is empty
+func (s *JobServer) next(ctx context.Context) (*Job, context.Context, context.CancelFunc, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(s.pending) == 0 {
+		return nil, nil, nil, false
+	}
+	job := s.jobs[s.pending[0]]
+	s.pending = s.pending[1:]
+	if len(s.pending) > 0 {
+		// wake another worker
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	now := time.Now()
+	job.State = JobRunning
+	job.Started = &now
+	if err := s.save(job); err != nil {
+		logging.DefaultLogger().Infof("Error saving job %v: %v\n", job.ID, err)
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	s.cancels[job.ID] = cancel
+	return job, jobCtx, cancel, true
+}
+
+func (s *JobServer) work(ctx context.Context) {
+	logger := logging.DefaultLogger()
+	for ctx.Err() == nil {
+		job, jobCtx, cancel, ok := s.next(ctx)
+		if !ok {
+			select {
+			case <-s.wake:
+			case <-ctx.Done():
+			}
+			continue
+		}
+		logger.Detailf("Running job %v (%v %v)\n", job.ID, job.Request.Type, job.Request.URL)
+		result, err := s.run(jobCtx, job)
+		cancel()
+
+		s.mux.Lock()
+		delete(s.cancels, job.ID)
+		if ctx.Err() != nil {
+			// shutting down; leave the job to be restarted
+			s.mux.Unlock()
+			return
+		}
+		if job.cancelRequested {
+			err = context.Canceled
+		}
+		s.finish(job, result, err)
+		s.mux.Unlock()
+		logger.Detailf("Job %v %v\n", job.ID, job.State)
+	}
+}
+
+// finish records the result of the specified job; the caller must hold the
+// lock
+func (s *JobServer) finish(job *Job, result interface{}, err error) {
+	now := time.Now()
+	job.Finished = &now
+	if result != nil {
+		if data, jsonErr := json.Marshal(result); jsonErr == nil {
+			job.Result = data
+		}
+	}
+	switch {
+	case err == context.Canceled:
+		job.State = JobCancelled
+	case err != nil:
+		job.State = JobFailed
+		job.Error = logging.FormatError(err)
+	default:
+		job.State = JobSucceeded
+	}
+	if saveErr := s.save(job); saveErr != nil {
+		logging.DefaultLogger().Infof("Error saving job %v: %v\n", job.ID, saveErr)
+	}
+}
+
+func (s *JobServer) setProgress(job *Job, progress JobProgress) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	job.Progress = &progress
+}
+
+// save writes the specified job to the state directory; the caller must hold
+// the lock
+func (s *JobServer) save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.Dir, job.ID+".json")
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// run runs the specified job, returning its result (if any) and any error
+func (s *JobServer) run(ctx context.Context, job *Job) (interface{}, error) {
+	req := job.Request
+	if req.Type == JobKeys {
+		return s.runKeys(ctx, job, &req)
+	}
+	ctx = logging.WithProgressObserver(ctx, func(p logging.Progress) {
+		s.setProgress(job, JobProgress{Operation: p.Operation, Completed: p.TotalBytes, Total: p.ExpectedBytes, Unit: "bytes"})
+	})
+	if req.Type == JobCheck {
+		return s.runCheck(ctx, &req)
+	}
+	return s.runCrvd(ctx, &req)
+}
+
+func (s *JobServer) runCheck(ctx context.Context, req *JobRequest) (interface{}, error) {
+	obj, err := s.Resolver.Object(req)
+	if err != nil {
+		return nil, err
+	}
+	expected, _ := hex.DecodeString(req.Expected)
+	check := Check{Object: obj, Expected: expected, Algorithm: req.Algorithm}
+	if check.Algorithm == "" {
+		check.Algorithm = "sha256"
+	}
+	digest, err := check.VerifyDigest(ctx)
+	if digest == nil {
+		return nil, err
+	}
+	return CheckJobResult{
+		Object:    obj.Pretty(),
+		Algorithm: check.Algorithm,
+		Digest:    hex.EncodeToString(digest),
+		Verified:  err == nil && len(expected) > 0,
+	}, err
+}
+
+func (s *JobServer) runCrvd(ctx context.Context, req *JobRequest) (interface{}, error) {
+	target, err := s.Resolver.Target(req)
+	if err != nil {
+		return nil, err
+	}
+	size, generator := req.Size, req.generator()
+	if size == 0 {
+		size = DefaultContentLengthBytes
+	}
+	crvd, err := NewCrvdWithGenerator(target, req.Key, size, generator)
+	if err != nil {
+		return nil, err
+	}
+	if err = crvd.CreateRetrieveVerifyDelete(ctx); err != nil {
+		return nil, err
+	}
+	return CrvdJobResult{Object: crvd.Object.Pretty(), Size: size, Seed: generator.Seed, Generator: generator}, nil
+}
+
+func (s *JobServer) runKeys(ctx context.Context, job *Job, req *JobRequest) (interface{}, error) {
+	target, err := s.Resolver.Target(req)
+	if err != nil {
+		return nil, err
+	}
+	listName := req.List
+	if listName == "" {
+		listName = DefaultKeyListName
+	}
+	keyList, err := KeyListForName(listName)
+	if err == nil && req.Sample > 0 {
+		keyList, err = SamplingKeyList(keyList, req.Sample)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// count keys as they're written to the outputs, to report progress
+	total := int64(keyList.Count())
+	var checked int64
+	counter := &lineCounter{counted: func() {
+		s.setProgress(job, JobProgress{Operation: "keys", Completed: checked, Total: total, Unit: "keys"})
+	}, count: &checked}
+
+	k := NewKeys(target, keyList)
+	failures, err := k.CheckAll(ctx, counter, counter, true)
+	if err != nil {
+		return nil, err
+	}
+	result := KeysJobResult{List: keyList.Name(), Count: keyList.Count(), Failures: []KeysJobFailure{}}
+	for _, f := range failures {
+		result.Failures = append(result.Failures, KeysJobFailure{Index: f.Index, Key: f.Key, Error: logging.FormatError(f.Error)})
+	}
+	if len(failures) > 0 {
+		return result, fmt.Errorf("%v: %d of %d keys failed", keyList.Name(), len(failures), keyList.Count())
+	}
+	return result, nil
+}
+
+// ------------------------------------------------------------
+// Unexported types and functions
+
+// lineCounter is an io.Writer counting lines written
+type lineCounter struct {
+	count   *int64
+	counted func()
+}
+
+func (w *lineCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			*w.count++
+			w.counted()
+		}
+	}
+	return len(p), nil
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// DefaultProgressInterval is the default interval between progress updates
+// streamed by the job server
+const DefaultProgressInterval = time.Second
+
+// Handler returns an HTTP handler providing a REST API for the job server:
+//
+//	POST   /jobs                 submit a job (a JobRequest), returning the Job
+//	GET    /jobs                 list all jobs
+//	GET    /jobs/{id}            get a job
+//	DELETE /jobs/{id}            cancel a job
+//	GET    /jobs/{id}/progress   stream the job as newline-delimited JSON,
+//	                             whenever it changes, until it finishes
+func (s *JobServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.handleSubmit)
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Jobs())
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := s.Job(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, "no such job: "+r.PathValue("id"))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("DELETE /jobs/{id}", s.handleCancel)
+	mux.HandleFunc("GET /jobs/{id}/progress", s.handleProgress)
+	return mux
+}
+
+func (s *JobServer) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job request: "+err.Error())
+		return
+	}
+	job, err := s.Submit(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *JobServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.Job(id); !ok {
+		writeError(w, http.StatusNotFound, "no such job: "+id)
+		return
+	}
+	job, err := s.Cancel(id)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *JobServer) handleProgress(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	job, ok := s.Job(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job: "+id)
+		return
+	}
+	interval := DefaultProgressInterval
+	if intervalStr := r.URL.Query().Get("interval"); intervalStr != "" {
+		var err error
+		if interval, err = time.ParseDuration(intervalStr); err != nil || interval <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid interval: "+intervalStr)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *Job
+	for {
+		if last == nil || !reflect.DeepEqual(*last, job) {
+			if err := encoder.Encode(job); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			current := job
+			last = &current
+		}
+		if job.Done() {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+		job, _ = s.Job(id)
+	}
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
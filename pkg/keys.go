@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -22,7 +23,7 @@ func NewKeys(target Target, keyList KeyList) Keys {
 	}
 }
 
-func (k *Keys) CheckAll(okOut io.Writer, badOut io.Writer, raw bool) ([]KeyResult, error) {
+func (k *Keys) CheckAll(ctx context.Context, okOut io.Writer, badOut io.Writer, raw bool) ([]KeyResult, error) {
 	if okOutC, ok := okOut.(io.WriteCloser); ok {
 		//noinspection GoUnhandledErrorResult
 		defer okOutC.Close()
@@ -36,16 +37,22 @@ func (k *Keys) CheckAll(okOut io.Writer, badOut io.Writer, raw bool) ([]KeyResul
 
 	var failures []KeyResult
 	for index, key := range k.KeyList.Keys() {
-		err := k.Check(key)
+		if err := ctx.Err(); err != nil {
+			// cancelled, or overall timeout expired
+			return failures, err
+		}
+		attempts := &AttemptLog{}
+		err := k.Check(WithAttemptLog(ctx, attempts), key)
 		if err != nil && strings.Contains(err.Error(), "no such host") {
 			// network problem, or we ran out of file handles
 			return nil, err
 		}
 		result := &KeyResult{
-			List:  k.KeyList,
-			Index: index,
-			Key:   key,
-			Error: err,
+			List:     k.KeyList,
+			Index:    index,
+			Key:      key,
+			Error:    err,
+			Attempts: attempts.Attempts(),
 		}
 		logger.Detailf(result.Pretty())
 
@@ -65,9 +72,9 @@ func (k *Keys) CheckAll(okOut io.Writer, badOut io.Writer, raw bool) ([]KeyResul
 	return failures, nil
 }
 
-func (k *Keys) Check(key string) (err error) {
+func (k *Keys) Check(ctx context.Context, key string) (err error) {
 	crvd := NewDefaultCrvd(k.Endpoint, key)
-	return crvd.CreateRetrieveVerifyDelete()
+	return crvd.CreateRetrieveVerifyDelete(ctx)
 }
 
 func writeKey(w io.Writer, key string, raw bool) (err error) {
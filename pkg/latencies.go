@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// Latencies type
+
+// Latencies records the latencies, sizes, and outcomes of a series of
+// operations, for reporting throughput and latency percentiles. It is safe for
+// concurrent use.
+type Latencies struct {
+	mux       sync.Mutex
+	durations []time.Duration
+	bytes     int64
+	errors    int
+}
+
+// Record records an operation that took the specified time and transferred
+// the specified number of bytes. Failed operations are counted, but their
+// latencies and bytes are not included in the summary.
+func (l *Latencies) Record(elapsed time.Duration, bytes int64, err error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if err != nil {
+		l.errors++
+		return
+	}
+	l.durations = append(l.durations, elapsed)
+	l.bytes += bytes
+}
+
+// Summary summarizes the operations recorded so far, computing throughput
+// over the specified elapsed time.
+func (l *Latencies) Summary(elapsed time.Duration) LatencySummary {
+	l.mux.Lock()
+	durations := append([]time.Duration(nil), l.durations...)
+	summary := LatencySummary{Count: len(l.durations), Errors: l.errors, Bytes: l.bytes}
+	l.mux.Unlock()
+
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		summary.OpsPerSecond = float64(summary.Count) / seconds
+		summary.MBPerSecond = float64(summary.Bytes) / 1e6 / seconds
+	}
+	if len(durations) == 0 {
+		return summary
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	summary.P50 = millis(percentile(durations, 50))
+	summary.P90 = millis(percentile(durations, 90))
+	summary.P99 = millis(percentile(durations, 99))
+	summary.Max = millis(durations[len(durations)-1])
+	return summary
+}
+
+// Histogram counts the latencies of the successful operations recorded so
+// far, in buckets with the specified (ascending) upper bounds. The last bucket
+// counts all latencies above the last bound.
+func (l *Latencies) Histogram(bounds []time.Duration) []HistogramBucket {
+	buckets := make([]HistogramBucket, len(bounds)+1)
+	for i, bound := range bounds {
+		buckets[i].UpperBound = millis(bound)
+	}
+	buckets[len(bounds)].UpperBound = math.Inf(1)
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for _, d := range l.durations {
+		i := sort.Search(len(bounds), func(i int) bool { return d <= bounds[i] })
+		buckets[i].Count++
+	}
+	return buckets
+}
+
+// Reset discards the operations recorded so far
+func (l *Latencies) Reset() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.durations = nil
+	l.bytes = 0
+	l.errors = 0
+}
+
+// ------------------------------------------------------------
+// LatencySummary type
+
+// LatencySummary summarizes the operations recorded by a Latencies. Latency
+// percentiles are given in milliseconds, and throughput in (decimal)
+// megabytes per second.
+type LatencySummary struct {
+	Count        int     `json:"count"`
+	Errors       int     `json:"errors"`
+	Bytes        int64   `json:"bytes"`
+	OpsPerSecond float64 `json:"ops_per_second"`
+	MBPerSecond  float64 `json:"mb_per_second"`
+	P50          float64 `json:"p50_ms"`
+	P90          float64 `json:"p90_ms"`
+	P99          float64 `json:"p99_ms"`
+	Max          float64 `json:"max_ms"`
+}
+
+// ------------------------------------------------------------
+// HistogramBucket type
+
+// DefaultHistogramBounds are the default upper bounds for latency histograms
+var DefaultHistogramBounds = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// HistogramBucket counts the latencies at or below an upper bound (in
+// milliseconds), and above the previous bucket's bound
+type HistogramBucket struct {
+	UpperBound float64 `json:"le_ms"`
+	Count      int     `json:"count"`
+}
+
+// MarshalJSON encodes the bucket, representing an infinite upper bound as
+// "+Inf" (as JSON has no infinite numbers)
+func (b HistogramBucket) MarshalJSON() ([]byte, error) {
+	if math.IsInf(b.UpperBound, 1) {
+		return []byte(fmt.Sprintf(`{"le_ms":"+Inf","count":%d}`, b.Count)), nil
+	}
+	type bucket HistogramBucket
+	return json.Marshal(bucket(b))
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// percentile returns the nearest-rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The ManifestEntry struct describes one object listed in a manifest file
+type ManifestEntry struct {
+	// Key is the object key, relative to the bucket or prefix
+	Key string
+	// Size is the expected size in bytes, or -1 if not specified
+	Size int64
+	// Digest is the expected MD5 or SHA-256 digest, or nil if not specified
+	Digest []byte
+}
+
+// ReadManifest reads a manifest file, consisting of one object per line, in
+// the form
+//
+//	KEY [SIZE [DIGEST]]
+//
+// with fields separated by tabs, and the digest (MD5 or SHA-256) given in hex.
+// Blank lines and lines beginning with '#' are ignored.
+func ReadManifest(path string) ([]ManifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseManifestLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v, line %d: %v", path, lineNum, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func parseManifestLine(line string) (ManifestEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) > 3 {
+		return ManifestEntry{}, fmt.Errorf("expected at most 3 fields, got %d", len(fields))
+	}
+	entry := ManifestEntry{Key: fields[0], Size: -1}
+	if len(fields) > 1 && fields[1] != "" {
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return entry, fmt.Errorf("invalid size: %#v", fields[1])
+		}
+		entry.Size = size
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		digest, err := hex.DecodeString(fields[2])
+		if err != nil || (len(digest) != 16 && len(digest) != 32) {
+			return entry, fmt.Errorf("invalid MD5 or SHA-256 digest: %#v", fields[2])
+		}
+		entry.Digest = digest
+	}
+	return entry, nil
+}
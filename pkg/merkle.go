@@ -0,0 +1,171 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+)
+
+// SidecarSuffix is appended to an object's URL to give the URL of its
+// sidecar block manifest
+const SidecarSuffix = ".blocks.json"
+
+// ------------------------------------------------------------
+// Merkle trees
+
+// MerkleTree returns the levels of the hash tree over the specified block
+// digests, from the leaves (the block digests themselves) up to the root.
+// Each interior node is the digest of a 0x01 byte followed by its two
+// children; a node without a sibling is promoted to the next level
+// unchanged.
+func MerkleTree(algorithm string, leaves [][]byte) ([][][]byte, error) {
+	if _, err := NewHash(algorithm); err != nil {
+		return nil, err
+	}
+	if len(leaves) == 0 {
+		h, _ := NewHash(algorithm)
+		return [][][]byte{{h.Sum(nil)}}, nil
+	}
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h, _ := NewHash(algorithm)
+			_, _ = h.Write([]byte{1})
+			_, _ = h.Write(level[i])
+			_, _ = h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels, nil
+}
+
+// Tree returns the levels of the manifest's hash tree (see MerkleTree)
+func (m *BlockManifest) Tree() ([][][]byte, error) {
+	leaves := make([][]byte, len(m.Blocks))
+	for i, b := range m.Blocks {
+		leaf, err := hex.DecodeString(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest for block %d: %#v", i, b)
+		}
+		leaves[i] = leaf
+	}
+	return MerkleTree(m.Algorithm, leaves)
+}
+
+// Compare compares the manifest (of the expected content) with another
+// manifest of the same object (of the actual content), with the same block
+// size and algorithm, descending the hash trees from their roots to find the
+// blocks that differ. It returns the differing byte ranges of the object,
+// with adjacent blocks merged into a single range. If the actual object is
+// shorter or longer than expected, the missing or extra bytes are included
+// in the last range.
+func (m *BlockManifest) Compare(actual *BlockManifest) ([]ByteRange, error) {
+	if m.BlockSize != actual.BlockSize || m.Algorithm != actual.Algorithm {
+		return nil, fmt.Errorf(
+			"can't compare manifests with different block sizes or algorithms: %d (%v) vs. %d (%v)",
+			m.BlockSize, m.Algorithm, actual.BlockSize, actual.Algorithm,
+		)
+	}
+	expectedTree, err := m.Tree()
+	if err != nil {
+		return nil, err
+	}
+	actualTree, err := actual.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []int
+	if len(m.Blocks) == len(actual.Blocks) {
+		blocks = diffTrees(expectedTree, actualTree, len(expectedTree)-1, 0)
+	} else {
+		// the trees have different shapes; compare the leaves directly
+		for i := range m.Blocks {
+			if i >= len(actual.Blocks) || m.Blocks[i] != actual.Blocks[i] {
+				blocks = append(blocks, i)
+			}
+		}
+	}
+
+	var ranges []ByteRange
+	for _, block := range blocks {
+		start, end := m.BlockRange(block)
+		if n := len(ranges); n > 0 && ranges[n-1].End+1 == start {
+			ranges[n-1].End = end
+		} else {
+			ranges = append(ranges, ByteRange{Start: start, End: end})
+		}
+	}
+	if actual.Size != m.Size {
+		// truncated or extended
+		start, end := m.Size, actual.Size-1
+		if actual.Size < m.Size {
+			start, end = actual.Size, m.Size-1
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].End+1 >= start {
+			if end > ranges[n-1].End {
+				ranges[n-1].End = end
+			}
+		} else {
+			ranges = append(ranges, ByteRange{Start: start, End: end})
+		}
+	}
+	return ranges, nil
+}
+
+// ------------------------------------------------------------
+// Sidecar manifests
+
+// DownloadBlockManifest reads a block manifest stored as an object, e.g. as a
+// sidecar (see SidecarSuffix)
+func DownloadBlockManifest(ctx context.Context, obj Object) (*BlockManifest, error) {
+	var buf bytes.Buffer
+	if _, err := Download(ctx, obj, DefaultRangeSize, &buf); err != nil {
+		return nil, err
+	}
+	return ParseBlockManifest(buf.Bytes(), obj.Pretty())
+}
+
+// Upload stores the manifest, as JSON, as the specified object, e.g. as a
+// sidecar (see SidecarSuffix)
+func (m *BlockManifest) Upload(ctx context.Context, obj Object) error {
+	data, err := m.JSON()
+	if err != nil {
+		return err
+	}
+	return obj.Create(ctx, bytes.NewReader(data), int64(len(data)))
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// diffTrees returns the indices of the leaves under the specified node that
+// differ between two trees of the same shape
+func diffTrees(expected, actual [][][]byte, level, index int) []int {
+	if bytes.Equal(expected[level][index], actual[level][index]) {
+		return nil
+	}
+	if level == 0 {
+		return []int{index}
+	}
+	below := expected[level-1]
+	if 2*index+1 >= len(below) {
+		// promoted without a sibling
+		return diffTrees(expected, actual, level-1, 2*index)
+	}
+	return append(
+		diffTrees(expected, actual, level-1, 2*index),
+		diffTrees(expected, actual, level-1, 2*index+1)...,
+	)
+}
@@ -0,0 +1,311 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+	"github.com/dmolesUC3/cos/internal/metrics"
+)
+
+// Probe types
+const (
+	ProbeCrvd  = "crvd"
+	ProbeCheck = "check"
+)
+
+const (
+	// DefaultProbeInterval is the default time between runs of a probe
+	DefaultProbeInterval = 5 * time.Minute
+	// DefaultUnhealthyAfter is the default number of probe intervals without
+	// a success after which a probe is considered unhealthy
+	DefaultUnhealthyAfter = 3
+)
+
+// ------------------------------------------------------------
+// Probe type
+
+// The Probe struct represents a storage operation run periodically by a
+// Monitor: either a create-retrieve-verify-delete cycle (see Crvd) against a
+// target, or a fixity check (see Check) of an existing object.
+type Probe struct {
+	Name string
+	// Type is ProbeCrvd or ProbeCheck
+	Type string
+	// Target is the target for crvd probes
+	Target Target
+	// Size is the object size for crvd probes
+	Size int64
+	// Object is the object for check probes
+	Object Object
+	// Algorithm and Expected are the digest algorithm and (optional) expected
+	// digest for check probes
+	Algorithm string
+	Expected  []byte
+	// Interval is the time between runs of the probe
+	Interval time.Duration
+	// Timeout is the timeout for each run of the probe (default Interval)
+	Timeout time.Duration
+}
+
+func (p *Probe) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("probe has no name")
+	}
+	if p.Interval <= 0 {
+		return fmt.Errorf("probe %#v: invalid interval: %v", p.Name, p.Interval)
+	}
+	switch p.Type {
+	case ProbeCrvd:
+		if p.Target == nil {
+			return fmt.Errorf("probe %#v: no target", p.Name)
+		}
+		if p.Size < 0 {
+			return fmt.Errorf("probe %#v: invalid size: %d", p.Name, p.Size)
+		}
+	case ProbeCheck:
+		if p.Object == nil {
+			return fmt.Errorf("probe %#v: no object", p.Name)
+		}
+	default:
+		return fmt.Errorf("probe %#v: unsupported probe type: %#v (expected %v or %v)", p.Name, p.Type, ProbeCrvd, ProbeCheck)
+	}
+	return nil
+}
+
+// ProbeStatus reports the state of a probe, for health checks
+type ProbeStatus struct {
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Healthy     bool       `json:"healthy"`
+	Runs        int        `json:"runs"`
+	Failures    int        `json:"failures"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// ------------------------------------------------------------
+// Monitor type
+
+// The Monitor struct runs a set of probes on their schedules, recording the
+// results as Prometheus metrics, and serving those metrics along with health
+// endpoints over HTTP.
+type Monitor struct {
+	Probes []*Probe
+	// UnhealthyAfter is the number of intervals after which a probe that has
+	// not succeeded is considered unhealthy
+	UnhealthyAfter int
+	// Metrics holds the probe and operation metrics
+	Metrics *metrics.Registry
+
+	runs        *metrics.Counter
+	duration    *metrics.Histogram
+	bytes       *metrics.Counter
+	lastSuccess *metrics.Gauge
+	lastRun     *metrics.Gauge
+	up          *metrics.Gauge
+	opDuration  *metrics.Histogram
+	opRetries   *metrics.Counter
+	opFailures  *metrics.Counter
+
+	started time.Time
+	mux     sync.Mutex
+	status  map[string]*ProbeStatus
+}
+
+// NewMonitor creates a new Monitor for the specified probes
+func NewMonitor(probes []*Probe) (*Monitor, error) {
+	names := map[string]bool{}
+	for _, p := range probes {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate probe name: %#v", p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	r := metrics.NewRegistry()
+	m := &Monitor{
+		Probes:         probes,
+		UnhealthyAfter: DefaultUnhealthyAfter,
+		Metrics:        r,
+
+		runs:        r.Counter("cos_probe_runs_total", "Probe runs, by result (success or failure).", "probe", "type", "result"),
+		duration:    r.Histogram("cos_probe_duration_seconds", "Duration of probe runs.", metrics.DefaultBuckets, "probe", "type"),
+		bytes:       r.Counter("cos_probe_bytes_total", "Bytes transferred by successful probe runs, by direction (upload or download).", "probe", "type", "direction"),
+		lastSuccess: r.Gauge("cos_probe_last_success_timestamp_seconds", "Time of the last successful probe run, in seconds since the Unix epoch.", "probe", "type"),
+		lastRun:     r.Gauge("cos_probe_last_run_timestamp_seconds", "Time of the last probe run, in seconds since the Unix epoch.", "probe", "type"),
+		up:          r.Gauge("cos_probe_up", "Whether the last probe run succeeded (1) or failed (0).", "probe", "type"),
+		opDuration:  r.Histogram("cos_operation_duration_seconds", "Duration of individual storage requests made by probes, by operation (e.g. PutObject, GetObject).", metrics.DefaultBuckets, "probe", "operation"),
+		opRetries:   r.Counter("cos_operation_retries_total", "Storage requests made by probes that were retries of failed requests.", "probe", "operation"),
+		opFailures:  r.Counter("cos_operation_failures_total", "Storage requests made by probes that failed (whether or not retried).", "probe", "operation"),
+
+		started: time.Now(),
+		status:  map[string]*ProbeStatus{},
+	}
+	for _, p := range probes {
+		m.status[p.Name] = &ProbeStatus{Name: p.Name, Type: p.Type}
+		// initialize counters, so that rates can be calculated from the start
+		m.runs.Add(0, p.Name, p.Type, "success")
+		m.runs.Add(0, p.Name, p.Type, "failure")
+	}
+	return m, nil
+}
+
+// Run runs each probe immediately, and then once per interval, until the
+// context is cancelled
+func (m *Monitor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range m.Probes {
+		wg.Add(1)
+		go func(p *Probe) {
+			defer wg.Done()
+			ticker := time.NewTicker(p.Interval)
+			defer ticker.Stop()
+			for {
+				_ = m.RunProbe(ctx, p)
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// RunProbe runs the specified probe once, recording the results
+func (m *Monitor) RunProbe(ctx context.Context, p *Probe) error {
+	logger := logging.DefaultLogger()
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = p.Interval
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	attempts := &AttemptLog{}
+	runCtx = WithAttemptLog(runCtx, attempts)
+
+	start := time.Now()
+	uploaded, downloaded, err := p.run(runCtx)
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		// shutting down; don't record interrupted runs
+		return ctx.Err()
+	}
+
+	for _, a := range attempts.Attempts() {
+		m.opDuration.Observe(a.Elapsed.Seconds(), p.Name, a.Operation)
+		if a.Number > 1 {
+			m.opRetries.Inc(p.Name, a.Operation)
+		}
+		if a.Err != nil {
+			m.opFailures.Inc(p.Name, a.Operation)
+		}
+	}
+	now := time.Now()
+	m.duration.Observe(elapsed.Seconds(), p.Name, p.Type)
+	m.lastRun.Set(float64(now.Unix()), p.Name, p.Type)
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	status := m.status[p.Name]
+	status.Runs++
+	status.LastRun = &now
+	if err != nil {
+		logger.Infof("Probe %v failed after %v: %v\n", p.Name, elapsed, logging.FormatError(err))
+		m.runs.Inc(p.Name, p.Type, "failure")
+		m.up.Set(0, p.Name, p.Type)
+		status.Failures++
+		status.LastError = logging.FormatError(err)
+		return err
+	}
+	logger.Detailf("Probe %v succeeded in %v\n", p.Name, elapsed)
+	m.runs.Inc(p.Name, p.Type, "success")
+	m.up.Set(1, p.Name, p.Type)
+	m.lastSuccess.Set(float64(now.Unix()), p.Name, p.Type)
+	m.bytes.Add(float64(uploaded), p.Name, p.Type, "upload")
+	m.bytes.Add(float64(downloaded), p.Name, p.Type, "download")
+	status.LastSuccess = &now
+	status.LastError = ""
+	return nil
+}
+
+// Status returns the status of each probe, sorted by name
+func (m *Monitor) Status() []ProbeStatus {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	now := time.Now()
+	var statuses []ProbeStatus
+	for _, p := range m.Probes {
+		status := *m.status[p.Name]
+		since := m.started
+		if status.LastSuccess != nil {
+			since = *status.LastSuccess
+		}
+		status.Healthy = now.Sub(since) <= time.Duration(m.UnhealthyAfter)*p.Interval
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Handler returns an HTTP handler serving the metrics at /metrics, the
+// probe status at /healthz (with status 503 if any probe is unhealthy), and
+// a liveness check at /livez
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Metrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		statuses := m.Status()
+		healthy := true
+		for _, s := range statuses {
+			healthy = healthy && s.Healthy
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"healthy": healthy, "probes": statuses})
+	})
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// run runs the probe, returning the number of bytes uploaded and downloaded
+func (p *Probe) run(ctx context.Context) (uploaded int64, downloaded int64, err error) {
+	if p.Type == ProbeCheck {
+		contentLength, err := p.Object.ContentLength(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		check := Check{Object: p.Object, Expected: p.Expected, Algorithm: p.Algorithm}
+		if _, err = check.VerifyDigest(ctx); err != nil {
+			return 0, 0, err
+		}
+		return 0, contentLength, nil
+	}
+	key := fmt.Sprintf("cos-monitor-%v-%d.bin", p.Name, time.Now().UnixNano())
+	crvd := NewCrvd(p.Target, key, p.Size, time.Now().UnixNano())
+	if err = crvd.CreateRetrieveVerifyDelete(ctx); err != nil {
+		return 0, 0, err
+	}
+	return p.Size, p.Size, nil
+}
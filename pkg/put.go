@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// Verification modes for uploads
+const (
+	// VerifyDownload re-downloads the object and compares its SHA-256 digest
+	VerifyDownload = "download"
+	// VerifyETag compares the ETag(s) reported by the server with the MD5
+	// digest(s) computed on upload
+	VerifyETag = "etag"
+	// VerifyNone skips verification, beyond checking the content length
+	VerifyNone = "none"
+)
+
+// VerifyModes lists the supported verification modes
+var VerifyModes = []string{VerifyDownload, VerifyETag, VerifyNone}
+
+// ValidVerifyMode returns an error if the specified verification mode is not
+// one of the supported VerifyModes
+func ValidVerifyMode(mode string) error {
+	for _, m := range VerifyModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported verification mode: %#v (expected one of %v)", mode, VerifyModes)
+}
+
+// The Put struct represents an upload of a local file
+type Put struct {
+	Object Object
+	Path   string
+	// Verify is the verification mode. Note that VerifyETag relies on the
+	// object's target having been created with ETag verification enabled.
+	Verify string
+	// Metadata, if not nil, is the metadata (headers, user metadata, and
+	// tags) to create the object with
+	Metadata *Metadata
+}
+
+// UploadAndVerify uploads the file, computing its digests along the way,
+// verifies the upload, and returns a receipt.
+func (p *Put) UploadAndVerify(ctx context.Context) (*Receipt, error) {
+	if err := ValidVerifyMode(p.Verify); err != nil {
+		return nil, err
+	}
+	obj := p.Object
+	logger := logging.DefaultLogger()
+	started := time.Now()
+
+	file, err := os.Open(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Tracef("Error closing %v: %v\n", p.Path, err)
+		}
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %v", p.Path)
+	}
+	contentLength := info.Size()
+
+	sha256Digest := sha256.New()
+	md5Digest := md5.New()
+	progress := logging.NewProgressWriter(io.MultiWriter(sha256Digest, md5Digest), contentLength)
+	progress.LogTo(logger, 2*time.Second)
+	progress.ObserveFrom(ctx, "upload")
+	defer progress.Stop()
+	// the body is seekable, so that a single PUT can send the file in place
+	in := NewTeeReadSeeker(io.NewSectionReader(file, 0, contentLength), progress)
+
+	logger.Detailf("Uploading %v (%v) to %v\n", p.Path, logging.FormatBytes(contentLength), obj)
+	if err = createWithMetadata(ctx, obj, in, contentLength, p.Metadata); err != nil {
+		return nil, err
+	}
+	if progress.TotalBytes() != contentLength {
+		return nil, fmt.Errorf("file size changed during upload: expected %d bytes, read %d", contentLength, progress.TotalBytes())
+	}
+	expectedDigest := sha256Digest.Sum(nil)
+
+	actualLength, err := obj.ContentLength(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine content-length after upload: %v", err)
+	}
+	if actualLength != contentLength {
+		return nil, fmt.Errorf("content-length mismatch: expected: %d, actual: %d", contentLength, actualLength)
+	}
+
+	switch p.Verify {
+	case VerifyDownload:
+		logger.Detailf("Verifying %v (expected digest: %x)\n", obj, expectedDigest)
+		actualDigest, err := CalcDigest(ctx, obj, DefaultRangeSize, "sha256")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(expectedDigest, actualDigest) {
+			return nil, fmt.Errorf("digest mismatch:\nexpected:\n%x\nactual: %x", expectedDigest, actualDigest)
+		}
+	}
+
+	return &Receipt{
+		Object: obj.Pretty(),
+		Source: p.Path,
+		Size:   contentLength,
+		Digests: map[string]string{
+			"md5":    fmt.Sprintf("%x", md5Digest.Sum(nil)),
+			"sha256": fmt.Sprintf("%x", expectedDigest),
+		},
+		Verification:   p.Verify,
+		Started:        started,
+		ElapsedSeconds: time.Since(started).Seconds(),
+	}, nil
+}
@@ -0,0 +1,133 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// The Receipt struct records the result of a verified transfer
+type Receipt struct {
+	// Object is the URL of the object
+	Object string `json:"object"`
+	// Source is the local file or object the object was copied from, if any
+	Source string `json:"source,omitempty"`
+	// Destination is the local file the object was downloaded to, if any
+	Destination string `json:"destination,omitempty"`
+	// Size is the object size in bytes
+	Size int64 `json:"size"`
+	// Digests maps digest algorithms to hex digest values
+	Digests map[string]string `json:"digests"`
+	// Verification describes how the transfer was verified
+	Verification string `json:"verification"`
+	// Started is the time the transfer started
+	Started time.Time `json:"started"`
+	// ElapsedSeconds is the time taken by the transfer and verification
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// Generator is the generator of the object's content, for objects created
+	// by crvd
+	Generator *Generator `json:"generator,omitempty"`
+}
+
+// ReadReceipt reads a receipt written by WriteTo from the file at the
+// specified path
+func ReadReceipt(path string) (*Receipt, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Receipt
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid receipt %v: %v", path, err)
+	}
+	return &r, nil
+}
+
+// WriteTo writes the receipt as JSON to the file at the specified path, or to
+// standard output if the path is "-".
+func (r *Receipt) WriteTo(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing receipt to %v: %v", path, err)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// ReceiptLog type
+
+// ReceiptLog is an append-only log of receipts, written as one JSON object
+// per line, for recording the progress of bulk operations. It is safe for
+// concurrent use.
+type ReceiptLog struct {
+	mux  sync.Mutex
+	file *os.File
+}
+
+// OpenReceiptLog opens the receipt log at the specified path for appending,
+// creating it if it does not exist.
+func OpenReceiptLog(path string) (*ReceiptLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &ReceiptLog{file: file}, nil
+}
+
+// Append writes the receipt to the log
+func (l *ReceiptLog) Append(r *Receipt) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the log
+func (l *ReceiptLog) Close() error {
+	return l.file.Close()
+}
+
+// ReadReceiptLog reads the receipts from the log at the specified path,
+// returning no receipts if the file does not exist. An incomplete final line
+// (e.g. from an interrupted write) is ignored.
+func ReadReceiptLog(path string) ([]Receipt, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var receipts []Receipt
+	lines := bytes.Split(data, []byte{'\n'})
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var r Receipt
+		if err := json.Unmarshal(line, &r); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("%v, line %d: %v", path, i+1, err)
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, nil
+}
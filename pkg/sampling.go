@@ -0,0 +1,357 @@
+package pkg
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/keys"
+	. "github.com/dmolesUC3/cos/internal/objects"
+	. "github.com/dmolesUC3/cos/internal/streaming"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+const (
+	// DefaultSampleConfidence is the default confidence level for sampling
+	// audits
+	DefaultSampleConfidence = 0.95
+	// DefaultSampleErrorRate is the default tolerable error (corruption) rate
+	// for sampling audits
+	DefaultSampleErrorRate = 0.01
+)
+
+// ------------------------------------------------------------
+// SampleResult and SampleReport types
+
+// The SampleResult struct records the check of one sampled object
+type SampleResult struct {
+	Key string `json:"key"`
+	// Status is AuditOK, AuditChanged, AuditMissing, or AuditError
+	Status string `json:"status"`
+	Size   int64  `json:"size"`
+	// Digest is the calculated digest, in hex, if the object could be read
+	Digest string `json:"digest,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// The SampleReport struct records the result of a SampleAudit, with the
+// estimated failure (corruption) rate of the whole population
+type SampleReport struct {
+	Population int     `json:"population"`
+	SampleSize int     `json:"sample_size"`
+	Seed       int64   `json:"seed"`
+	Confidence float64 `json:"confidence"`
+	// ErrorRate is the tolerable error rate used to size the sample, if the
+	// sample size was not given explicitly
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	Checked   int     `json:"checked"`
+	Failed    int     `json:"failed"`
+	// FailureRate is the observed failure rate in the sample, i.e. the point
+	// estimate of the failure rate of the population
+	FailureRate float64 `json:"failure_rate"`
+	// EstimatedFailures is the failure rate applied to the population
+	EstimatedFailures float64 `json:"estimated_failures"`
+	// IntervalLower and IntervalUpper are the bounds of the two-sided
+	// (Clopper-Pearson) confidence interval for the failure rate
+	IntervalLower float64 `json:"interval_lower"`
+	IntervalUpper float64 `json:"interval_upper"`
+	// UpperBound is the one-sided upper confidence bound for the failure
+	// rate: with the given confidence, the failure rate is no higher
+	UpperBound float64        `json:"upper_bound"`
+	Failures   []SampleResult `json:"failures"`
+	Elapsed    time.Duration  `json:"elapsed"`
+}
+
+// ------------------------------------------------------------
+// SampleAudit type
+
+// The SampleAudit struct represents a statistical fixity audit: it checks a
+// random sample of the objects under a prefix (or listed in a manifest), and
+// estimates the failure rate of the whole collection from the failures found
+// in the sample.
+type SampleAudit struct {
+	Target Target
+	Prefix string
+	// Manifest, if not nil, lists the population, with expected sizes and
+	// digests, in place of a listing of the prefix
+	Manifest []ManifestEntry
+	// Confidence is the confidence level (e.g. 0.95) for the sample size and
+	// the reported confidence bounds
+	Confidence float64
+	// ErrorRate is the tolerable error rate (e.g. 0.01) for sizing the sample:
+	// the sample is large enough that, if at least this fraction of the
+	// population has failed, at least one failure will be found with the
+	// specified confidence
+	ErrorRate float64
+	// SampleSize, if > 0, is the sample size, in place of one calculated from
+	// the confidence level and error rate
+	SampleSize int
+	// Seed is the random seed used to choose the sample; the same seed and
+	// population always produce the same sample
+	Seed int64
+	// Concurrency is the number of objects to check at once
+	Concurrency int
+	// Report, if set, is called with each result as it completes
+	Report func(result SampleResult)
+}
+
+// Run chooses the sample, checks each object in it, and reports the results.
+// Failed checks are counted in the report, but do not cause Run to return an
+// error.
+func (s *SampleAudit) Run(ctx context.Context) (*SampleReport, error) {
+	start := time.Now()
+	population, err := s.population(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &SampleReport{Population: len(population), Seed: s.Seed, Confidence: s.Confidence}
+	defer func() {
+		report.Elapsed = time.Since(start)
+	}()
+
+	if report.SampleSize = s.SampleSize; report.SampleSize <= 0 {
+		report.ErrorRate = s.ErrorRate
+		if report.SampleSize, err = DiscoverySampleSize(len(population), s.Confidence, s.ErrorRate); err != nil {
+			return nil, err
+		}
+	} else if report.SampleSize > len(population) {
+		return nil, fmt.Errorf("sample size %d is larger than population %d", report.SampleSize, len(population))
+	}
+
+	keys := make([]string, len(population))
+	entries := map[string]ManifestEntry{}
+	for i, e := range population {
+		keys[i] = e.Key
+		entries[e.Key] = e
+	}
+	sample, err := SeededSamplingKeyList(NewKeyList(s.Prefix, s.Prefix, keys), report.SampleSize, s.Seed)
+	if err != nil {
+		return nil, err
+	}
+	logging.DefaultLogger().Detailf(
+		"Checking %d of %d objects (seed %d)\n", report.SampleSize, report.Population, s.Seed,
+	)
+
+	results := s.checkAll(ctx, sample.Keys(), entries)
+	for _, r := range results {
+		report.Checked++
+		if r.Status != AuditOK {
+			report.Failures = append(report.Failures, r)
+		}
+	}
+	sort.Slice(report.Failures, func(i, j int) bool { return report.Failures[i].Key < report.Failures[j].Key })
+	report.Failed = len(report.Failures)
+	if report.Checked > 0 {
+		report.FailureRate = float64(report.Failed) / float64(report.Checked)
+		report.EstimatedFailures = report.FailureRate * float64(report.Population)
+		report.IntervalLower, report.IntervalUpper = ClopperPearsonInterval(report.Failed, report.Checked, s.Confidence)
+		report.UpperBound = UpperConfidenceBound(report.Failed, report.Checked, s.Confidence)
+	}
+	return report, ctx.Err()
+}
+
+// ------------------------------------------------------------
+// Exported functions
+
+// DiscoverySampleSize returns the smallest sample size such that, if at least
+// the specified fraction (errorRate) of a population of the specified size
+// has failed, a random sample (without replacement) will contain at least one
+// failure with the specified confidence, i.e. the smallest n for which the
+// hypergeometric probability of a sample with no failures is at most
+// 1 - confidence.
+func DiscoverySampleSize(population int, confidence, errorRate float64) (int, error) {
+	if confidence <= 0 || confidence >= 1 {
+		return 0, fmt.Errorf("confidence level must be between 0 and 1 (exclusive); got %v", confidence)
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		return 0, fmt.Errorf("error rate must be between 0 and 1 (exclusive); got %v", errorRate)
+	}
+	failed := math.Ceil(errorRate * float64(population))
+	pMiss := 1.0
+	for n := 1; n <= population; n++ {
+		// probability that the first n objects sampled include no failures
+		pMiss *= (float64(population) - failed - float64(n-1)) / float64(population-(n-1))
+		if pMiss <= 1-confidence {
+			return n, nil
+		}
+	}
+	return population, nil
+}
+
+// ClopperPearsonInterval returns the two-sided exact (Clopper-Pearson)
+// confidence interval for the failure rate, given the specified number of
+// failures in a sample of size n. The interval treats the sample as drawn
+// with replacement, and so is conservative for samples that are a large
+// fraction of the population.
+func ClopperPearsonInterval(failures, n int, confidence float64) (lower, upper float64) {
+	alpha := (1 - confidence) / 2
+	lower, upper = 0, 1
+	if failures > 0 {
+		// P(X >= failures) = alpha
+		lower = bisect(func(p float64) bool { return 1-binomialCDF(failures-1, n, p) < alpha })
+	}
+	if failures < n {
+		// P(X <= failures) = alpha
+		upper = bisect(func(p float64) bool { return binomialCDF(failures, n, p) > alpha })
+	}
+	return lower, upper
+}
+
+// UpperConfidenceBound returns the one-sided exact upper confidence bound for
+// the failure rate, given the specified number of failures in a sample of
+// size n
+func UpperConfidenceBound(failures, n int, confidence float64) float64 {
+	if failures >= n {
+		return 1
+	}
+	alpha := 1 - confidence
+	return bisect(func(p float64) bool { return binomialCDF(failures, n, p) > alpha })
+}
+
+// ------------------------------------------------------------
+// Unexported functions
+
+// population returns the objects to sample from, sorted by key, so that the
+// same seed chooses the same sample
+func (s *SampleAudit) population(ctx context.Context) ([]ManifestEntry, error) {
+	var population []ManifestEntry
+	if s.Manifest != nil {
+		population = append(population, s.Manifest...)
+	} else {
+		infos, err := ListObjects(ctx, s.Target, s.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			population = append(population, ManifestEntry{Key: strings.TrimPrefix(info.Key, s.Prefix), Size: info.Size})
+		}
+	}
+	sort.Slice(population, func(i, j int) bool { return population[i].Key < population[j].Key })
+	return population, nil
+}
+
+func (s *SampleAudit) checkAll(ctx context.Context, keys []string, entries map[string]ManifestEntry) []SampleResult {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCopyConcurrency
+	}
+
+	var (
+		mux     sync.Mutex
+		wg      sync.WaitGroup
+		results []SampleResult
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(e ManifestEntry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result := s.check(ctx, e)
+			if ctx.Err() != nil {
+				// interrupted; don't count a spurious failure
+				return
+			}
+			mux.Lock()
+			defer mux.Unlock()
+			results = append(results, result)
+			if s.Report != nil {
+				s.Report(result)
+			}
+		}(entries[key])
+	}
+	wg.Wait()
+	return results
+}
+
+// check checks a single object: that it exists, that its size matches the
+// expected size (if known), and that it can be read in full and its digest
+// matches the expected digest (if known)
+func (s *SampleAudit) check(ctx context.Context, e ManifestEntry) SampleResult {
+	result := SampleResult{Key: e.Key, Size: -1}
+	fail := func(err error) SampleResult {
+		result.Status = AuditError
+		if IsNotFound(err) {
+			result.Status = AuditMissing
+		}
+		result.Error = logging.FormatError(err)
+		return result
+	}
+
+	obj := s.Target.Object(s.Prefix + e.Key)
+	size, err := obj.ContentLength(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	result.Size = size
+	if e.Size >= 0 && size != e.Size {
+		result.Status = AuditChanged
+		result.Error = fmt.Sprintf("expected size %d, got %d", e.Size, size)
+		return result
+	}
+	algorithm := "sha256"
+	if len(e.Digest) == 16 {
+		algorithm = "md5"
+	}
+	digest, err := CalcDigest(ctx, obj, DefaultRangeSize, algorithm)
+	if err != nil {
+		return fail(err)
+	}
+	result.Digest = hex.EncodeToString(digest)
+	result.Status = AuditOK
+	if len(e.Digest) > 0 && result.Digest != hex.EncodeToString(e.Digest) {
+		result.Status = AuditChanged
+		result.Error = fmt.Sprintf("expected %v digest %x, got %v", algorithm, e.Digest, result.Digest)
+	}
+	return result
+}
+
+// binomialCDF returns P(X <= k) for X ~ Binomial(n, p)
+func binomialCDF(k, n int, p float64) float64 {
+	if k < 0 {
+		return 0
+	}
+	if k >= n || p <= 0 {
+		return 1
+	}
+	if p >= 1 {
+		return 0
+	}
+	lgN, _ := math.Lgamma(float64(n + 1))
+	logP, logQ := math.Log(p), math.Log1p(-p)
+	sum := 0.0
+	for i := 0; i <= k; i++ {
+		lgI, _ := math.Lgamma(float64(i + 1))
+		lgNI, _ := math.Lgamma(float64(n - i + 1))
+		sum += math.Exp(lgN - lgI - lgNI + float64(i)*logP + float64(n-i)*logQ)
+	}
+	return math.Min(sum, 1)
+}
+
+// bisect returns the boundary in [0, 1] between the values of p for which
+// below(p) is true (at the low end) and those for which it is false
+func bisect(below func(p float64) bool) float64 {
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 100 && hi-lo > 1e-12; i++ {
+		mid := (lo + hi) / 2
+		if below(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
@@ -0,0 +1,265 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	. "github.com/dmolesUC3/cos/internal/objects"
+
+	"github.com/dmolesUC3/cos/internal/logging"
+)
+
+// ------------------------------------------------------------
+// Soak type
+
+// The Soak struct represents a long-running soak test, repeatedly running
+// create-retrieve-verify-delete cycles (see Crvd) with randomized sizes and
+// keys, and reporting rolling results at regular intervals, until the duration
+// expires, the context is cancelled, or the failure threshold is reached.
+type Soak struct {
+	Target Target
+	// Prefix is the key prefix for soak test objects
+	Prefix string
+	// SizeMin and SizeMax bound the (uniformly distributed) object sizes
+	SizeMin     int64
+	SizeMax     int64
+	Concurrency int
+	// Duration is how long to run, or 0 to run until the context is cancelled
+	Duration time.Duration
+	// Interval is the reporting interval
+	Interval time.Duration
+	// MaxFailures is the number of failed cycles at which to stop, or 0 for no
+	// limit
+	MaxFailures int
+	// MaxFailureRate is the proportion of failed cycles in any one interval at
+	// which to stop, or 0 for no limit
+	MaxFailureRate float64
+	// RandomSeed seeds the choice of sizes, keys, and content
+	RandomSeed int64
+	// Report, if not nil, is called with the results of each interval, and
+	// with the final results when the soak test ends
+	Report func(r *SoakReport)
+}
+
+// The SoakReport struct records the results of a soak test interval, along
+// with the running totals. The final report covers the whole run.
+type SoakReport struct {
+	// Interval is the interval number, starting from 1
+	Interval       int               `json:"interval"`
+	Final          bool              `json:"final,omitempty"`
+	Time           time.Time         `json:"time"`
+	ElapsedSeconds float64           `json:"elapsed_seconds"`
+	Successes      int               `json:"successes"`
+	Failures       int               `json:"failures"`
+	TotalSuccesses int               `json:"total_successes"`
+	TotalFailures  int               `json:"total_failures"`
+	Latency        LatencySummary    `json:"latency"`
+	Histogram      []HistogramBucket `json:"histogram"`
+	// LastError is the last error in the interval, if any
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Run runs the soak test, returning the final report. An error is returned
+// only if the failure threshold is reached. Cycles interrupted by cancellation
+// of the context are not counted.
+func (s *Soak) Run(ctx context.Context) (*SoakReport, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if s.Duration > 0 {
+		runCtx, cancel = context.WithTimeout(runCtx, s.Duration)
+		defer cancel()
+	}
+
+	started := time.Now()
+	r := &soakRun{Soak: s, started: started, intervalStarted: started, stop: cancel, interval: &Latencies{}, total: &Latencies{}}
+	var wg sync.WaitGroup
+	for i := 0; i < s.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			r.work(ctx, runCtx, worker)
+		}(i)
+	}
+	workersDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	var err error
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			report := r.report(false)
+			s.reportTo(report)
+			if err == nil {
+				err = s.checkThreshold(report)
+				if err != nil {
+					cancel()
+				}
+			}
+		case <-workersDone:
+			done = true
+		}
+	}
+	final := r.report(true)
+	s.reportTo(final)
+	if err == nil {
+		err = s.checkThreshold(final)
+	}
+	return final, err
+}
+
+func (s *Soak) validate() error {
+	if s.SizeMin < 0 || s.SizeMax < s.SizeMin {
+		return fmt.Errorf("invalid size range: %d-%d", s.SizeMin, s.SizeMax)
+	}
+	if s.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency: %d", s.Concurrency)
+	}
+	if s.Interval <= 0 {
+		return fmt.Errorf("invalid reporting interval: %v", s.Interval)
+	}
+	if s.MaxFailureRate < 0 || s.MaxFailureRate > 1 {
+		return fmt.Errorf("invalid failure rate: %v", s.MaxFailureRate)
+	}
+	return nil
+}
+
+func (s *Soak) reportTo(report *SoakReport) {
+	if s.Report != nil {
+		s.Report(report)
+	}
+}
+
+// checkThreshold returns an error if the report's failures reach the
+// failure threshold
+func (s *Soak) checkThreshold(report *SoakReport) error {
+	if s.MaxFailures > 0 && report.TotalFailures >= s.MaxFailures {
+		return fmt.Errorf("stopped after %d failures (last error: %v)", report.TotalFailures, report.LastError)
+	}
+	cycles := report.Successes + report.Failures
+	if s.MaxFailureRate > 0 && cycles > 0 && !report.Final {
+		if rate := float64(report.Failures) / float64(cycles); rate >= s.MaxFailureRate {
+			return fmt.Errorf("stopped after %d of %d cycles failed in interval %d (last error: %v)",
+				report.Failures, cycles, report.Interval, report.LastError)
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// soakRun type
+
+// soakRun holds the state of a running soak test
+type soakRun struct {
+	*Soak
+	started time.Time
+	stop    context.CancelFunc
+
+	mux             sync.Mutex
+	intervalCount   int
+	intervalStarted time.Time
+	interval        *Latencies
+	total           *Latencies
+	lastError       error
+	lastErrorTotal  error
+	failures        int
+}
+
+// work runs cycles until the run context is done. The cycles themselves use
+// the parent context, so that a cycle in progress when the duration expires is
+// allowed to complete (and to delete its object).
+func (r *soakRun) work(ctx, runCtx context.Context, worker int) {
+	random := rand.New(rand.NewSource(r.RandomSeed + int64(worker)))
+	for runCtx.Err() == nil {
+		size := r.SizeMin
+		if r.SizeMax > r.SizeMin {
+			size += random.Int63n(r.SizeMax - r.SizeMin + 1)
+		}
+		key := fmt.Sprintf("%vcos-soak-%d-%016x.bin", r.Prefix, worker, random.Uint64())
+		crvd := NewCrvd(r.Target, key, size, random.Int63())
+
+		start := time.Now()
+		err := crvd.CreateRetrieveVerifyDelete(ctx)
+		elapsed := time.Since(start)
+		if ctx.Err() != nil {
+			// interrupted, not failed
+			return
+		}
+
+		if err != nil {
+			logging.DefaultLogger().Infof("%v (%v) failed after %v: %v\n",
+				key, logging.FormatBytes(size), elapsed, logging.FormatError(err))
+		}
+		r.record(elapsed, size, err)
+	}
+}
+
+// record records the result of a cycle. The interval and total are updated
+// together, under the lock, so that a report can't summarize the interval
+// part way through a recording, or reset it between summary and histogram.
+func (r *soakRun) record(elapsed time.Duration, size int64, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.interval.Record(elapsed, size, err)
+	r.total.Record(elapsed, size, err)
+	if err != nil {
+		r.lastError = err
+		r.lastErrorTotal = err
+		r.failures++
+		if r.MaxFailures > 0 && r.failures >= r.MaxFailures {
+			r.stop()
+		}
+	}
+}
+
+// report summarizes the interval just ended, and starts a new one
+func (r *soakRun) report(final bool) *SoakReport {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.intervalCount++
+	now := time.Now()
+	elapsed := now.Sub(r.started)
+	// the interval may be cut short by the end of the run, or stretched by a
+	// late tick, so rates are computed over the time actually elapsed
+	summary := r.interval.Summary(now.Sub(r.intervalStarted))
+	total := r.total.Summary(elapsed)
+	report := &SoakReport{
+		Interval:       r.intervalCount,
+		Final:          final,
+		Time:           now,
+		ElapsedSeconds: elapsed.Seconds(),
+		Successes:      summary.Count,
+		Failures:       summary.Errors,
+		TotalSuccesses: total.Count,
+		TotalFailures:  total.Errors,
+		Latency:        summary,
+		Histogram:      r.interval.Histogram(DefaultHistogramBounds),
+	}
+	lastError := r.lastError
+	if final {
+		// the final report covers the whole run
+		report.Successes, report.Failures = total.Count, total.Errors
+		report.Latency = total
+		report.Histogram = r.total.Histogram(DefaultHistogramBounds)
+		lastError = r.lastErrorTotal
+	}
+	if lastError != nil {
+		report.LastError = logging.FormatError(lastError)
+	}
+	r.interval.Reset()
+	r.intervalStarted = now
+	r.lastError = nil
+	return report
+}